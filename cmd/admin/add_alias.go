@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+
+	"subs-collector/internal/repository"
+	"subs-collector/internal/service"
+)
+
+func init() {
+	commands["add-alias"] = command{
+		usage: "map an alternate name to a service: -service-id N -alias NAME",
+		run:   runAddAlias,
+	}
+}
+
+func runAddAlias(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("add-alias", flag.ContinueOnError)
+	serviceID := fs.Int("service-id", 0, "canonical service id")
+	alias := fs.String("alias", "", "alternate service name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *serviceID <= 0 || *alias == "" {
+		return errors.New("-service-id and -alias are required")
+	}
+
+	svc := service.NewCatalogService(repository.NewCatalogRepository(e.pool))
+	if err := svc.AddAlias(ctx, *serviceID, *alias); err != nil {
+		return err
+	}
+	e.log.Info("alias added", "service_id", *serviceID, "alias", *alias)
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"subs-collector/internal/model"
+	"subs-collector/internal/repository"
+	"subs-collector/internal/subsfile"
+)
+
+func init() {
+	commands["bulk-load"] = command{
+		usage: "load subscriptions from a large CSV or NDJSON file via COPY; -dry-run only reports",
+		run:   runBulkLoad,
+	}
+}
+
+// mappingFlag — повторяемый флаг -map поле:Заголовок
+type mappingFlag []string
+
+func (m *mappingFlag) String() string { return strings.Join(*m, ",") }
+
+func (m *mappingFlag) Set(v string) error {
+	*m = append(*m, v)
+	return nil
+}
+
+func runBulkLoad(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("bulk-load", flag.ContinueOnError)
+	path := fs.String("file", "", "CSV or NDJSON file with subscriptions")
+	format := fs.String("format", "", "csv or ndjson, by default taken from the file extension")
+	dryRun := fs.Bool("dry-run", false, "check rows and roll back")
+	var mapping mappingFlag
+	fs.Var(&mapping, "map", "CSV column for a field as field:Header, repeatable")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *path == "" {
+		return errors.New("-file is required")
+	}
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*path)), ".")
+	}
+
+	f, err := os.Open(*path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	var rd subsfile.Reader
+	switch *format {
+	case "csv":
+		if rd, err = subsfile.NewCSVReader(f, mapping); err != nil {
+			return err
+		}
+	case "ndjson", "jsonl":
+		rd = subsfile.NewNDJSONReader(f)
+	default:
+		return fmt.Errorf("unsupported format %q, expected csv or ndjson", *format)
+	}
+
+	loader := repository.NewBulkLoader(e.pool, repository.WithStrictCatalog(e.cfg.StrictCatalog))
+	started := time.Now()
+	res, err := loader.BulkLoad(ctx, rd.Next, model.BulkLoadOptions{
+		DryRun:       *dryRun,
+		RetryOverlap: e.cfg.OverlapPolicy == model.OverlapWarn,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, re := range res.Errors {
+		fmt.Printf("line %d: %s\n", re.Line, re.Error)
+	}
+	if res.Rejected > len(res.Errors) {
+		fmt.Printf("... and %d more rejected rows\n", res.Rejected-len(res.Errors))
+	}
+	e.log.Info("bulk load finished", "rows", res.Rows, "inserted", res.Inserted, "rejected", res.Rejected,
+		"overlapping", res.Overlapping, "created_services", res.CreatedServices, "committed", res.Committed,
+		"duration", time.Since(started).String())
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"subs-collector/internal/repository"
+	"subs-collector/internal/service"
+)
+
+func init() {
+	commands["dedupe-services"] = command{
+		usage: "report services with equal normalized names; -apply merges them",
+		run:   runDedupeServices,
+	}
+}
+
+func runDedupeServices(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("dedupe-services", flag.ContinueOnError)
+	apply := fs.Bool("apply", false, "merge duplicates into the oldest service of each group")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	svc := service.NewCatalogService(repository.NewCatalogRepository(e.pool))
+	groups, err := svc.Deduplicate(ctx, *apply)
+	if err != nil {
+		return err
+	}
+
+	for _, g := range groups {
+		fmt.Printf("%q -> #%d %q\n", g.NormalizedName, g.Canonical.ID, g.Canonical.Name)
+		for _, d := range g.Duplicates {
+			fmt.Printf("    duplicate #%d %q\n", d.ID, d.Name)
+		}
+	}
+	e.log.Info("dedupe services finished", "groups", len(groups), "applied", *apply)
+
+	return nil
+}
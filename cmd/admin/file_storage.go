@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"subs-collector/internal/repository"
+)
+
+func init() {
+	commands["export-file"] = command{
+		usage: "copy services and subscriptions from Postgres to a new storage file: [-file PATH]",
+		run:   runExportFile,
+	}
+	commands["import-file"] = command{
+		usage: "copy subscriptions from a storage file to Postgres: [-file PATH]",
+		run:   runImportFile,
+	}
+}
+
+// storageFileFlag разбирает -file, по умолчанию STORAGE_FILE
+func storageFileFlag(name string, e *env, args []string) (string, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	path := fs.String("file", e.cfg.StorageFile, "storage file")
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	return *path, nil
+}
+
+func runExportFile(ctx context.Context, e *env, args []string) error {
+	path, err := storageFileFlag("export-file", e, args)
+	if err != nil {
+		return err
+	}
+	n, err := repository.ExportToFile(ctx, e.pool, path)
+	if err != nil {
+		return err
+	}
+	e.log.Info("subscriptions exported to file", "file", path, "subscriptions", n)
+	return nil
+}
+
+func runImportFile(ctx context.Context, e *env, args []string) error {
+	path, err := storageFileFlag("import-file", e, args)
+	if err != nil {
+		return err
+	}
+	n, err := repository.ImportFromFile(ctx, path, e.pool)
+	if err != nil {
+		return err
+	}
+	e.log.Info("subscriptions imported from file", "file", path, "subscriptions", n)
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"subs-collector/internal/catalog"
+	"subs-collector/internal/model"
+	"subs-collector/internal/repository"
+	"subs-collector/internal/service"
+)
+
+func init() {
+	commands["import-catalog"] = command{
+		usage: "load the embedded known-services catalog, keeping local edits; -dry-run only reports",
+		run:   runImportCatalog,
+	}
+}
+
+func runImportCatalog(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("import-catalog", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "report changes without writing them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ds, err := catalog.Load()
+	if err != nil {
+		return err
+	}
+
+	svc := service.NewCatalogService(repository.NewCatalogRepository(e.pool))
+	results, err := svc.ImportCatalog(ctx, ds.Version, ds.Services, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[string]int)
+	for _, r := range results {
+		counts[r.Action]++
+		line := fmt.Sprintf("%-10s #%d %s", r.Action, r.ServiceID, r.Name)
+		if len(r.Kept) > 0 {
+			line += " (kept local: " + strings.Join(r.Kept, ", ") + ")"
+		}
+		fmt.Println(line)
+	}
+	e.log.Info("catalog import finished", "version", ds.Version, "created", counts[model.ImportCreated],
+		"updated", counts[model.ImportUpdated], "unchanged", counts[model.ImportUnchanged], "dry_run", *dryRun)
+
+	return nil
+}
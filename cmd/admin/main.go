@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"subs-collector/config"
+	"subs-collector/internal/logger"
+)
+
+// command — подкоманда админской утилиты, args — аргументы после имени команды
+type command struct {
+	usage string
+	run   func(ctx context.Context, env *env, args []string) error
+}
+
+// env — общие зависимости подкоманд
+type env struct {
+	cfg  config.Config
+	log  *logger.Logger
+	pool *pgxpool.Pool
+}
+
+var commands = map[string]command{}
+
+func main() {
+	l := logger.New()
+
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		printUsage()
+		os.Exit(2)
+	}
+
+	cfg := config.Load(".env", "config.yaml")
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, cfg.DatabaseURL)
+	if err != nil {
+		l.Error("error create datbase pool", "err", err)
+		os.Exit(1)
+	}
+	defer pool.Close()
+
+	if err := pool.Ping(ctx); err != nil {
+		l.Error("failed ping to database", "err", err)
+		os.Exit(1)
+	}
+
+	if err := cmd.run(ctx, &env{cfg: cfg, log: l, pool: pool}, os.Args[2:]); err != nil {
+		l.Error("command failed", "command", os.Args[1], "err", err)
+		pool.Close()
+		os.Exit(1)
+	}
+}
+
+func printUsage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "usage: admin <command> [flags]")
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-20s %s\n", name, commands[name].usage)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"time"
+
+	"subs-collector/internal/repository"
+)
+
+func init() {
+	commands["rebuild-monthly-spend"] = command{
+		usage: "recompute the monthly_spend aggregate, unbounded subscriptions up to -months ahead",
+		run:   runRebuildMonthlySpend,
+	}
+}
+
+func runRebuildMonthlySpend(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("rebuild-monthly-spend", flag.ContinueOnError)
+	months := fs.Int("months", 24, "horizon in months from the current one, as in migration 012")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *months < 1 {
+		return errors.New("-months must be positive")
+	}
+
+	now := time.Now().UTC()
+	// та же формула, что у начального горизонта в миграции 012
+	horizon := time.Date(now.Year(), now.Month()+time.Month(*months), 1, 0, 0, 0, 0, time.UTC)
+
+	started := time.Now()
+	rows, err := repository.NewSpendRepository(e.pool).Rebuild(ctx, horizon)
+	if err != nil {
+		return err
+	}
+	e.log.Info("monthly spend rebuilt", "rows", rows, "horizon", horizon.Format("2006-01"),
+		"duration", time.Since(started).String())
+
+	return nil
+}
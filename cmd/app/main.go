@@ -12,8 +12,10 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"subs-collector/config"
+	"subs-collector/internal/catalog"
 	"subs-collector/internal/handler"
 	"subs-collector/internal/logger"
+	"subs-collector/internal/metrics"
 	"subs-collector/internal/repository"
 	"subs-collector/internal/service"
 )
@@ -23,37 +25,100 @@ func main() {
 	l.Info("start app")
 
 	cfg := config.Load(".env", "config.yaml")
-	l.Info("load configuration", "port", cfg.Port)
+	l.Info("load configuration", "port", cfg.Port, "storage", cfg.Storage, "strict_catalog", cfg.StrictCatalog, "overlap_policy", cfg.OverlapPolicy,
+		"monthly_spend", cfg.MonthlySpend, "summary_cache_ttl", cfg.SummaryCacheTTL, "summary_cache_size", cfg.SummaryCacheSize,
+		"service_cache_ttl", cfg.ServiceCacheTTL, "idempotency_ttl", cfg.IdempotencyTTL, "idempotency_lease", cfg.IdempotencyLease,
+		"repository_retries", cfg.RepositoryRetries, "repository_timeout", cfg.RepositoryTimeout)
 
-	server, dbPoolClose := func() (*http.Server, func()) {
-		ctx := context.Background()
-		pool, err := pgxpool.New(ctx, cfg.DatabaseURL)
-		if err != nil {
-			l.Error("error create datbase pool", "err", err)
-			os.Exit(1)
-		}
+	server, closeStorage := func() (*http.Server, func()) {
+		reg := metrics.NewRegistry()
+		mux := http.NewServeMux()
+
+		var repo repository.SubscriptionRepository
+		var svc service.SubscriptionService
+		var idem repository.IdempotencyRepository
+		closeStorage := func() {}
+		if cfg.Storage == "memory" || cfg.Storage == "file" {
+			ds, err := catalog.Load()
+			if err != nil {
+				l.Error("failed load catalog", "err", err)
+				os.Exit(1)
+			}
+			opts := []repository.MemoryOption{repository.WithMemoryStrictCatalog(cfg.StrictCatalog),
+				repository.WithMemoryCatalog(ds.Services)}
+			if cfg.Storage == "memory" {
+				repo = repository.NewMemorySubscriptionRepository(opts...)
+			} else {
+				fr, err := repository.OpenFileSubscriptionRepository(cfg.StorageFile, opts...)
+				if err != nil {
+					l.Error("failed open storage file", "path", cfg.StorageFile, "err", err)
+					os.Exit(1)
+				}
+				repo = fr
+				closeStorage = func() {
+					if err := fr.Close(); err != nil {
+						l.Error("failed close storage file", "err", err)
+					}
+				}
+			}
+			l.Info("subscriptions are stored without database, catalog API and idempotency keys are disabled",
+				"storage", cfg.Storage)
+		} else {
+			ctx := context.Background()
+			pool, err := pgxpool.New(ctx, cfg.DatabaseURL)
+			if err != nil {
+				l.Error("error create datbase pool", "err", err)
+				os.Exit(1)
+			}
+
+			if err := pool.Ping(ctx); err != nil {
+				l.Error("failed ping to database", "err", err)
+				os.Exit(1)
+			}
+			l.Info("connected to database")
+			closeStorage = pool.Close
 
-		if err := pool.Ping(ctx); err != nil {
-			l.Error("failed ping to database", "err", err)
-			os.Exit(1)
+			services := repository.NewServiceCache(cfg.ServiceCacheSize, cfg.ServiceCacheTTL)
+			go listenServiceChanges(services, pool, l)
+			repo = repository.NewSubscriptionRepository(pool, repository.WithStrictCatalog(cfg.StrictCatalog),
+				repository.WithMonthlySpend(cfg.MonthlySpend), repository.WithServiceCache(services))
+			// изменения справочника (цены, слияния, алиасы) меняют суммы любых пользователей
+			invalidateSummaries := service.WithCatalogChangeHook(func() { service.InvalidateSummaryCache(svc) })
+			ch := handler.NewCatalogHandler(service.NewCatalogService(
+				repository.NewCatalogRepository(pool, repository.WithCatalogServiceCache(services)), invalidateSummaries), l)
+			ch.Register(mux)
+			if cfg.IdempotencyTTL > 0 {
+				idem = repository.NewIdempotencyRepository(pool)
+				go purgeIdempotencyKeys(idem, cfg.IdempotencyTTL, l)
+			}
 		}
-		l.Info("connected to database")
 
-		repo := repository.NewSubscriptionRepository(pool)
-		svc := service.NewSubscriptionService(repo)
+		repo = repository.Decorate(repo, repositoryMiddlewares(cfg, l, reg)...)
+		svc = service.NewSubscriptionService(repo, service.WithOverlapPolicy(cfg.OverlapPolicy))
+		if cfg.SummaryCacheTTL > 0 {
+			svc = service.NewCachedSubscriptionService(svc, cfg.SummaryCacheTTL, cfg.SummaryCacheSize, reg)
+		}
 		h := handler.NewSubscriptionHandler(svc, l)
 
-		mux := http.NewServeMux()
-		h.Register(mux)
+		if idem != nil {
+			subs := http.NewServeMux()
+			h.Register(subs)
+			withKeys := handler.Idempotency(idem, cfg.IdempotencyTTL, min(cfg.IdempotencyLease, cfg.IdempotencyTTL), l)(subs)
+			mux.Handle("/subscriptions", withKeys)
+			mux.Handle("/subscriptions/", withKeys)
+		} else {
+			h.Register(mux)
+		}
+		mux.Handle("/metrics", reg)
 		wrapped := handler.CORS(mux)
 
 		return &http.Server{
 			Addr:              ":" + cfg.Port,
 			Handler:           wrapped,
 			ReadHeaderTimeout: 5 * time.Second,
-		}, pool.Close
+		}, closeStorage
 	}()
-	defer dbPoolClose()
+	defer closeStorage()
 
 	go func() {
 		l.Info("run http server listener", "addr", server.Addr)
@@ -72,3 +137,50 @@ func main() {
 
 	l.Info("stop app")
 }
+
+// repositoryMiddlewares — обёртки репозитория подписок по конфигурации: лог и метрики снаружи видят вызов
+// целиком вместе с повторами, таймаут ограничивает каждую попытку
+func repositoryMiddlewares(cfg config.Config, l *logger.Logger, reg *metrics.Registry) []repository.Middleware {
+	var mws []repository.Middleware
+	if cfg.RepositoryMetrics {
+		mws = append(mws, repository.Metrics(reg))
+	}
+	if cfg.RepositoryLog {
+		mws = append(mws, repository.Logging(l))
+	}
+	if cfg.RepositoryRetries > 1 {
+		mws = append(mws, repository.Retry(cfg.RepositoryRetries, cfg.RepositoryRetryBackoff))
+	}
+	if cfg.RepositoryTimeout > 0 {
+		mws = append(mws, repository.Timeout(cfg.RepositoryTimeout))
+	}
+	return mws
+}
+
+// listenServiceChanges сбрасывает кэш id сервисов по уведомлениям об изменениях справочника из других
+// процессов, после обрыва соединения переподписывается
+func listenServiceChanges(cache *repository.ServiceCache, pool *pgxpool.Pool, l *logger.Logger) {
+	for {
+		err := cache.Listen(context.Background(), pool)
+		if err == nil {
+			return
+		}
+		l.Error("listen service changes", "err", err)
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// purgeIdempotencyKeys периодически удаляет истёкшие ключи идемпотентности
+func purgeIdempotencyKeys(repo repository.IdempotencyRepository, ttl time.Duration, l *logger.Logger) {
+	every := min(ttl, time.Hour)
+	for range time.Tick(every) {
+		n, err := repo.Purge(context.Background())
+		if err != nil {
+			l.Error("purge idempotency keys", "err", err)
+			continue
+		}
+		if n > 0 {
+			l.Info("purged idempotency keys", "count", n)
+		}
+	}
+}
@@ -6,11 +6,45 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
 	DatabaseURL string
 	Port        string
+	// Storage — хранилище подписок: postgres, memory (в памяти процесса) или file (локальный файл StorageFile)
+	Storage string
+	// StorageFile — путь к файлу хранилища при Storage == "file"
+	StorageFile string
+	// StrictCatalog запрещает автосоздание сервисов при записи подписок
+	StrictCatalog bool
+	// OverlapPolicy — реакция на пересекающиеся подписки: reject (409) или warn (сохранить с предупреждением)
+	OverlapPolicy string
+	// MonthlySpend включает чтение сводок из предрасчитанной таблицы monthly_spend
+	MonthlySpend bool
+	// SummaryCacheTTL — время жизни закэшированной суммы сводки, 0 отключает кэш
+	SummaryCacheTTL time.Duration
+	// SummaryCacheSize — наибольшее число закэшированных сводок
+	SummaryCacheSize int
+	// ServiceCacheTTL — время жизни id сервиса в кэше по имени, 0 отключает кэш
+	ServiceCacheTTL time.Duration
+	// ServiceCacheSize — наибольшее число закэшированных имён сервисов
+	ServiceCacheSize int
+	// IdempotencyTTL — сколько хранится ответ на POST с Idempotency-Key, 0 отключает обработку ключей
+	IdempotencyTTL time.Duration
+	// IdempotencyLease — на сколько ключ занимается выполняющимся запросом: после сбоя процесса повтор
+	// получает 409 не дольше этого времени
+	IdempotencyLease time.Duration
+	// RepositoryLog пишет в лог каждый вызов репозитория подписок с длительностью
+	RepositoryLog bool
+	// RepositoryMetrics считает вызовы, ошибки и длительность по методам репозитория в /metrics
+	RepositoryMetrics bool
+	// RepositoryRetries — сколько раз выполняется вызов репозитория при временных ошибках Postgres, 1 — без повторов
+	RepositoryRetries int
+	// RepositoryRetryBackoff — пауза перед первым повтором, дальше удваивается
+	RepositoryRetryBackoff time.Duration
+	// RepositoryTimeout — ограничение времени одного вызова репозитория, 0 — без ограничения
+	RepositoryTimeout time.Duration
 }
 
 func Load(dotEnvFile, configYamlFile string) Config {
@@ -35,10 +69,73 @@ func Load(dotEnvFile, configYamlFile string) Config {
 		}
 	}
 
+	overlapPolicy := getString("OVERLAP_POLICY", envMap, yamlMap, "warn")
+	if overlapPolicy != "warn" && overlapPolicy != "reject" {
+		panic(fmt.Errorf("invalid OVERLAP_POLICY value: %q", overlapPolicy))
+	}
+
+	storage := getString("STORAGE", envMap, yamlMap, "postgres")
+	if storage != "postgres" && storage != "memory" && storage != "file" {
+		panic(fmt.Errorf("invalid STORAGE value: %q", storage))
+	}
+
 	return Config{
-		DatabaseURL: dbURL,
-		Port:        port,
+		DatabaseURL:      dbURL,
+		Port:             port,
+		Storage:          storage,
+		StorageFile:      getString("STORAGE_FILE", envMap, yamlMap, "subs-collector.jsonl"),
+		StrictCatalog:    getBool("CATALOG_STRICT", envMap, yamlMap, false),
+		OverlapPolicy:    overlapPolicy,
+		MonthlySpend:     getBool("SUMMARY_MONTHLY_SPEND", envMap, yamlMap, false),
+		SummaryCacheTTL:  getDuration("SUMMARY_CACHE_TTL", envMap, yamlMap, 30*time.Second),
+		SummaryCacheSize: getPositiveInt("SUMMARY_CACHE_SIZE", envMap, yamlMap, 1000),
+		ServiceCacheTTL:  getDuration("SERVICE_CACHE_TTL", envMap, yamlMap, time.Minute),
+		ServiceCacheSize: getPositiveInt("SERVICE_CACHE_SIZE", envMap, yamlMap, 1000),
+		IdempotencyTTL:   getDuration("IDEMPOTENCY_TTL", envMap, yamlMap, 24*time.Hour),
+		IdempotencyLease: getDuration("IDEMPOTENCY_LEASE", envMap, yamlMap, 5*time.Minute),
+
+		RepositoryLog:          getBool("REPOSITORY_LOG", envMap, yamlMap, false),
+		RepositoryMetrics:      getBool("REPOSITORY_METRICS", envMap, yamlMap, true),
+		RepositoryRetries:      getPositiveInt("REPOSITORY_RETRIES", envMap, yamlMap, 3),
+		RepositoryRetryBackoff: getDuration("REPOSITORY_RETRY_BACKOFF", envMap, yamlMap, 50*time.Millisecond),
+		RepositoryTimeout:      getDuration("REPOSITORY_TIMEOUT", envMap, yamlMap, 0),
+	}
+}
+
+func getDuration(key string, envMap, yamlMap map[string]string, defaultValue time.Duration) time.Duration {
+	v := getString(key, envMap, yamlMap, "")
+	if v == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		panic(fmt.Errorf("invalid %s value: %q", key, v))
+	}
+	return d
+}
+
+func getPositiveInt(key string, envMap, yamlMap map[string]string, defaultValue int) int {
+	v := getString(key, envMap, yamlMap, "")
+	if v == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		panic(fmt.Errorf("invalid %s value: %q", key, v))
+	}
+	return n
+}
+
+func getBool(key string, envMap, yamlMap map[string]string, defaultValue bool) bool {
+	v := getString(key, envMap, yamlMap, "")
+	if v == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		panic(fmt.Errorf("invalid %s value: %q", key, v))
 	}
+	return b
 }
 
 func getString(key string, envMap, yamlMap map[string]string, defaultValue string) string {
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 const (
@@ -105,3 +106,117 @@ func TestLoadConfig(t *testing.T) {
 		t.Errorf("expected %s from kebab-case, got %s", yamlDBURL, cfg.DatabaseURL)
 	}
 }
+
+func TestLoadConfig_StrictCatalog(t *testing.T) {
+	tmpDir := t.TempDir()
+	emptyDotEnv := writeFile(t, tmpDir, ".env", "")
+
+	cfg := Load(emptyDotEnv, filepath.Join(tmpDir, "nonexistent.yaml"))
+	if cfg.StrictCatalog {
+		t.Errorf("expected strict catalog to be disabled by default")
+	}
+
+	yamlPath := writeFile(t, tmpDir, "config.yaml", "catalog_strict: true\n")
+	cfg = Load(emptyDotEnv, yamlPath)
+	if !cfg.StrictCatalog {
+		t.Errorf("expected strict catalog from yaml")
+	}
+}
+
+func TestLoadConfig_OverlapPolicy(t *testing.T) {
+	tmpDir := t.TempDir()
+	emptyDotEnv := writeFile(t, tmpDir, ".env", "")
+
+	cfg := Load(emptyDotEnv, filepath.Join(tmpDir, "nonexistent.yaml"))
+	if cfg.OverlapPolicy != "warn" {
+		t.Errorf("expected default overlap policy warn, got %s", cfg.OverlapPolicy)
+	}
+
+	dotEnv := writeFile(t, tmpDir, ".env", "OVERLAP_POLICY=reject\n")
+	cfg = Load(dotEnv, filepath.Join(tmpDir, "nonexistent.yaml"))
+	if cfg.OverlapPolicy != "reject" {
+		t.Errorf("expected overlap policy reject, got %s", cfg.OverlapPolicy)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic on invalid OVERLAP_POLICY")
+		}
+	}()
+	Load(writeFile(t, tmpDir, ".env", "OVERLAP_POLICY=ignore\n"), filepath.Join(tmpDir, "nonexistent.yaml"))
+}
+
+func TestLoadConfig_Storage(t *testing.T) {
+	tmpDir := t.TempDir()
+	yaml := filepath.Join(tmpDir, "nonexistent.yaml")
+
+	if cfg := Load(writeFile(t, tmpDir, ".env", ""), yaml); cfg.Storage != "postgres" {
+		t.Errorf("expected default storage postgres, got %s", cfg.Storage)
+	}
+	if cfg := Load(writeFile(t, tmpDir, ".env", "STORAGE=memory\n"), yaml); cfg.Storage != "memory" {
+		t.Errorf("expected storage memory, got %s", cfg.Storage)
+	}
+	if cfg := Load(writeFile(t, tmpDir, ".env", "STORAGE=file\nSTORAGE_FILE=/tmp/subs.jsonl\n"), yaml); cfg.StorageFile != "/tmp/subs.jsonl" {
+		t.Errorf("expected storage file /tmp/subs.jsonl, got %s", cfg.StorageFile)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic on invalid STORAGE")
+		}
+	}()
+	Load(writeFile(t, tmpDir, ".env", "STORAGE=sqlite\n"), yaml)
+}
+
+func TestLoadConfig_SummaryCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	yaml := writeFile(t, tmpDir, "config.yaml", "nonexistent: 1\n")
+
+	cfg := Load(writeFile(t, tmpDir, ".env", ""), yaml)
+	if cfg.SummaryCacheTTL != 30*time.Second || cfg.SummaryCacheSize != 1000 {
+		t.Errorf("unexpected defaults: ttl %s, size %d", cfg.SummaryCacheTTL, cfg.SummaryCacheSize)
+	}
+	if cfg.ServiceCacheTTL != time.Minute || cfg.ServiceCacheSize != 1000 {
+		t.Errorf("unexpected service cache defaults: ttl %s, size %d", cfg.ServiceCacheTTL, cfg.ServiceCacheSize)
+	}
+	if cfg.IdempotencyTTL != 24*time.Hour || cfg.IdempotencyLease != 5*time.Minute {
+		t.Errorf("unexpected idempotency defaults: ttl %s, lease %s", cfg.IdempotencyTTL, cfg.IdempotencyLease)
+	}
+
+	cfg = Load(writeFile(t, tmpDir, ".env", "SUMMARY_CACHE_TTL=0s\nSUMMARY_CACHE_SIZE=50\n"), yaml)
+	if cfg.SummaryCacheTTL != 0 || cfg.SummaryCacheSize != 50 {
+		t.Errorf("unexpected values: ttl %s, size %d", cfg.SummaryCacheTTL, cfg.SummaryCacheSize)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic on invalid SUMMARY_CACHE_SIZE")
+		}
+	}()
+	Load(writeFile(t, tmpDir, ".env", "SUMMARY_CACHE_SIZE=0\n"), yaml)
+}
+
+func TestLoadConfig_Repository(t *testing.T) {
+	tmpDir := t.TempDir()
+	yaml := filepath.Join(tmpDir, "nonexistent.yaml")
+
+	cfg := Load(writeFile(t, tmpDir, ".env", ""), yaml)
+	if cfg.RepositoryLog || !cfg.RepositoryMetrics || cfg.RepositoryRetries != 3 ||
+		cfg.RepositoryRetryBackoff != 50*time.Millisecond || cfg.RepositoryTimeout != 0 {
+		t.Errorf("unexpected repository defaults: %+v", cfg)
+	}
+
+	cfg = Load(writeFile(t, tmpDir, ".env", "REPOSITORY_LOG=true\nREPOSITORY_METRICS=false\nREPOSITORY_RETRIES=1\n"+
+		"REPOSITORY_RETRY_BACKOFF=10ms\nREPOSITORY_TIMEOUT=2s\n"), yaml)
+	if !cfg.RepositoryLog || cfg.RepositoryMetrics || cfg.RepositoryRetries != 1 ||
+		cfg.RepositoryRetryBackoff != 10*time.Millisecond || cfg.RepositoryTimeout != 2*time.Second {
+		t.Errorf("unexpected repository values: %+v", cfg)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic on invalid REPOSITORY_RETRIES")
+		}
+	}()
+	Load(writeFile(t, tmpDir, ".env", "REPOSITORY_RETRIES=0\n"), yaml)
+}
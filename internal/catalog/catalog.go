@@ -0,0 +1,48 @@
+// Package catalog содержит встроенный версионированный набор известных сервисов подписок.
+package catalog
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+
+	"subs-collector/internal/model"
+)
+
+//go:embed data/services.json
+var files embed.FS
+
+// Dataset — версия каталога и его записи
+type Dataset struct {
+	Version  int                  `json:"version"`
+	Services []model.CatalogEntry `json:"services"`
+}
+
+// Load разбирает встроенный каталог и проверяет, что имена сервисов не повторяются
+func Load() (*Dataset, error) {
+	raw, err := files.ReadFile("data/services.json")
+	if err != nil {
+		return nil, err
+	}
+
+	var ds Dataset
+	if err := json.Unmarshal(raw, &ds); err != nil {
+		return nil, fmt.Errorf("parse catalog: %w", err)
+	}
+	if ds.Version <= 0 {
+		return nil, fmt.Errorf("catalog version must be positive, got %d", ds.Version)
+	}
+
+	seen := make(map[string]bool, len(ds.Services))
+	for _, e := range ds.Services {
+		for _, name := range append([]string{e.Name}, e.Aliases...) {
+			key := model.NormalizeServiceName(name)
+			if key == "" || seen[key] {
+				return nil, fmt.Errorf("catalog: empty or duplicate name %q", name)
+			}
+			seen[key] = true
+		}
+	}
+
+	return &ds, nil
+}
@@ -0,0 +1,23 @@
+package catalog
+
+import "testing"
+
+func TestLoad(t *testing.T) {
+	ds, err := Load()
+	if err != nil {
+		t.Fatalf("load embedded catalog: %v", err)
+	}
+	if len(ds.Services) == 0 {
+		t.Fatal("embedded catalog is empty")
+	}
+	for _, e := range ds.Services {
+		if e.Category == nil || *e.Category == "" {
+			t.Errorf("%s: category is required", e.Name)
+		}
+		for _, p := range e.Prices {
+			if len(p.Currency) != 3 || p.PriceMinor <= 0 {
+				t.Errorf("%s: invalid price %+v", e.Name, p)
+			}
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"subs-collector/internal/logger"
+	"subs-collector/internal/model"
+	"subs-collector/internal/service"
+)
+
+type CatalogHandler struct {
+	service service.CatalogService
+	log     *logger.Logger
+}
+
+func NewCatalogHandler(s service.CatalogService, l *logger.Logger) *CatalogHandler {
+	return &CatalogHandler{service: s, log: l}
+}
+
+func (h *CatalogHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/services", h.handleList)
+	mux.HandleFunc("/services/", h.handleByID)
+}
+
+func (h *CatalogHandler) handleList(w http.ResponseWriter, r *http.Request) {
+	h.log.Info("incoming request", "method", r.Method, "path", r.URL.Path)
+	if r.Method != http.MethodGet {
+		respondJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	items, err := h.service.ListServices(r.Context())
+	if err != nil {
+		h.log.Error("list services error", "err", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+		return
+	}
+
+	respondJSON(w, http.StatusOK, items)
+}
+
+// handleByID разбирает пути вида /services/{id}/...
+func (h *CatalogHandler) handleByID(w http.ResponseWriter, r *http.Request) {
+	h.log.Info("incoming request", "method", r.Method, "path", r.URL.Path)
+	parts := strings.Split(strings.Trim(r.URL.Path[len("/services/"):], "/"), "/")
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		h.log.Error("invalid id", "id", parts[0], "err", err)
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		switch r.Method {
+		case http.MethodGet:
+			h.get(w, r, id)
+		case http.MethodPut:
+			h.setLabels(w, r, id)
+		default:
+			respondJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		}
+	case len(parts) == 2 && parts[1] == "components":
+		if r.Method != http.MethodPut {
+			respondJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		h.setComponents(w, r, id)
+	case len(parts) == 2 && parts[1] == "price-changes":
+		if r.Method != http.MethodPost {
+			respondJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		h.changePrice(w, r, id)
+	case len(parts) == 2 && parts[1] == "plans":
+		switch r.Method {
+		case http.MethodGet:
+			h.listPlans(w, r, id)
+		case http.MethodPost:
+			h.createPlan(w, r, id)
+		default:
+			respondJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		}
+	case len(parts) == 3 && parts[1] == "merge-into":
+		target, err := strconv.Atoi(parts[2])
+		if err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid target id"})
+			return
+		}
+		if r.Method != http.MethodPost {
+			respondJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		h.merge(w, r, id, target)
+	default:
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+}
+
+func (h *CatalogHandler) get(w http.ResponseWriter, r *http.Request, id int) {
+	sv, err := h.service.GetService(r.Context(), id)
+	if err != nil {
+		h.log.Error("get service error", "id", id, "err", err)
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, sv)
+}
+
+type serviceLabelsDTO struct {
+	Category *string  `json:"category"`
+	Tags     []string `json:"tags"`
+}
+
+func (h *CatalogHandler) setLabels(w http.ResponseWriter, r *http.Request, id int) {
+	var dto serviceLabelsDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		h.log.Error("decode body error", "err", err)
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body"})
+		return
+	}
+
+	sv, err := h.service.SetLabels(r.Context(), id, dto.Category, dto.Tags)
+	if err != nil {
+		h.log.Error("update service error", "id", id, "err", err)
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, sv)
+}
+
+// setComponents принимает полный состав пакета, пустой список делает сервис обычным
+func (h *CatalogHandler) setComponents(w http.ResponseWriter, r *http.Request, id int) {
+	var dto []model.BundleComponent
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		h.log.Error("decode body error", "err", err)
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body"})
+		return
+	}
+
+	sv, err := h.service.SetComponents(r.Context(), id, dto)
+	if err != nil {
+		h.log.Error("set components error", "id", id, "err", err)
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, sv)
+}
+
+type priceChangeDTO struct {
+	EffectiveMonth string `json:"effective_month"` // MM-YYYY
+	Price          *int   `json:"price"`
+	Plan           string `json:"plan"`
+	Currency       string `json:"currency"`
+}
+
+func (h *CatalogHandler) changePrice(w http.ResponseWriter, r *http.Request, serviceID int) {
+	dryRun, err := parseBool(r.URL.Query().Get("dry_run"))
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid dry_run"})
+		return
+	}
+
+	var dto priceChangeDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		h.log.Error("decode body error", "err", err)
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body"})
+		return
+	}
+	month, err := parseData(dto.EffectiveMonth)
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid effective_month"})
+		return
+	}
+	if dto.Price == nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "price is required"})
+		return
+	}
+
+	res, err := h.service.ChangePrice(r.Context(), model.ServicePriceChange{
+		ServiceID:      serviceID,
+		EffectiveMonth: month,
+		Price:          *dto.Price,
+		Plan:           dto.Plan,
+		Currency:       dto.Currency,
+	}, dryRun)
+	if err != nil {
+		h.log.Error("price change error", "service_id", serviceID, "err", err)
+		respondError(w, err)
+		return
+	}
+	h.log.Info("service price changed", "service_id", serviceID, "affected", len(res.Affected),
+		"monthly_delta", res.MonthlyDelta, "dry_run", dryRun)
+
+	respondJSON(w, http.StatusOK, res)
+}
+
+func (h *CatalogHandler) listPlans(w http.ResponseWriter, r *http.Request, serviceID int) {
+	plans, err := h.service.ListPlans(r.Context(), serviceID)
+	if err != nil {
+		h.log.Error("list plans error", "service_id", serviceID, "err", err)
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, plans)
+}
+
+type planDTO struct {
+	Name          string `json:"name"`
+	Price         int    `json:"price"`
+	BillingPeriod string `json:"billing_period"` // month | year
+	Currency      string `json:"currency"`
+}
+
+func (h *CatalogHandler) createPlan(w http.ResponseWriter, r *http.Request, serviceID int) {
+	var dto planDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		h.log.Error("decode body error", "err", err)
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body"})
+		return
+	}
+
+	p := model.Plan{
+		ServiceID:     serviceID,
+		Name:          dto.Name,
+		Price:         dto.Price,
+		BillingPeriod: dto.BillingPeriod,
+		Currency:      dto.Currency,
+	}
+	id, err := h.service.CreatePlan(r.Context(), &p)
+	if err != nil {
+		h.log.Error("create plan error", "service_id", serviceID, "err", err)
+		respondError(w, err)
+		return
+	}
+	p.ID = id
+
+	respondJSON(w, http.StatusCreated, p)
+}
+
+func (h *CatalogHandler) merge(w http.ResponseWriter, r *http.Request, sourceID, targetID int) {
+	dryRun, err := parseBool(r.URL.Query().Get("dry_run"))
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid dry_run"})
+		return
+	}
+
+	res, err := h.service.MergeServices(r.Context(), sourceID, targetID, dryRun)
+	if err != nil {
+		h.log.Error("merge services error", "source", sourceID, "target", targetID, "err", err)
+		respondError(w, err)
+		return
+	}
+	h.log.Info("services merged", "source", sourceID, "target", targetID,
+		"moved", res.MovedSubscriptions, "dry_run", dryRun)
+
+	respondJSON(w, http.StatusOK, res)
+}
+
+// parseBool разбирает необязательный булев query-параметр, пустое значение — false
+func parseBool(s string) (bool, error) {
+	if s == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(s)
+}
+
+// respondError отображает доменные ошибки в HTTP-статусы
+func respondError(w http.ResponseWriter, err error) {
+	var invalid *model.ErrInvalid
+	switch {
+	case errors.As(err, &invalid):
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": invalid.Msg})
+	case errors.Is(err, model.ErrNotFound):
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	default:
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+}
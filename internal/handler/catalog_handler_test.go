@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"subs-collector/internal/logger"
+	"subs-collector/internal/model"
+)
+
+type fakeCatalogService struct {
+	mergeErr    error
+	mergeDryRun bool
+	priceChange model.ServicePriceChange
+}
+
+func (f *fakeCatalogService) ListServices(_ context.Context) ([]model.Service, error) {
+	return []model.Service{}, nil
+}
+func (f *fakeCatalogService) GetService(_ context.Context, id int) (*model.Service, error) {
+	return &model.Service{ID: id, Name: "VideoHub"}, nil
+}
+func (f *fakeCatalogService) SetLabels(_ context.Context, id int, category *string, tags []string) (*model.Service, error) {
+	return &model.Service{ID: id, Name: "VideoHub", Tags: tags, CatalogFields: model.CatalogFields{Category: category}}, nil
+}
+func (f *fakeCatalogService) SetComponents(_ context.Context, id int, c []model.BundleComponent) (*model.Service, error) {
+	return &model.Service{ID: id, Components: c}, nil
+}
+func (f *fakeCatalogService) ListPlans(_ context.Context, _ int) ([]model.Plan, error) {
+	return []model.Plan{}, nil
+}
+func (f *fakeCatalogService) CreatePlan(_ context.Context, _ *model.Plan) (int, error) { return 5, nil }
+func (f *fakeCatalogService) AddAlias(_ context.Context, _ int, _ string) error        { return nil }
+func (f *fakeCatalogService) Deduplicate(_ context.Context, _ bool) ([]model.DuplicateGroup, error) {
+	return nil, nil
+}
+func (f *fakeCatalogService) ChangePrice(_ context.Context, c model.ServicePriceChange, dryRun bool) (*model.PriceChangeResult, error) {
+	f.priceChange = c
+	return &model.PriceChangeResult{ServiceID: c.ServiceID, Price: c.Price, DryRun: dryRun, MonthlyDelta: 200}, nil
+}
+func (f *fakeCatalogService) ImportCatalog(_ context.Context, _ int, _ []model.CatalogEntry, _ bool) ([]model.ImportResult, error) {
+	return nil, nil
+}
+func (f *fakeCatalogService) MergeServices(_ context.Context, src, dst int, dryRun bool) (*model.MergeResult, error) {
+	f.mergeDryRun = dryRun
+	if f.mergeErr != nil {
+		return nil, f.mergeErr
+	}
+	return &model.MergeResult{SourceID: src, TargetID: dst, MovedSubscriptions: 3, DryRun: dryRun}, nil
+}
+
+func TestMerge_DryRun(t *testing.T) {
+	s := &fakeCatalogService{}
+	h := NewCatalogHandler(s, logger.New())
+
+	req := httptest.NewRequest(http.MethodPost, "/services/2/merge-into/1?dry_run=true", nil)
+	rec := httptest.NewRecorder()
+	h.handleByID(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ожидался 200, получил %d", rec.Code)
+	}
+	var res model.MergeResult
+	_ = json.NewDecoder(rec.Body).Decode(&res)
+	if !s.mergeDryRun || res.SourceID != 2 || res.TargetID != 1 || res.MovedSubscriptions != 3 {
+		t.Fatalf("неожиданный результат %+v", res)
+	}
+}
+
+func TestMerge_NotFound(t *testing.T) {
+	h := NewCatalogHandler(&fakeCatalogService{mergeErr: model.ErrNotFound}, logger.New())
+
+	req := httptest.NewRequest(http.MethodPost, "/services/2/merge-into/9", nil)
+	rec := httptest.NewRecorder()
+	h.handleByID(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("ожидался 404, получил %d", rec.Code)
+	}
+}
+
+func TestChangePrice_DryRun(t *testing.T) {
+	s := &fakeCatalogService{}
+	h := NewCatalogHandler(s, logger.New())
+
+	body := `{"effective_month":"09-2025","price":1190,"plan":"Premium"}`
+	req := httptest.NewRequest(http.MethodPost, "/services/1/price-changes?dry_run=1", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.handleByID(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ожидался 200, получил %d", rec.Code)
+	}
+	var res model.PriceChangeResult
+	_ = json.NewDecoder(rec.Body).Decode(&res)
+	if !res.DryRun || res.MonthlyDelta != 200 {
+		t.Fatalf("неожиданный ответ %+v", res)
+	}
+	if s.priceChange.EffectiveMonth.Month() != 9 || s.priceChange.Plan != "Premium" || s.priceChange.Price != 1190 {
+		t.Fatalf("неверные параметры изменения %+v", s.priceChange)
+	}
+}
+
+func TestChangePrice_RequiresPrice(t *testing.T) {
+	h := NewCatalogHandler(&fakeCatalogService{}, logger.New())
+
+	req := httptest.NewRequest(http.MethodPost, "/services/1/price-changes", strings.NewReader(`{"effective_month":"09-2025"}`))
+	rec := httptest.NewRecorder()
+	h.handleByID(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("ожидался 400, получил %d", rec.Code)
+	}
+}
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"subs-collector/internal/logger"
+	"subs-collector/internal/model"
+)
+
+// IdempotencyStore — хранилище ответов на запросы с Idempotency-Key, реализуется repository.IdempotencyRepository
+type IdempotencyStore interface {
+	Reserve(ctx context.Context, key, fingerprint string, lease time.Duration) (*model.StoredResponse, bool, error)
+	Complete(ctx context.Context, key string, resp model.StoredResponse, ttl time.Duration) error
+	Release(ctx context.Context, key, fingerprint string) error
+}
+
+const (
+	idempotencyHeader  = "Idempotency-Key"
+	idempotencyMaxKey  = 255
+	idempotencyMaxBody = 32 << 20
+)
+
+// Idempotency обрабатывает POST-запросы с заголовком Idempotency-Key: первый ответ сохраняется в store
+// вместе с отпечатком запроса, повтор с тем же ключом в течение ttl получает сохранённый ответ
+// (заголовок Idempotent-Replayed: true), повтор с другим запросом — 422, пока первый выполняется — 409.
+// Выполняющийся запрос занимает ключ не дольше lease: если процесс упал, повтор после lease выполнится заново.
+// Ответы 5xx не сохраняются, такой запрос можно повторить.
+func Idempotency(store IdempotencyStore, ttl, lease time.Duration, l *logger.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(idempotencyHeader)
+			if r.Method != http.MethodPost || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > idempotencyMaxKey {
+				respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Idempotency-Key too long"})
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, idempotencyMaxBody))
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				respondJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "body too large"})
+				return
+			}
+			if err != nil {
+				respondJSON(w, http.StatusBadRequest, map[string]string{"error": "failed to read body"})
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			fingerprint := requestFingerprint(r, body)
+
+			stored, reserved, err := store.Reserve(r.Context(), key, fingerprint, lease)
+			if err != nil {
+				l.Error("idempotency reserve error", "err", err)
+				respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+				return
+			}
+			if !reserved {
+				switch {
+				case stored.Fingerprint != fingerprint:
+					respondJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": "Idempotency-Key reused with a different request"})
+				case stored.Status == 0:
+					respondJSON(w, http.StatusConflict, map[string]string{"error": "request with this Idempotency-Key is in progress"})
+				default:
+					l.Info("idempotent replay", "path", r.URL.Path, "status", stored.Status)
+					if stored.ContentType != "" {
+						w.Header().Set("Content-Type", stored.ContentType)
+					}
+					w.Header().Set("Idempotent-Replayed", "true")
+					w.WriteHeader(stored.Status)
+					_, _ = w.Write(stored.Body)
+				}
+				return
+			}
+
+			rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			// паника обработчика тоже освобождает ключ, иначе повторы получали бы 409 до истечения lease
+			defer func() {
+				p := recover()
+
+				// клиент мог отключиться, но ответ всё равно нужно сохранить или освободить ключ
+				ctx := context.WithoutCancel(r.Context())
+				var err error
+				if p != nil || rec.status >= http.StatusInternalServerError {
+					err = store.Release(ctx, key, fingerprint)
+				} else {
+					err = store.Complete(ctx, key, model.StoredResponse{
+						Fingerprint: fingerprint,
+						Status:      rec.status,
+						ContentType: rec.Header().Get("Content-Type"),
+						Body:        rec.body.Bytes(),
+					}, ttl)
+				}
+				if err != nil {
+					l.Error("idempotency store error", "err", err)
+				}
+				if p != nil {
+					panic(p)
+				}
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+// requestFingerprint — sha256 метода, пути, query и тела запроса
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	_, _ = io.WriteString(h, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery+"\n")
+	_, _ = h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder пишет ответ клиенту и запоминает его статус и тело
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(code int) {
+	if !rr.wroteHeader {
+		rr.status, rr.wroteHeader = code, true
+	}
+	rr.ResponseWriter.WriteHeader(code)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.wroteHeader = true
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
+
+func (rr *responseRecorder) Unwrap() http.ResponseWriter { return rr.ResponseWriter }
@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"subs-collector/internal/logger"
+	"subs-collector/internal/model"
+)
+
+// memIdempotencyStore — хранилище ключей в памяти без истечения, запоминает время хранения ключей
+type memIdempotencyStore struct {
+	mu   sync.Mutex
+	keys map[string]model.StoredResponse
+	ttl  map[string]time.Duration
+}
+
+func newMemIdempotencyStore() *memIdempotencyStore {
+	return &memIdempotencyStore{keys: map[string]model.StoredResponse{}, ttl: map[string]time.Duration{}}
+}
+
+func (s *memIdempotencyStore) Reserve(_ context.Context, key, fingerprint string, lease time.Duration) (*model.StoredResponse, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if resp, ok := s.keys[key]; ok {
+		return &resp, false, nil
+	}
+	s.keys[key], s.ttl[key] = model.StoredResponse{Fingerprint: fingerprint}, lease
+	return nil, true, nil
+}
+
+func (s *memIdempotencyStore) Complete(_ context.Context, key string, resp model.StoredResponse, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cur, ok := s.keys[key]; ok && cur.Fingerprint == resp.Fingerprint && cur.Status == 0 {
+		s.keys[key], s.ttl[key] = resp, ttl
+	}
+	return nil
+}
+
+func (s *memIdempotencyStore) Release(_ context.Context, key, fingerprint string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cur, ok := s.keys[key]; ok && cur.Fingerprint == fingerprint && cur.Status == 0 {
+		delete(s.keys, key)
+	}
+	return nil
+}
+
+func TestIdempotency_ReplaysAndRejectsDifferentBody(t *testing.T) {
+	store := newMemIdempotencyStore()
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		respondJSON(w, http.StatusCreated, map[string]int{"id": 42})
+	})
+	h := Idempotency(store, time.Hour, time.Minute, logger.New())(next)
+
+	send := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/subscriptions", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", key)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := send("k1", `{"price":1}`)
+	replay := send("k1", `{"price":1}`)
+	if calls != 1 {
+		t.Fatalf("обработчик вызван %d раз, ожидался 1", calls)
+	}
+	if replay.Code != http.StatusCreated || replay.Body.String() != first.Body.String() ||
+		replay.Header().Get("Idempotent-Replayed") != "true" || replay.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("повтор не воспроизвёл ответ: %d %q %v", replay.Code, replay.Body.String(), replay.Header())
+	}
+
+	if rec := send("k1", `{"price":2}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("другое тело с тем же ключом: ожидался 422, получил %d", rec.Code)
+	}
+	if rec := send("k2", `{"price":2}`); rec.Code != http.StatusCreated || calls != 2 {
+		t.Fatalf("новый ключ: ожидался новый вызов, получил %d, вызовов %d", rec.Code, calls)
+	}
+}
+
+func TestIdempotency_ServerErrorReleasesKey(t *testing.T) {
+	store := newMemIdempotencyStore()
+	fail := true
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if fail {
+			respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		respondJSON(w, http.StatusCreated, map[string]int{"id": 1})
+	})
+	h := Idempotency(store, time.Hour, time.Minute, logger.New())(next)
+
+	for _, want := range []int{http.StatusInternalServerError, http.StatusCreated} {
+		req := httptest.NewRequest(http.MethodPost, "/subscriptions", strings.NewReader(`{}`))
+		req.Header.Set("Idempotency-Key", "k")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("ожидался %d, получил %d", want, rec.Code)
+		}
+		fail = false
+	}
+
+	store.keys["pending"] = model.StoredResponse{Fingerprint: requestFingerprint(
+		httptest.NewRequest(http.MethodPost, "/subscriptions", nil), []byte(`{}`))}
+	req := httptest.NewRequest(http.MethodPost, "/subscriptions", strings.NewReader(`{}`))
+	req.Header.Set("Idempotency-Key", "pending")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("ключ в работе: ожидался 409, получил %d", rec.Code)
+	}
+}
+
+// TestIdempotency_PanicReleasesKey — паника обработчика освобождает ключ и пробрасывается дальше
+func TestIdempotency_PanicReleasesKey(t *testing.T) {
+	store := newMemIdempotencyStore()
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) { panic("boom") })
+	h := Idempotency(store, time.Hour, time.Minute, logger.New())(next)
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Fatalf("ожидалась паника boom, получил %v", p)
+			}
+		}()
+		req := httptest.NewRequest(http.MethodPost, "/subscriptions", strings.NewReader(`{}`))
+		req.Header.Set("Idempotency-Key", "k")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+
+	if _, ok := store.keys["k"]; ok {
+		t.Fatalf("ключ остался занят после паники")
+	}
+}
+
+// TestIdempotency_LeaseUntilComplete — выполняющийся запрос занимает ключ на lease, ответ хранится ttl
+func TestIdempotency_LeaseUntilComplete(t *testing.T) {
+	store := newMemIdempotencyStore()
+	var leased time.Duration
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		leased = store.ttl["k"]
+		respondJSON(w, http.StatusCreated, map[string]int{"id": 1})
+	})
+	h := Idempotency(store, time.Hour, time.Minute, logger.New())(next)
+
+	req := httptest.NewRequest(http.MethodPost, "/subscriptions", strings.NewReader(`{}`))
+	req.Header.Set("Idempotency-Key", "k")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if leased != time.Minute || store.ttl["k"] != time.Hour {
+		t.Fatalf("ожидались lease 1m и ttl 1h, получил %s и %s", leased, store.ttl["k"])
+	}
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"subs-collector/internal/model"
+)
+
+// batchMaxBody — наибольший размер тела POST /subscriptions/batch
+const batchMaxBody = 8 << 20
+
+type batchRequest struct {
+	ContinueOnError bool              `json:"continue_on_error"`
+	Operations      []json.RawMessage `json:"operations"`
+}
+
+type batchOpDTO struct {
+	Op           string           `json:"op"`
+	ID           int              `json:"id"`
+	Subscription *subscriptionDTO `json:"subscription"`
+}
+
+// handleBatch выполняет пакет операций create/update/delete в одной транзакции. Каждая операция
+// проверяется как соответствующий одиночный запрос, ответ — итог каждой операции по порядку.
+func (h *SubscriptionHandler) handleBatch(w http.ResponseWriter, r *http.Request) {
+	h.log.Info("incoming request", "method", r.Method, "path", r.URL.Path)
+	if r.Method != http.MethodPost {
+		h.respondJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	var req batchRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, batchMaxBody)).Decode(&req)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		h.respondJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "body too large"})
+		return
+	}
+	if err != nil {
+		h.respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+
+	ops := make([]model.BatchOp, len(req.Operations))
+	for i, raw := range req.Operations {
+		ops[i] = parseBatchOp(raw)
+	}
+
+	report, err := h.service.Batch(r.Context(), ops, req.ContinueOnError)
+	if err != nil {
+		h.log.Error("batch error", "err", err)
+		respondError(w, err)
+		return
+	}
+	h.log.Info("batch finished", "operations", len(ops), "failed", report.Failed, "committed", report.Committed)
+
+	h.respondJSON(w, http.StatusOK, report)
+}
+
+// parseBatchOp разбирает операцию пакета, ошибка попадает в BatchOp.Err
+func parseBatchOp(raw json.RawMessage) model.BatchOp {
+	var dto batchOpDTO
+	if err := json.Unmarshal(raw, &dto); err != nil {
+		return model.BatchOp{Err: &model.ErrInvalid{Msg: "invalid JSON"}}
+	}
+	op := model.BatchOp{Op: dto.Op, ID: dto.ID}
+
+	switch dto.Op {
+	case model.BatchCreate, model.BatchUpdate, model.BatchDelete:
+	default:
+		op.Err = &model.ErrInvalid{Msg: "unknown op, expected create, update or delete"}
+		return op
+	}
+	if dto.Op != model.BatchCreate && dto.ID <= 0 {
+		op.Err = &model.ErrInvalid{Msg: "invalid id"}
+		return op
+	}
+	if dto.Op == model.BatchDelete {
+		return op
+	}
+	if dto.Subscription == nil {
+		op.Err = &model.ErrInvalid{Msg: "subscription is required"}
+		return op
+	}
+	op.Subscription, op.Err = subscriptionFromDTO(*dto.Subscription)
+	return op
+}
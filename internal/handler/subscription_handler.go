@@ -2,14 +2,16 @@ package handler
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
 	"subs-collector/internal/logger"
 	"subs-collector/internal/model"
 	"subs-collector/internal/service"
+	"subs-collector/internal/subsfile"
 
 	"github.com/google/uuid"
 )
@@ -27,14 +29,20 @@ func (h *SubscriptionHandler) Register(mux *http.ServeMux) {
 	mux.HandleFunc("/subscriptions", h.handleListOrCreate)
 	mux.HandleFunc("/subscriptions/", h.handleByID)
 	mux.HandleFunc("/subscriptions/summary", h.handleSummary)
+	mux.HandleFunc("/subscriptions/bundle-overlaps", h.handleBundleOverlaps)
+	mux.HandleFunc("/subscriptions/overlaps", h.handleOverlaps)
+	mux.HandleFunc("/subscriptions/import", h.handleImport)
+	mux.HandleFunc("/subscriptions/export", h.handleExport)
+	mux.HandleFunc("/subscriptions/batch", h.handleBatch)
 }
 
-type subscriptionDTO struct {
-	ServiceName string  `json:"service_name"`
-	Price       int     `json:"price"`
-	UserID      string  `json:"user_id"`
-	StartDate   string  `json:"start_date"` // MM-YYYY
-	EndDate     *string `json:"end_date"`   // MM-YYYY
+// subscriptionDTO — тело POST и PUT /subscriptions, тот же формат у строк импорта
+type subscriptionDTO = subsfile.Record
+
+// subscriptionFromDTO проверяет поля запроса и переводит их в модель, ошибка — *model.ErrInvalid.
+// Те же правила применяются к строкам импорта.
+func subscriptionFromDTO(dto subscriptionDTO) (model.Subscription, error) {
+	return dto.Subscription()
 }
 
 func (h *SubscriptionHandler) handleListOrCreate(w http.ResponseWriter, r *http.Request) {
@@ -82,39 +90,63 @@ func (h *SubscriptionHandler) create(w http.ResponseWriter, r *http.Request) {
 		h.respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body"})
 		return
 	}
-	if _, err := uuid.Parse(dto.UserID); err != nil {
-		h.respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid user_id"})
-		return
-	}
-	start, err := parseData(dto.StartDate)
+	sub, err := subscriptionFromDTO(dto)
 	if err != nil {
-		h.respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid start_date"})
+		h.respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
-	var endPtr *time.Time
-	if dto.EndDate != nil && *dto.EndDate != "" {
-		end, err := parseData(*dto.EndDate)
-		if err != nil {
-			h.respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid end_date"})
-			return
-		}
-		endPtr = &end
-	}
-	sub := model.Subscription{
-		ServiceName: dto.ServiceName,
-		Price:       dto.Price,
-		UserID:      dto.UserID,
-		StartDate:   start,
-		EndDate:     endPtr,
-	}
 	id, err := h.service.Create(r.Context(), &sub)
+	if h.respondValidation(w, err) {
+		return
+	}
 	if err != nil {
 		h.log.Error("create error", "err", err)
 		h.respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
 		return
 	}
 
-	h.respondJSON(w, http.StatusCreated, map[string]int{"id": id})
+	resp := map[string]interface{}{"id": id}
+	if warnings := h.bundleWarnings(r, sub.UserID, id); len(warnings) > 0 {
+		resp["warnings"] = warnings
+	}
+	if sub.AllowOverlap {
+		resp["overlaps"] = h.overlapWarnings(r, sub.UserID, id)
+	}
+	h.respondJSON(w, http.StatusCreated, resp)
+}
+
+// overlapWarnings — пересечения подписки id с другими подписками пользователя на тот же сервис
+func (h *SubscriptionHandler) overlapWarnings(r *http.Request, userID string, id int) []model.SubscriptionOverlap {
+	res := make([]model.SubscriptionOverlap, 0)
+	overlaps, err := h.service.Overlaps(r.Context(), userID)
+	if err != nil {
+		h.log.Error("overlaps error", "user_id", userID, "err", err)
+		return res
+	}
+
+	for _, o := range overlaps {
+		if o.SubscriptionID == id || o.OtherID == id {
+			res = append(res, o)
+		}
+	}
+	return res
+}
+
+// bundleWarnings — пересечения новой подписки с пакетами пользователя; ошибка поиска не мешает созданию
+func (h *SubscriptionHandler) bundleWarnings(r *http.Request, userID string, id int) []model.BundleOverlap {
+	overlaps, err := h.service.BundleOverlaps(r.Context(), userID)
+	if err != nil {
+		h.log.Error("bundle overlaps error", "user_id", userID, "err", err)
+		return nil
+	}
+
+	res := make([]model.BundleOverlap, 0)
+	for _, o := range overlaps {
+		if o.BundleSubscriptionID == id || o.ComponentSubscriptionID == id {
+			res = append(res, o)
+		}
+	}
+	return res
 }
 
 func (h *SubscriptionHandler) get(w http.ResponseWriter, r *http.Request, id int) {
@@ -135,33 +167,17 @@ func (h *SubscriptionHandler) update(w http.ResponseWriter, r *http.Request, id
 		h.respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body"})
 		return
 	}
-	if _, err := uuid.Parse(dto.UserID); err != nil {
-		h.respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid user_id"})
-		return
-	}
-	start, err := parseData(dto.StartDate)
+	sub, err := subscriptionFromDTO(dto)
 	if err != nil {
-		h.respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid start_date"})
+		h.respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
-	var endPtr *time.Time
-	if dto.EndDate != nil && *dto.EndDate != "" {
-		end, err := parseData(*dto.EndDate)
-		if err != nil {
-			h.respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid end_date"})
-			return
-		}
-		endPtr = &end
-	}
-	sub := model.Subscription{
-		ID:          id,
-		ServiceName: dto.ServiceName,
-		Price:       dto.Price,
-		UserID:      dto.UserID,
-		StartDate:   start,
-		EndDate:     endPtr,
+	sub.ID = id
+	err = h.service.Update(r.Context(), id, &sub)
+	if h.respondValidation(w, err) {
+		return
 	}
-	if err := h.service.Update(r.Context(), id, &sub); err != nil {
+	if err != nil {
 		h.log.Error("update error", "id", id, "err", err)
 		h.respondJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
 		return
@@ -180,21 +196,6 @@ func (h *SubscriptionHandler) delete(w http.ResponseWriter, r *http.Request, id
 	h.respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
-func (h *SubscriptionHandler) list(w http.ResponseWriter, r *http.Request) {
-	q := r.URL.Query()
-	userID := q.Get("user_id")
-	serviceName := q.Get("service_name")
-	items, err := h.service.List(r.Context(), userID, serviceName)
-
-	if err != nil {
-		h.log.Error("list error", "err", err)
-		h.respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
-		return
-	}
-
-	h.respondJSON(w, http.StatusOK, items)
-}
-
 func (h *SubscriptionHandler) handleSummary(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		h.respondJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
@@ -203,8 +204,12 @@ func (h *SubscriptionHandler) handleSummary(w http.ResponseWriter, r *http.Reque
 	q := r.URL.Query()
 	fromStr := q.Get("from")
 	toStr := q.Get("to")
-	userID := q.Get("user_id")
-	serviceName := q.Get("service_name")
+	groupBy := q.Get("group_by")
+	attribute, err := parseBool(q.Get("attribute_bundles"))
+	if err != nil {
+		h.respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid attribute_bundles"})
+		return
+	}
 
 	from, err := parseData(fromStr)
 	if err != nil {
@@ -219,7 +224,12 @@ func (h *SubscriptionHandler) handleSummary(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	total, err := h.service.SumTotal(r.Context(), from, to, userID, serviceName)
+	if groupBy != "" {
+		h.groupedSummary(w, r, from, to, filterFromQuery(q), model.Grouping{By: groupBy, AttributeBundles: attribute})
+		return
+	}
+
+	total, err := h.service.SumTotal(r.Context(), from, to, filterFromQuery(q))
 	if err != nil {
 		h.log.Error("summary error", "err", err)
 		h.respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
@@ -228,22 +238,143 @@ func (h *SubscriptionHandler) handleSummary(w http.ResponseWriter, r *http.Reque
 	h.respondJSON(w, http.StatusOK, map[string]int{"total": total})
 }
 
-func parseData(s string) (time.Time, error) {
-	if len(s) != 7 || s[2] != '-' {
-		return time.Time{}, fmt.Errorf("bad format, expected MM-YYYY")
+func (h *SubscriptionHandler) groupedSummary(w http.ResponseWriter, r *http.Request, from, to time.Time, f model.SubscriptionFilter, g model.Grouping) {
+	groups, err := h.service.SumGrouped(r.Context(), from, to, f, g)
+	if err != nil {
+		h.log.Error("summary error", "group_by", g.By, "err", err)
+		respondError(w, err)
+		return
+	}
+
+	total := 0
+	for _, g := range groups {
+		total += g.Total
+	}
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"total":             total,
+		"group_by":          g.By,
+		"attribute_bundles": g.AttributeBundles,
+		"groups":            groups,
+	})
+}
+
+func (h *SubscriptionHandler) handleOverlaps(w http.ResponseWriter, r *http.Request) {
+	h.log.Info("incoming request", "method", r.Method, "path", r.URL.Path)
+	if r.Method != http.MethodGet {
+		h.respondJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
 	}
-	month, err := strconv.Atoi(s[0:2])
-	if err != nil || month < 1 || month > 12 {
-		return time.Time{}, fmt.Errorf("bad month")
+	userID := r.URL.Query().Get("user_id")
+	if userID != "" {
+		if _, err := uuid.Parse(userID); err != nil {
+			h.respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid user_id"})
+			return
+		}
 	}
-	year, err := strconv.Atoi(s[3:7])
-	if err != nil || year < 1900 || year > 3000 {
-		return time.Time{}, fmt.Errorf("bad year")
+
+	overlaps, err := h.service.Overlaps(r.Context(), userID)
+	if err != nil {
+		h.log.Error("overlaps error", "err", err)
+		h.respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+		return
 	}
-	return time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC), nil
+
+	h.respondJSON(w, http.StatusOK, overlaps)
+}
+
+func (h *SubscriptionHandler) handleBundleOverlaps(w http.ResponseWriter, r *http.Request) {
+	h.log.Info("incoming request", "method", r.Method, "path", r.URL.Path)
+	if r.Method != http.MethodGet {
+		h.respondJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	userID := r.URL.Query().Get("user_id")
+	if userID != "" {
+		if _, err := uuid.Parse(userID); err != nil {
+			h.respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid user_id"})
+			return
+		}
+	}
+
+	overlaps, err := h.service.BundleOverlaps(r.Context(), userID)
+	if err != nil {
+		h.log.Error("bundle overlaps error", "err", err)
+		h.respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, overlaps)
+}
+
+// filterFromQuery собирает фильтр подписок из query-параметров списка и сводки
+func filterFromQuery(q url.Values) model.SubscriptionFilter {
+	return model.SubscriptionFilter{
+		UserID:      q.Get("user_id"),
+		ServiceName: q.Get("service_name"),
+		Category:    q.Get("category"),
+		Tag:         q.Get("tag"),
+		Plan:        q.Get("plan"),
+	}
+}
+
+// listFilterFromQuery — фильтр списка подписок: filterFromQuery и период активности active_from/active_to,
+// ошибка — *model.ErrInvalid
+func listFilterFromQuery(q url.Values) (model.SubscriptionFilter, error) {
+	f := filterFromQuery(q)
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"active_from", &f.ActiveFrom}, {"active_to", &f.ActiveTo}} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := parseData(v)
+		if err != nil {
+			return f, &model.ErrInvalid{Msg: "invalid " + p.name}
+		}
+		*p.dst = t
+	}
+	return f, nil
+}
+
+// respondValidation отвечает на ошибки валидации из нижних слоёв: 400 на неизвестный сервис
+// в строгом справочнике (с подсказками) и *model.ErrInvalid, 409 на пересечение подписок
+func (h *SubscriptionHandler) respondValidation(w http.ResponseWriter, err error) bool {
+	var unknown *model.UnknownServiceError
+	if errors.As(err, &unknown) {
+		h.respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error":       "unknown service",
+			"service":     unknown.Name,
+			"suggestions": unknown.Suggestions,
+		})
+		return true
+	}
+
+	var invalid *model.ErrInvalid
+	if errors.As(err, &invalid) {
+		h.respondJSON(w, http.StatusBadRequest, map[string]string{"error": invalid.Msg})
+		return true
+	}
+
+	if errors.Is(err, model.ErrOverlap) {
+		h.respondJSON(w, http.StatusConflict, map[string]string{"error": "subscription overlaps an existing one for the same service"})
+		return true
+	}
+
+	return false
+}
+
+// parseData разбирает месяц в формате MM-YYYY
+func parseData(s string) (time.Time, error) {
+	return subsfile.ParseMonth(s)
 }
 
 func (h *SubscriptionHandler) respondJSON(w http.ResponseWriter, code int, v interface{}) {
+	respondJSON(w, code, v)
+}
+
+func respondJSON(w http.ResponseWriter, code int, v interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
 	_ = json.NewEncoder(w).Encode(v)
@@ -6,16 +6,25 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"subs-collector/internal/logger"
 	"subs-collector/internal/model"
+	"subs-collector/internal/repository"
+	"subs-collector/internal/service"
 )
 
 type fakeService struct {
 	createdID  int
 	createdErr error
+	lastFilter model.SubscriptionFilter
+	overlaps   []model.BundleOverlap
+	lastImport []model.ImportRow
+	listed     []model.Subscription
+	listErr    error
+	lastBatch  []model.BatchOp
 }
 
 func (f *fakeService) Create(_ context.Context, _ *model.Subscription) (int, error) {
@@ -26,12 +35,41 @@ func (f *fakeService) GetByID(_ context.Context, _ int) (*model.Subscription, er
 }
 func (f *fakeService) Update(_ context.Context, _ int, _ *model.Subscription) error { return nil }
 func (f *fakeService) Delete(_ context.Context, _ int) error                        { return nil }
-func (f *fakeService) List(_ context.Context, _ string, _ string) ([]model.Subscription, error) {
+func (f *fakeService) List(_ context.Context, f2 model.SubscriptionFilter) ([]model.Subscription, error) {
+	f.lastFilter = f2
 	return []model.Subscription{}, nil
 }
-func (f *fakeService) SumTotal(_ context.Context, _ time.Time, _ time.Time, _ string, _ string) (int, error) {
+func (f *fakeService) ListEach(_ context.Context, f2 model.SubscriptionFilter, fn func(model.Subscription) error) error {
+	f.lastFilter = f2
+	for _, s := range f.listed {
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return f.listErr
+}
+func (f *fakeService) SumTotal(_ context.Context, _ time.Time, _ time.Time, _ model.SubscriptionFilter) (int, error) {
 	return 0, nil
 }
+func (f *fakeService) SumGrouped(_ context.Context, _ time.Time, _ time.Time, f2 model.SubscriptionFilter, _ model.Grouping) ([]model.SummaryGroup, error) {
+	f.lastFilter = f2
+	video, music := "video", "music"
+	return []model.SummaryGroup{{Key: &video, Total: 300}, {Key: &music, Total: 200}, {Key: nil, Total: 50}}, nil
+}
+func (f *fakeService) Import(_ context.Context, rows []model.ImportRow, mode string, dryRun bool) (*model.ImportReport, error) {
+	f.lastImport = rows
+	return &model.ImportReport{Mode: mode, DryRun: dryRun, Total: len(rows)}, nil
+}
+func (f *fakeService) Batch(_ context.Context, ops []model.BatchOp, continueOnError bool) (*model.BatchReport, error) {
+	f.lastBatch = ops
+	return &model.BatchReport{ContinueOnError: continueOnError, Results: []model.BatchOpResult{}}, nil
+}
+func (f *fakeService) Overlaps(_ context.Context, _ string) ([]model.SubscriptionOverlap, error) {
+	return []model.SubscriptionOverlap{}, nil
+}
+func (f *fakeService) BundleOverlaps(_ context.Context, _ string) ([]model.BundleOverlap, error) {
+	return f.overlaps, nil
+}
 
 func TestCreate_ValidBody(t *testing.T) {
 	l := logger.New()
@@ -55,3 +93,366 @@ func TestCreate_ValidBody(t *testing.T) {
 		t.Fatalf("ожидался 201, получил %d", rec.Code)
 	}
 }
+
+func TestCreate_UnknownServiceInStrictCatalog(t *testing.T) {
+	s := &fakeService{createdErr: &model.UnknownServiceError{Name: "Netflx", Suggestions: []string{"Netflix"}}}
+	h := NewSubscriptionHandler(s, logger.New())
+
+	body := `{"service_name":"Netflx","price":999,"user_id":"00000000-0000-0000-0000-000000000000","start_date":"07-2025"}`
+	req := httptest.NewRequest(http.MethodPost, "/subscriptions", bytes.NewReader([]byte(body)))
+	rec := httptest.NewRecorder()
+
+	h.handleListOrCreate(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("ожидался 400, получил %d", rec.Code)
+	}
+	var resp struct {
+		Suggestions []string `json:"suggestions"`
+	}
+	_ = json.NewDecoder(rec.Body).Decode(&resp)
+	if len(resp.Suggestions) != 1 || resp.Suggestions[0] != "Netflix" {
+		t.Fatalf("неожиданные подсказки %v", resp.Suggestions)
+	}
+}
+
+func TestSummary_GroupByCategory(t *testing.T) {
+	s := &fakeService{}
+	h := NewSubscriptionHandler(s, logger.New())
+
+	req := httptest.NewRequest(http.MethodGet, "/subscriptions/summary?from=01-2025&to=12-2025&group_by=category&tag=family", nil)
+	rec := httptest.NewRecorder()
+	h.handleSummary(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ожидался 200, получил %d", rec.Code)
+	}
+	var resp struct {
+		Total  int                  `json:"total"`
+		Groups []model.SummaryGroup `json:"groups"`
+	}
+	_ = json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.Total != 550 || len(resp.Groups) != 3 || resp.Groups[2].Key != nil {
+		t.Fatalf("неожиданный ответ %+v", resp)
+	}
+	if s.lastFilter.Tag != "family" {
+		t.Fatalf("фильтр tag не передан: %+v", s.lastFilter)
+	}
+}
+
+func TestCreate_WarnsAboutBundleOverlap(t *testing.T) {
+	s := &fakeService{createdID: 7, overlaps: []model.BundleOverlap{
+		{BundleSubscriptionID: 3, ComponentSubscriptionID: 7, BundleService: "Plus", ComponentService: "MusicBox"},
+		{BundleSubscriptionID: 3, ComponentSubscriptionID: 5, BundleService: "Plus", ComponentService: "VideoHub"},
+	}}
+	h := NewSubscriptionHandler(s, logger.New())
+
+	body := `{"service_name":"MusicBox","price":490,"user_id":"00000000-0000-0000-0000-000000000000","start_date":"07-2025"}`
+	req := httptest.NewRequest(http.MethodPost, "/subscriptions", bytes.NewReader([]byte(body)))
+	rec := httptest.NewRecorder()
+	h.handleListOrCreate(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("ожидался 201, получил %d", rec.Code)
+	}
+	var resp struct {
+		ID       int                   `json:"id"`
+		Warnings []model.BundleOverlap `json:"warnings"`
+	}
+	_ = json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.ID != 7 || len(resp.Warnings) != 1 || resp.Warnings[0].ComponentService != "MusicBox" {
+		t.Fatalf("неожиданный ответ %+v", resp)
+	}
+}
+
+func TestCreate_OverlapRejected(t *testing.T) {
+	s := &fakeService{createdErr: model.ErrOverlap}
+	h := NewSubscriptionHandler(s, logger.New())
+
+	body := `{"service_name":"VideoHub","price":990,"user_id":"00000000-0000-0000-0000-000000000000","start_date":"07-2025"}`
+	req := httptest.NewRequest(http.MethodPost, "/subscriptions", bytes.NewReader([]byte(body)))
+	rec := httptest.NewRecorder()
+	h.handleListOrCreate(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("ожидался 409, получил %d", rec.Code)
+	}
+}
+
+func TestList_ActivePeriodFilter(t *testing.T) {
+	s := &fakeService{}
+	h := NewSubscriptionHandler(s, logger.New())
+
+	req := httptest.NewRequest(http.MethodGet, "/subscriptions?active_from=02-2025&active_to=06-2025", nil)
+	rec := httptest.NewRecorder()
+	h.handleListOrCreate(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ожидался 200, получил %d", rec.Code)
+	}
+	if want := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC); !s.lastFilter.ActiveFrom.Equal(want) {
+		t.Errorf("active_from: ожидалось %v, получил %v", want, s.lastFilter.ActiveFrom)
+	}
+	if want := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC); !s.lastFilter.ActiveTo.Equal(want) {
+		t.Errorf("active_to: ожидалось %v, получил %v", want, s.lastFilter.ActiveTo)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/subscriptions?active_to=2025-06", nil)
+	rec = httptest.NewRecorder()
+	h.handleListOrCreate(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("ожидался 400, получил %d", rec.Code)
+	}
+}
+
+func TestImport_CSVWithHeaderMapping(t *testing.T) {
+	s := &fakeService{}
+	h := NewSubscriptionHandler(s, logger.New())
+
+	body := "Сервис,Стоимость,user_id,start_date\n" +
+		"VideoHub,990,00000000-0000-0000-0000-000000000000,07-2025\n" +
+		"MusicBox,abc,00000000-0000-0000-0000-000000000000,07-2025\n" +
+		"MusicBox,100,not-a-uuid,07-2025\n"
+	req := httptest.NewRequest(http.MethodPost, "/subscriptions/import?map=service_name:Сервис&map=price:Стоимость&dry_run=true",
+		strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	rec := httptest.NewRecorder()
+	h.handleImport(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ожидался 200, получил %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(s.lastImport) != 3 {
+		t.Fatalf("ожидалось 3 строки, получил %d", len(s.lastImport))
+	}
+	first := s.lastImport[0]
+	if first.Err != nil || first.Line != 2 || first.Subscription.ServiceName != "VideoHub" || first.Subscription.Price != 990 {
+		t.Errorf("неверно разобрана первая строка: %+v", first)
+	}
+	if s.lastImport[1].Err == nil || s.lastImport[1].Err.Error() != "invalid price" {
+		t.Errorf("ожидалась ошибка цены: %+v", s.lastImport[1])
+	}
+	if s.lastImport[2].Err == nil || s.lastImport[2].Err.Error() != "invalid user_id" {
+		t.Errorf("ожидалась ошибка user_id: %+v", s.lastImport[2])
+	}
+}
+
+func TestImport_CSVMissingColumn(t *testing.T) {
+	h := NewSubscriptionHandler(&fakeService{}, logger.New())
+
+	req := httptest.NewRequest(http.MethodPost, "/subscriptions/import", strings.NewReader("service_name,price\nVideoHub,1\n"))
+	req.Header.Set("Content-Type", "text/csv")
+	rec := httptest.NewRecorder()
+	h.handleImport(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("ожидался 400, получил %d", rec.Code)
+	}
+}
+
+func TestImport_NDJSON(t *testing.T) {
+	s := &fakeService{}
+	h := NewSubscriptionHandler(s, logger.New())
+
+	body := `{"service_name":"VideoHub","price":990,"user_id":"00000000-0000-0000-0000-000000000000","start_date":"07-2025"}` +
+		"\n\n{broken\n"
+	req := httptest.NewRequest(http.MethodPost, "/subscriptions/import?mode=all_or_nothing", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	rec := httptest.NewRecorder()
+	h.handleImport(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ожидался 200, получил %d", rec.Code)
+	}
+	if len(s.lastImport) != 2 || s.lastImport[0].Err != nil || s.lastImport[1].Err == nil || s.lastImport[1].Line != 3 {
+		t.Fatalf("неверно разобраны строки: %+v", s.lastImport)
+	}
+}
+
+func TestExport_CSV(t *testing.T) {
+	plan := "Family"
+	end := time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)
+	s := &fakeService{listed: []model.Subscription{
+		{ID: 1, ServiceName: "VideoHub", Price: 990, UserID: "00000000-0000-0000-0000-000000000000",
+			StartDate: time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: 2, ServiceName: "Music, Box", Plan: &plan, Price: 300, UserID: "00000000-0000-0000-0000-000000000000",
+			StartDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), EndDate: &end},
+	}}
+	h := NewSubscriptionHandler(s, logger.New())
+
+	req := httptest.NewRequest(http.MethodGet, "/subscriptions/export?user_id=00000000-0000-0000-0000-000000000000&active_from=01-2025", nil)
+	rec := httptest.NewRecorder()
+	h.handleExport(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ожидался 200, получил %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Fatalf("неверный Content-Type %q", ct)
+	}
+	want := "id,service_name,plan,price,user_id,start_date,end_date\n" +
+		"1,VideoHub,,990,00000000-0000-0000-0000-000000000000,07-2025,\n" +
+		"2,\"Music, Box\",Family,300,00000000-0000-0000-0000-000000000000,01-2025,12-2025\n"
+	if rec.Body.String() != want {
+		t.Fatalf("неверный CSV:\n%s", rec.Body.String())
+	}
+	if s.lastFilter.ActiveFrom.IsZero() || s.lastFilter.UserID == "" {
+		t.Fatalf("фильтры списка не переданы: %+v", s.lastFilter)
+	}
+}
+
+func TestExport_ErrorBeforeFirstRow(t *testing.T) {
+	s := &fakeService{listErr: context.DeadlineExceeded}
+	h := NewSubscriptionHandler(s, logger.New())
+
+	for _, format := range []string{"ndjson", "pdf"} {
+		rec := httptest.NewRecorder()
+		h.handleExport(rec, httptest.NewRequest(http.MethodGet, "/subscriptions/export?format="+format, nil))
+		want := http.StatusInternalServerError
+		if format == "pdf" {
+			want = http.StatusBadRequest
+		}
+		if rec.Code != want {
+			t.Fatalf("format=%s: ожидался %d, получил %d", format, want, rec.Code)
+		}
+	}
+}
+
+func TestList_StreamsJSONAndNDJSON(t *testing.T) {
+	s := &fakeService{}
+	for i := 1; i <= listFlushEvery+5; i++ {
+		s.listed = append(s.listed, model.Subscription{ID: i, ServiceName: "VideoHub", Price: 990,
+			UserID: "00000000-0000-0000-0000-000000000000", StartDate: time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)})
+	}
+	h := NewSubscriptionHandler(s, logger.New())
+
+	rec := httptest.NewRecorder()
+	h.handleListOrCreate(rec, httptest.NewRequest(http.MethodGet, "/subscriptions", nil))
+	var items []model.Subscription
+	if err := json.Unmarshal(rec.Body.Bytes(), &items); err != nil || len(items) != len(s.listed) || items[4].ID != 5 {
+		t.Fatalf("неверный JSON-массив (%v): %d элементов", err, len(items))
+	}
+	if !rec.Flushed {
+		t.Errorf("ответ не сбрасывался клиенту")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/subscriptions", nil)
+	req.Header.Set("Accept", "application/json;q=0.5, application/x-ndjson")
+	rec = httptest.NewRecorder()
+	h.handleListOrCreate(rec, req)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("неверный Content-Type %q", ct)
+	}
+	lines := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n"), "\n")
+	if len(lines) != len(s.listed) {
+		t.Fatalf("ожидалось %d строк, получил %d", len(s.listed), len(lines))
+	}
+
+	s.listed = nil
+	rec = httptest.NewRecorder()
+	h.handleListOrCreate(rec, httptest.NewRequest(http.MethodGet, "/subscriptions", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "[]\n" {
+		t.Fatalf("пустой список: %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+// failingWriter — клиент, отключившийся после первой записи
+type failingWriter struct {
+	*httptest.ResponseRecorder
+	writes int
+}
+
+func (w *failingWriter) Write(b []byte) (int, error) {
+	if w.writes++; w.writes > 1 {
+		return 0, context.Canceled
+	}
+	return w.ResponseRecorder.Write(b)
+}
+
+func TestList_StopsOnWriteError(t *testing.T) {
+	s := &fakeService{}
+	for i := 1; i <= 10; i++ {
+		s.listed = append(s.listed, model.Subscription{ID: i})
+	}
+	h := NewSubscriptionHandler(s, logger.New())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := &failingWriter{ResponseRecorder: httptest.NewRecorder()}
+	h.handleListOrCreate(w, httptest.NewRequest(http.MethodGet, "/subscriptions", nil).WithContext(ctx))
+
+	if w.writes != 2 {
+		t.Fatalf("чтение не остановлено после ошибки записи: %d записей", w.writes)
+	}
+}
+
+func TestBatch_ParsesOperations(t *testing.T) {
+	s := &fakeService{}
+	h := NewSubscriptionHandler(s, logger.New())
+
+	body := `{"continue_on_error":true,"operations":[
+		{"op":"create","subscription":{"service_name":"VideoHub","price":990,"user_id":"00000000-0000-0000-0000-000000000000","start_date":"07-2025"}},
+		{"op":"update","id":3,"subscription":{"service_name":"VideoHub","user_id":"00000000-0000-0000-0000-000000000000","start_date":"13-2025"}},
+		{"op":"delete","id":4},
+		{"op":"delete"},
+		{"op":"upsert","id":5},
+		"broken"]}`
+	req := httptest.NewRequest(http.MethodPost, "/subscriptions/batch", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.handleBatch(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ожидался 200, получил %d: %s", rec.Code, rec.Body.String())
+	}
+	ops := s.lastBatch
+	if len(ops) != 6 {
+		t.Fatalf("ожидалось 6 операций, получил %d", len(ops))
+	}
+	if ops[0].Err != nil || ops[0].Subscription.Price != 990 || ops[2].Err != nil || ops[2].ID != 4 {
+		t.Fatalf("неверно разобраны корректные операции: %+v", ops)
+	}
+	for _, i := range []int{1, 3, 4, 5} {
+		if ops[i].Err == nil {
+			t.Errorf("операция %d: ожидалась ошибка разбора", i)
+		}
+	}
+}
+
+// TestMemoryStorage — обработчики с настоящим сервисом поверх репозитория в памяти, без Postgres
+func TestMemoryStorage(t *testing.T) {
+	svc := service.NewSubscriptionService(repository.NewMemorySubscriptionRepository(),
+		service.WithOverlapPolicy(model.OverlapReject))
+	mux := http.NewServeMux()
+	NewSubscriptionHandler(svc, logger.New()).Register(mux)
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rec
+	}
+
+	const user = "00000000-0000-0000-0000-000000000001"
+	body := `{"service_name":"VideoHub","price":400,"user_id":"` + user + `","start_date":"01-2025","end_date":"06-2025"}`
+	if rec := do(http.MethodPost, "/subscriptions", body); rec.Code != http.StatusCreated {
+		t.Fatalf("ожидался 201, получил %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPost, "/subscriptions", body); rec.Code != http.StatusConflict {
+		t.Fatalf("пересечение: ожидался 409, получил %d", rec.Code)
+	}
+
+	rec := do(http.MethodGet, "/subscriptions/summary?from=03-2025&to=12-2025&user_id="+user, "")
+	var resp struct {
+		Total int `json:"total"`
+	}
+	_ = json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusOK || resp.Total != 1600 {
+		t.Fatalf("неожиданная сводка %d %+v", rec.Code, resp)
+	}
+
+	rec = do(http.MethodGet, "/subscriptions?service_name=videohub", "")
+	var list []model.Subscription
+	_ = json.NewDecoder(rec.Body).Decode(&list)
+	if len(list) != 1 || list[0].ServiceName != "VideoHub" || list[0].UserID != user {
+		t.Fatalf("неожиданный список %+v", list)
+	}
+}
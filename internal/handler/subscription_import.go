@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"subs-collector/internal/model"
+	"subs-collector/internal/subsfile"
+)
+
+// importMaxBody — наибольший размер тела POST /subscriptions/import
+const importMaxBody = 32 << 20
+
+// handleImport принимает CSV (text/csv) или NDJSON (application/x-ndjson), формат можно задать и параметром
+// format. Колонки CSV по умолчанию называются как поля JSON, map=поле:Заголовок задаёт другое имя.
+// Каждая строка проверяется как тело POST /subscriptions, ответ — отчёт по строкам.
+func (h *SubscriptionHandler) handleImport(w http.ResponseWriter, r *http.Request) {
+	h.log.Info("incoming request", "method", r.Method, "path", r.URL.Path)
+	if r.Method != http.MethodPost {
+		h.respondJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	q := r.URL.Query()
+	dryRun, err := parseBool(q.Get("dry_run"))
+	if err != nil {
+		h.respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid dry_run"})
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, importMaxBody)
+	var rows []model.ImportRow
+	switch importFormat(r) {
+	case "csv":
+		rows, err = parseCSVImport(body, q["map"])
+	case "ndjson":
+		rows, err = parseNDJSONImport(body)
+	default:
+		h.respondJSON(w, http.StatusUnsupportedMediaType, map[string]string{"error": "expected text/csv or application/x-ndjson"})
+		return
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		h.respondJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "body too large"})
+		return
+	}
+	if err != nil {
+		h.respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	report, err := h.service.Import(r.Context(), rows, q.Get("mode"), dryRun)
+	if err != nil {
+		h.log.Error("import error", "err", err)
+		respondError(w, err)
+		return
+	}
+	h.log.Info("import finished", "mode", report.Mode, "dry_run", report.DryRun, "total", report.Total,
+		"failed", report.Failed, "committed", report.Committed)
+
+	h.respondJSON(w, http.StatusOK, report)
+}
+
+// importFormat — формат тела импорта: параметр format или Content-Type
+func importFormat(r *http.Request) string {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return f
+	}
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mt {
+	case "text/csv":
+		return "csv"
+	case "application/x-ndjson", "application/jsonl", "application/json":
+		return "ndjson"
+	}
+	return ""
+}
+
+// parseCSVImport разбирает CSV с заголовком. mapping — пары "поле:Заголовок" для колонок с другими именами.
+// Ошибки строк попадают в ImportRow.Err, ошибка формата файла возвращается как *model.ErrInvalid.
+func parseCSVImport(body io.Reader, mapping []string) ([]model.ImportRow, error) {
+	rd, err := subsfile.NewCSVReader(body, mapping)
+	if err != nil {
+		return nil, err
+	}
+	return subsfile.ReadAll(rd)
+}
+
+// parseNDJSONImport разбирает по объекту subscriptionDTO на строку, пустые строки пропускаются
+func parseNDJSONImport(body io.Reader) ([]model.ImportRow, error) {
+	return subsfile.ReadAll(subsfile.NewNDJSONReader(body))
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+
+	"subs-collector/internal/model"
+)
+
+// listFlushEvery — через сколько подписок ответ списка сбрасывается клиенту
+const listFlushEvery = 100
+
+// list отдаёт подписки потоком по мере чтения из БД: JSON-массив или, при Accept: application/x-ndjson,
+// по объекту на строку. Заголовки отправляются с первой подпиской, поэтому ошибка до неё — обычный
+// ответ 500, а после — обрыв ответа. Отключение клиента отменяет контекст запроса и вместе с ним запрос к БД.
+func (h *SubscriptionHandler) list(w http.ResponseWriter, r *http.Request) {
+	f, err := listFilterFromQuery(r.URL.Query())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	ndjson := acceptsNDJSON(r)
+	rc := http.NewResponseController(w)
+	started := false
+	start := func() error {
+		started = true
+		if ndjson {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+			return nil
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte("["))
+		return err
+	}
+
+	rows := 0
+	err = h.service.ListEach(r.Context(), f, func(s model.Subscription) error {
+		sep := ","
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+			sep = ""
+		}
+		b, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		if ndjson {
+			b = append(b, '\n')
+		} else {
+			b = append([]byte(sep), b...)
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+		if rows++; rows%listFlushEvery == 0 {
+			if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+				return err
+			}
+		}
+		return nil
+	})
+
+	switch {
+	case err != nil && !started:
+		h.log.Error("list error", "err", err)
+		h.respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+		return
+	case err != nil && r.Context().Err() != nil:
+		h.log.Info("list cancelled by client", "rows", rows)
+		return
+	case err != nil:
+		h.log.Error("list interrupted", "rows", rows, "err", err)
+		return
+	}
+
+	if !started {
+		if err := start(); err != nil {
+			return
+		}
+	}
+	if !ndjson {
+		_, _ = w.Write([]byte("]\n"))
+	}
+}
+
+// acceptsNDJSON — клиент просит NDJSON в заголовке Accept
+func acceptsNDJSON(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mt, _, err := mime.ParseMediaType(strings.TrimSpace(part)); err == nil && mt == "application/x-ndjson" {
+			return true
+		}
+	}
+	return false
+}
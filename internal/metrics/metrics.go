@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter — монотонно растущий счётчик
+type Counter struct {
+	v atomic.Int64
+}
+
+func (c *Counter) Inc() { c.v.Add(1) }
+
+func (c *Counter) Add(n int64) { c.v.Add(n) }
+
+func (c *Counter) Value() int64 { return c.v.Load() }
+
+// Registry — именованные счётчики процесса. Имя может содержать метки в формате Prometheus:
+// requests_total{method="Create"}. Отдаётся как текст Prometheus через ServeHTTP.
+type Registry struct {
+	mu       sync.Mutex
+	counters map[string]*Counter
+}
+
+func NewRegistry() *Registry {
+	return &Registry{counters: make(map[string]*Counter)}
+}
+
+// Counter возвращает счётчик с именем name, создавая его при первом обращении
+func (r *Registry) Counter(name string) *Counter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.counters[name]
+	if !ok {
+		c = &Counter{}
+		r.counters[name] = c
+	}
+	return c
+}
+
+// Snapshot возвращает текущие значения всех счётчиков
+func (r *Registry) Snapshot() map[string]int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := make(map[string]int64, len(r.counters))
+	for name, c := range r.counters {
+		res[name] = c.Value()
+	}
+	return res
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	snap := r.Snapshot()
+	names := make([]string, 0, len(snap))
+	for name := range snap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, name := range names {
+		_, _ = fmt.Fprintf(w, "%s %d\n", name, snap[name])
+	}
+}
@@ -0,0 +1,22 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("b_total").Add(2)
+	r.Counter(`a_total{method="Create"}`).Inc()
+	r.Counter(`a_total{method="Create"}`).Inc()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	want := "a_total{method=\"Create\"} 2\nb_total 2\n"
+	if rec.Body.String() != want {
+		t.Fatalf("ожидалось %q, получил %q", want, rec.Body.String())
+	}
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// BundleComponent — сервис, входящий в пакет, Share — его доля при распределении цены пакета
+type BundleComponent struct {
+	ServiceID int    `json:"service_id"`
+	Name      string `json:"name,omitempty"`
+	Share     int    `json:"share"`
+}
+
+// BundleOverlap — у пользователя одновременно активны подписка на пакет и на входящий в него сервис.
+// To == nil, если обе подписки бессрочные.
+type BundleOverlap struct {
+	UserID                  string     `json:"user_id"`
+	BundleSubscriptionID    int        `json:"bundle_subscription_id"`
+	BundleService           string     `json:"bundle_service"`
+	ComponentSubscriptionID int        `json:"component_subscription_id"`
+	ComponentService        string     `json:"component_service"`
+	From                    time.Time  `json:"from"`
+	To                      *time.Time `json:"to,omitempty"`
+}
@@ -0,0 +1,85 @@
+package model
+
+import "reflect"
+
+// RegionalPrice — типичная цена сервиса в регионе, в минимальных единицах валюты
+type RegionalPrice struct {
+	Region     string `json:"region"`
+	Currency   string `json:"currency"`
+	PriceMinor int    `json:"price_minor"`
+}
+
+// CatalogFields — поля сервиса, которыми управляет встроенный каталог
+type CatalogFields struct {
+	Category        *string         `json:"category"`
+	Website         *string         `json:"website"`
+	CancellationURL *string         `json:"cancellation_url"`
+	LogoURL         *string         `json:"logo_url"`
+	Prices          []RegionalPrice `json:"prices"`
+}
+
+// CatalogEntry — запись встроенного каталога известных сервисов
+type CatalogEntry struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+	CatalogFields
+}
+
+// Действия импорта каталога над сервисом
+const (
+	ImportCreated   = "created"
+	ImportUpdated   = "updated"
+	ImportUnchanged = "unchanged"
+)
+
+// ImportResult — что импорт каталога сделал с сервисом; Kept — поля с локальными правками
+type ImportResult struct {
+	Name      string   `json:"name"`
+	ServiceID int      `json:"service_id"`
+	Action    string   `json:"action"`
+	Kept      []string `json:"kept,omitempty"`
+}
+
+// MergeCatalogFields накладывает incoming на current. Поле обновляется, только если оно пустое
+// или совпадает со снимком прошлого импорта (snapshot == nil — импорта не было, совпадает только пустое).
+// Возвращает итоговые значения и имена полей, сохранённых из-за локальных правок.
+func MergeCatalogFields(current CatalogFields, snapshot *CatalogFields, incoming CatalogFields) (CatalogFields, []string) {
+	var prev CatalogFields
+	if snapshot != nil {
+		prev = *snapshot
+	}
+
+	var kept []string
+	mergeStr := func(name string, cur, old, in *string) *string {
+		if cur == nil || (old != nil && *cur == *old) {
+			return in
+		}
+		if in == nil || *cur != *in {
+			kept = append(kept, name)
+		}
+		return cur
+	}
+
+	res := CatalogFields{
+		Category:        mergeStr("category", current.Category, prev.Category, incoming.Category),
+		Website:         mergeStr("website", current.Website, prev.Website, incoming.Website),
+		CancellationURL: mergeStr("cancellation_url", current.CancellationURL, prev.CancellationURL, incoming.CancellationURL),
+		LogoURL:         mergeStr("logo_url", current.LogoURL, prev.LogoURL, incoming.LogoURL),
+		Prices:          incoming.Prices,
+	}
+	if len(current.Prices) > 0 && !samePrices(current.Prices, prev.Prices) {
+		res.Prices = current.Prices
+		if !samePrices(current.Prices, incoming.Prices) {
+			kept = append(kept, "prices")
+		}
+	}
+
+	return res, kept
+}
+
+func samePrices(a, b []RegionalPrice) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestMergeCatalogFields_FillsEmptyAndFollowsCatalog(t *testing.T) {
+	snapshot := &CatalogFields{Website: strPtr("https://old.example")}
+	current := CatalogFields{Website: strPtr("https://old.example")}
+	incoming := CatalogFields{
+		Category: strPtr("video"),
+		Website:  strPtr("https://new.example"),
+		Prices:   []RegionalPrice{{Region: "US", Currency: "USD", PriceMinor: 999}},
+	}
+
+	res, kept := MergeCatalogFields(current, snapshot, incoming)
+	if !reflect.DeepEqual(res, incoming) {
+		t.Errorf("expected catalog values, got %+v", res)
+	}
+	if len(kept) != 0 {
+		t.Errorf("expected nothing kept, got %v", kept)
+	}
+}
+
+func TestMergeCatalogFields_KeepsLocalEdits(t *testing.T) {
+	snapshot := &CatalogFields{
+		Category: strPtr("video"),
+		Prices:   []RegionalPrice{{Region: "US", Currency: "USD", PriceMinor: 999}},
+	}
+	current := CatalogFields{
+		Category: strPtr("movies"),
+		Prices:   []RegionalPrice{{Region: "RU", Currency: "RUB", PriceMinor: 29900}},
+	}
+	incoming := CatalogFields{
+		Category: strPtr("video"),
+		Prices:   []RegionalPrice{{Region: "US", Currency: "USD", PriceMinor: 1099}},
+	}
+
+	res, kept := MergeCatalogFields(current, snapshot, incoming)
+	if *res.Category != "movies" || res.Prices[0].Region != "RU" {
+		t.Errorf("local edits overwritten: %+v", res)
+	}
+	if !reflect.DeepEqual(kept, []string{"category", "prices"}) {
+		t.Errorf("unexpected kept fields %v", kept)
+	}
+}
+
+func TestMergeCatalogFields_NoSnapshotKeepsExisting(t *testing.T) {
+	current := CatalogFields{Website: strPtr("https://intranet.example")}
+	res, kept := MergeCatalogFields(current, nil, CatalogFields{Website: strPtr("https://public.example")})
+	if *res.Website != "https://intranet.example" || len(kept) != 1 {
+		t.Errorf("expected existing website kept, got %+v %v", res, kept)
+	}
+}
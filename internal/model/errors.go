@@ -0,0 +1,29 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound — запись не найдена
+var ErrNotFound = errors.New("not found")
+
+// ErrInvalid — некорректные входные данные, сообщение возвращается клиенту как есть
+type ErrInvalid struct {
+	Msg string
+}
+
+func (e *ErrInvalid) Error() string { return e.Msg }
+
+// UnknownServiceError — сервиса нет в справочнике, а автосоздание запрещено
+type UnknownServiceError struct {
+	Name        string
+	Suggestions []string
+}
+
+func (e *UnknownServiceError) Error() string {
+	return fmt.Sprintf("unknown service %q", e.Name)
+}
+
+// ErrOverlap — подписка пересекается с другой подпиской пользователя на тот же сервис
+var ErrOverlap = errors.New("overlapping subscription")
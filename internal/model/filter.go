@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// SubscriptionFilter — условия отбора подписок для списка и сводок, пустые поля не фильтруют.
+// ActiveFrom/ActiveTo оставляют подписки, активные хотя бы в одном месяце периода (границы включительно).
+type SubscriptionFilter struct {
+	UserID      string
+	ServiceName string
+	Category    string
+	Tag         string
+	Plan        string
+	ActiveFrom  time.Time
+	ActiveTo    time.Time
+}
+
+// Поддерживаемые группировки сводки
+const (
+	GroupByService  = "service"
+	GroupByCategory = "category"
+	GroupByPlan     = "plan"
+)
+
+// Grouping — параметры разбивки сводки. AttributeBundles распределяет цену пакета
+// между входящими в него сервисами пропорционально долям.
+type Grouping struct {
+	By               string
+	AttributeBundles bool
+}
+
+// SummaryGroup — сумма по одной группе сводки, Key == nil для подписок без значения группы
+type SummaryGroup struct {
+	Key   *string `json:"key"`
+	Total int     `json:"total"`
+}
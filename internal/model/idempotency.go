@@ -0,0 +1,10 @@
+package model
+
+// StoredResponse — сохранённый ответ на запрос с Idempotency-Key.
+// Fingerprint — отпечаток исходного запроса, Status 0 — запрос ещё выполняется.
+type StoredResponse struct {
+	Fingerprint string
+	Status      int
+	ContentType string
+	Body        []byte
+}
@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// Политики обработки пересекающихся подписок одного пользователя на один сервис
+const (
+	OverlapReject = "reject"
+	OverlapWarn   = "warn"
+)
+
+// SubscriptionOverlap — две подписки пользователя на один сервис активны в одни и те же месяцы.
+// To == nil, если обе подписки бессрочные.
+type SubscriptionOverlap struct {
+	UserID         string     `json:"user_id"`
+	ServiceName    string     `json:"service_name"`
+	SubscriptionID int        `json:"subscription_id"`
+	OtherID        int        `json:"other_id"`
+	From           time.Time  `json:"from"`
+	To             *time.Time `json:"to,omitempty"`
+}
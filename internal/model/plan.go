@@ -0,0 +1,28 @@
+package model
+
+// Периоды оплаты тарифа
+const (
+	BillingMonthly = "month"
+	BillingYearly  = "year"
+)
+
+// DefaultCurrency — валюта тарифа, если она не указана
+const DefaultCurrency = "RUB"
+
+// Plan — тариф сервиса с прайсовой ценой за период оплаты
+type Plan struct {
+	ID            int    `json:"id" db:"id"`
+	ServiceID     int    `json:"service_id" db:"service_id"`
+	Name          string `json:"name" db:"name"`
+	Price         int    `json:"price" db:"price"`
+	BillingPeriod string `json:"billing_period" db:"billing_period"`
+	Currency      string `json:"currency" db:"currency"`
+}
+
+// MonthlyPrice — цена тарифа в пересчёте на месяц, годовая цена делится на 12 с округлением
+func (p Plan) MonthlyPrice() int {
+	if p.BillingPeriod == BillingYearly {
+		return (p.Price + 6) / 12
+	}
+	return p.Price
+}
@@ -0,0 +1,12 @@
+package model
+
+import "testing"
+
+func TestPlanMonthlyPrice(t *testing.T) {
+	if p := (Plan{Price: 999, BillingPeriod: BillingMonthly}).MonthlyPrice(); p != 999 {
+		t.Errorf("monthly plan: expected 999, got %d", p)
+	}
+	if p := (Plan{Price: 9990, BillingPeriod: BillingYearly}).MonthlyPrice(); p != 833 {
+		t.Errorf("yearly plan: expected 833, got %d", p)
+	}
+}
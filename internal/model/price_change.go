@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+// PriceChange — цена подписки, действующая с первого числа EffectiveMonth
+type PriceChange struct {
+	EffectiveMonth time.Time `json:"effective_month"`
+	Price          int       `json:"price"`
+}
+
+// ServicePriceChange — изменение цены сервиса для всех активных подписок, Plan и Currency сужают выборку
+type ServicePriceChange struct {
+	ServiceID      int
+	EffectiveMonth time.Time
+	Price          int
+	Plan           string
+	Currency       string
+}
+
+// PriceChangeItem — подписка, затронутая изменением цены
+type PriceChangeItem struct {
+	SubscriptionID int    `json:"subscription_id"`
+	UserID         string `json:"user_id"`
+	OldPrice       int    `json:"old_price"`
+	NewPrice       int    `json:"new_price"`
+	Delta          int    `json:"delta"`
+}
+
+// PriceChangeResult — итог (или прогноз при DryRun) изменения цены сервиса
+type PriceChangeResult struct {
+	ServiceID      int               `json:"service_id"`
+	EffectiveMonth time.Time         `json:"effective_month"`
+	Price          int               `json:"price"`
+	Affected       []PriceChangeItem `json:"affected"`
+	MonthlyDelta   int               `json:"monthly_delta"`
+	DryRun         bool              `json:"dry_run"`
+}
@@ -0,0 +1,61 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Service — запись справочника сервисов, Components непуст у пакетов.
+// CatalogFields (категория, сайт, ссылки, цены по регионам) может заполнять встроенный каталог.
+type Service struct {
+	ID             int               `json:"id" db:"id"`
+	Name           string            `json:"name" db:"name"`
+	NormalizedName string            `json:"-" db:"normalized_name"`
+	Aliases        []string          `json:"aliases,omitempty" db:"-"`
+	Tags           []string          `json:"tags" db:"-"`
+	Components     []BundleComponent `json:"components,omitempty" db:"-"`
+	CatalogFields
+	CatalogVersion *int      `json:"catalog_version,omitempty" db:"catalog_version"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+// DuplicateGroup — набор сервисов с одинаковым нормализованным именем
+type DuplicateGroup struct {
+	NormalizedName string    `json:"normalized_name"`
+	Canonical      Service   `json:"canonical"`
+	Duplicates     []Service `json:"duplicates"`
+}
+
+// CleanServiceName убирает пробелы по краям и схлопывает внутренние пробелы — так имя хранится для отображения
+func CleanServiceName(name string) string {
+	return strings.Join(strings.Fields(norm.NFC.String(name)), " ")
+}
+
+// NormalizeLabel приводит категорию или тег к каноническому виду — так же, как имя сервиса
+func NormalizeLabel(label string) string {
+	return NormalizeServiceName(label)
+}
+
+// NormalizeServiceName возвращает ключ сравнения имён: очищенное имя после Unicode case-fold
+func NormalizeServiceName(name string) string {
+	// Caser хранит состояние, поэтому создаётся на каждый вызов
+	return cases.Fold().String(CleanServiceName(name))
+}
+
+// MergeResult — итог (или прогноз при DryRun) слияния сервиса source в target. OverlapsAllowed — подписки
+// source, помеченные allow_overlap из-за пересечения с подписками того же пользователя на target.
+type MergeResult struct {
+	SourceID           int    `json:"source_id"`
+	SourceName         string `json:"source_name"`
+	TargetID           int    `json:"target_id"`
+	TargetName         string `json:"target_name"`
+	MovedSubscriptions int    `json:"moved_subscriptions"`
+	OverlapsAllowed    int    `json:"overlaps_allowed"`
+	MovedAliases       int    `json:"moved_aliases"`
+	MovedPlans         int    `json:"moved_plans"`
+	AliasAdded         bool   `json:"alias_added"`
+	DryRun             bool   `json:"dry_run"`
+}
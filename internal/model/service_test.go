@@ -0,0 +1,24 @@
+package model
+
+import "testing"
+
+func TestNormalizeServiceName(t *testing.T) {
+	cases := map[string]string{
+		"  YouTube   Premium ": "youtube premium",
+		"Youtube\tpremium":     "youtube premium",
+		"STRASSE":              "strasse",
+		"Straße":               "strasse",
+		"":                     "",
+	}
+	for in, want := range cases {
+		if got := NormalizeServiceName(in); got != want {
+			t.Errorf("NormalizeServiceName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCleanServiceName_KeepsCase(t *testing.T) {
+	if got := CleanServiceName("  YouTube \n Premium"); got != "YouTube Premium" {
+		t.Errorf("unexpected clean name %q", got)
+	}
+}
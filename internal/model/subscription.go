@@ -5,8 +5,13 @@ import "time"
 type Subscription struct {
 	ID          int        `json:"id" db:"id"`
 	ServiceName string     `json:"service_name" db:"service_name"`
+	Plan        *string    `json:"plan,omitempty" db:"plan"`
 	Price       int        `json:"price" db:"price"`
 	UserID      string     `json:"user_id" db:"user_id"`
 	StartDate   time.Time  `json:"start_date" db:"start_date"`
 	EndDate     *time.Time `json:"end_date,omitempty" db:"end_date"`
+	// PriceChanges — история цены после Price, заполняется только при чтении по id
+	PriceChanges []PriceChange `json:"price_changes,omitempty" db:"-"`
+	// AllowOverlap исключает подписку из проверки пересечений (принята с предупреждением)
+	AllowOverlap bool `json:"-" db:"allow_overlap"`
 }
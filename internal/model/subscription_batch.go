@@ -0,0 +1,56 @@
+package model
+
+// Операции пакетной записи подписок
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+)
+
+// BatchMaxOps — наибольшее число операций в одном пакете
+const BatchMaxOps = 500
+
+// Статусы операции в отчёте о пакете
+const (
+	BatchOpOK         = "ok"
+	BatchOpFailed     = "failed"
+	BatchOpRolledBack = "rolled_back" // операция выполнена, но пакет отменён
+	BatchOpSkipped    = "skipped"     // операция не выполнялась: пакет отменён раньше неё
+)
+
+// BatchOp — операция пакета: Subscription для create и update, ID для update и delete.
+// Err — ошибка разбора или проверки полей операции.
+type BatchOp struct {
+	Op           string
+	ID           int
+	Subscription Subscription
+	Err          error
+}
+
+// BatchOptions — параметры записи пакета. ContinueOnError откатывает только неудавшиеся операции,
+// иначе первая ошибка отменяет весь пакет. RetryOverlap — как в ImportOptions.
+type BatchOptions struct {
+	ContinueOnError bool
+	RetryOverlap    bool
+}
+
+// BatchOpResult — итог операции пакета, Err — исходная ошибка для сервисного слоя
+type BatchOpResult struct {
+	Index       int      `json:"index"`
+	Op          string   `json:"op"`
+	Status      string   `json:"status"`
+	ID          int      `json:"id,omitempty"`
+	Overlap     bool     `json:"overlap,omitempty"`
+	Error       string   `json:"error,omitempty"`
+	Suggestions []string `json:"suggestions,omitempty"`
+	Err         error    `json:"-"`
+}
+
+// BatchReport — отчёт о пакете операций; Committed — изменения сохранены в БД
+type BatchReport struct {
+	ContinueOnError bool            `json:"continue_on_error"`
+	Committed       bool            `json:"committed"`
+	Succeeded       int             `json:"succeeded"`
+	Failed          int             `json:"failed"`
+	Results         []BatchOpResult `json:"results"`
+}
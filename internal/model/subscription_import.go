@@ -0,0 +1,78 @@
+package model
+
+// Режимы импорта подписок: per_row сохраняет корректные строки, all_or_nothing — все строки или ни одной
+const (
+	ImportPerRow       = "per_row"
+	ImportAllOrNothing = "all_or_nothing"
+)
+
+// Статусы строки в отчёте об импорте подписок
+const (
+	ImportRowCreated    = "created"
+	ImportRowValid      = "valid"       // dry_run: строка была бы сохранена
+	ImportRowFailed     = "failed"      // строка не прошла валидацию или запись
+	ImportRowRolledBack = "rolled_back" // строка корректна, но импорт all_or_nothing отменён
+)
+
+// ImportRow — разобранная строка входного файла, Err — ошибка разбора или проверки полей
+type ImportRow struct {
+	Line         int
+	Subscription Subscription
+	Err          error
+}
+
+// ImportOptions — параметры записи импортируемых подписок.
+// RetryOverlap повторяет пересекающуюся строку с AllowOverlap, как Create при OVERLAP_POLICY=warn.
+type ImportOptions struct {
+	AllOrNothing bool
+	DryRun       bool
+	RetryOverlap bool
+}
+
+// ImportRowResult — итог одной строки импорта, Err — исходная ошибка для сервисного слоя
+type ImportRowResult struct {
+	Line        int      `json:"line"`
+	Status      string   `json:"status"`
+	ID          int      `json:"id,omitempty"`
+	Overlap     bool     `json:"overlap,omitempty"`
+	Error       string   `json:"error,omitempty"`
+	Suggestions []string `json:"suggestions,omitempty"`
+	Err         error    `json:"-"`
+}
+
+// ImportReport — отчёт об импорте подписок; Committed — записи сохранены в БД
+type ImportReport struct {
+	Mode      string            `json:"mode"`
+	DryRun    bool              `json:"dry_run"`
+	Committed bool              `json:"committed"`
+	Total     int               `json:"total"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Rows      []ImportRowResult `json:"rows"`
+}
+
+// BulkLoadOptions — параметры массовой загрузки подписок (`admin bulk-load`), RetryOverlap — как в ImportOptions
+type BulkLoadOptions struct {
+	DryRun       bool
+	RetryOverlap bool
+}
+
+// BulkLoadError — строка массовой загрузки, не прошедшая разбор или проверку
+type BulkLoadError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// BulkLoadResult — итог массовой загрузки; Errors содержит не больше BulkLoadMaxErrors первых ошибок
+type BulkLoadResult struct {
+	Rows            int             `json:"rows"`
+	Inserted        int             `json:"inserted"`
+	CreatedServices int             `json:"created_services"`
+	Overlapping     int             `json:"overlapping"`
+	Rejected        int             `json:"rejected"`
+	Errors          []BulkLoadError `json:"errors,omitempty"`
+	Committed       bool            `json:"committed"`
+}
+
+// BulkLoadMaxErrors — наибольшее число ошибок строк в BulkLoadResult
+const BulkLoadMaxErrors = 100
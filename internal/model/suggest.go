@@ -0,0 +1,73 @@
+package model
+
+import "sort"
+
+const maxSuggestions = 3
+
+// SuggestServiceNames подбирает похожие имена сервисов по расстоянию Левенштейна
+// между нормализованными именами. Порог — треть длины имени, но не меньше 2.
+func SuggestServiceNames(name string, services []Service) []string {
+	target := []rune(NormalizeServiceName(name))
+	limit := len(target) / 3
+	if limit < 2 {
+		limit = 2
+	}
+
+	type candidate struct {
+		name string
+		dist int
+	}
+	best := make(map[string]int)
+	consider := func(display, normalized string) {
+		d := levenshtein(target, []rune(normalized))
+		if d > limit {
+			return
+		}
+		if prev, ok := best[display]; !ok || d < prev {
+			best[display] = d
+		}
+	}
+	for _, sv := range services {
+		consider(sv.Name, NormalizeServiceName(sv.Name))
+		for _, alias := range sv.Aliases {
+			consider(sv.Name, NormalizeServiceName(alias))
+		}
+	}
+
+	list := make([]candidate, 0, len(best))
+	for n, d := range best {
+		list = append(list, candidate{name: n, dist: d})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].dist != list[j].dist {
+			return list[i].dist < list[j].dist
+		}
+		return list[i].name < list[j].name
+	})
+
+	res := make([]string, 0, maxSuggestions)
+	for i := 0; i < len(list) && i < maxSuggestions; i++ {
+		res = append(res, list[i].name)
+	}
+	return res
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
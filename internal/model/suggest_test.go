@@ -0,0 +1,33 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSuggestServiceNames(t *testing.T) {
+	services := []Service{
+		{ID: 1, Name: "VideoHub"},
+		{ID: 2, Name: "MusicBox", Aliases: []string{"Music Box Premium"}},
+		{ID: 3, Name: "EduStream"},
+	}
+
+	if got := SuggestServiceNames("videohab", services); !reflect.DeepEqual(got, []string{"VideoHub"}) {
+		t.Errorf("unexpected suggestions %v", got)
+	}
+	if got := SuggestServiceNames("music box premum", services); !reflect.DeepEqual(got, []string{"MusicBox"}) {
+		t.Errorf("alias should suggest canonical name, got %v", got)
+	}
+	if got := SuggestServiceNames("Completely different", services); len(got) != 0 {
+		t.Errorf("expected no suggestions, got %v", got)
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	if d := levenshtein([]rune("kitten"), []rune("sitting")); d != 3 {
+		t.Errorf("expected 3, got %d", d)
+	}
+	if d := levenshtein([]rune(""), []rune("abc")); d != 3 {
+		t.Errorf("expected 3, got %d", d)
+	}
+}
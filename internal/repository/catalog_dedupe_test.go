@@ -0,0 +1,69 @@
+package repository_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"subs-collector/internal/model"
+	"subs-collector/internal/repository"
+	"subs-collector/internal/service"
+)
+
+// TestDeduplicate_CaseFoldCollision — сервисы, которые миграция 002 разнесла по разным lower()-именам, а case-fold
+// сводит к одному («Straße» и «STRASSE»), сливаются без нарушения уникального индекса миграции 003
+func TestDeduplicate_CaseFoldCollision(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL не задан")
+	}
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, url)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	suffix := " " + uuid.NewString()[:8]
+	older, newer := "Straße"+suffix, "STRASSE"+suffix
+	normalized := model.NormalizeServiceName(older)
+	user := uuid.NewString()
+	t.Cleanup(func() {
+		_, _ = pool.Exec(ctx, `DELETE FROM user_subscriptions WHERE user_id=$1`, user)
+		_, _ = pool.Exec(ctx, `DELETE FROM service_aliases WHERE alias ILIKE $1`, "%"+suffix)
+		_, _ = pool.Exec(ctx, `DELETE FROM services WHERE name IN ($1, $2)`, older, newer)
+	})
+
+	// нормализованные имена — как после миграции 002
+	const seed = `INSERT INTO services (name, normalized_name) VALUES ($1, lower($1)) RETURNING id`
+	var olderID, newerID int
+	require.NoError(t, pool.QueryRow(ctx, seed, older).Scan(&olderID))
+	require.NoError(t, pool.QueryRow(ctx, seed, newer).Scan(&newerID))
+	_, err = pool.Exec(ctx, `INSERT INTO user_subscriptions (service_id, price, user_id, start_date) VALUES ($1, 100, $2, '2025-01-01')`,
+		newerID, user)
+	require.NoError(t, err)
+
+	groups, err := service.NewCatalogService(repository.NewCatalogRepository(pool)).Deduplicate(ctx, true)
+	require.NoError(t, err)
+	var found bool
+	for _, g := range groups {
+		if g.NormalizedName == normalized {
+			found = true
+			assert.Equal(t, olderID, g.Canonical.ID)
+		}
+	}
+	assert.True(t, found, "группа %q", normalized)
+
+	var stored string
+	require.NoError(t, pool.QueryRow(ctx, `SELECT normalized_name FROM services WHERE id=$1`, olderID).Scan(&stored))
+	assert.Equal(t, normalized, stored)
+	var left, moved int
+	require.NoError(t, pool.QueryRow(ctx, `SELECT count(*) FROM services WHERE id=$1`, newerID).Scan(&left))
+	assert.Zero(t, left, "дубликат слит")
+	require.NoError(t, pool.QueryRow(ctx, `SELECT count(*) FROM user_subscriptions WHERE user_id=$1 AND service_id=$2`,
+		user, olderID).Scan(&moved))
+	assert.Equal(t, 1, moved)
+}
@@ -0,0 +1,668 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"subs-collector/internal/model"
+)
+
+type CatalogRepository interface {
+	ListServices(ctx context.Context) ([]model.Service, error)
+	GetService(ctx context.Context, id int) (*model.Service, error)
+	SetLabels(ctx context.Context, id int, category *string, tags []string) error
+	SetComponents(ctx context.Context, bundleID int, components []model.BundleComponent) error
+	ListPlans(ctx context.Context, serviceID int) ([]model.Plan, error)
+	CreatePlan(ctx context.Context, p *model.Plan) (int, error)
+	ImportCatalogEntry(ctx context.Context, e model.CatalogEntry, version int, dryRun bool) (*model.ImportResult, error)
+	ApplyPriceChange(ctx context.Context, c model.ServicePriceChange, dryRun bool) (*model.PriceChangeResult, error)
+	SetNormalizedName(ctx context.Context, id int, normalized string) error
+	AddAlias(ctx context.Context, serviceID int, alias string) error
+	MergeServices(ctx context.Context, sourceID, targetID int, dryRun bool) (*model.MergeResult, error)
+}
+
+type catalogRepository struct {
+	pool     *pgxpool.Pool
+	services *ServiceCache
+}
+
+// CatalogOption — необязательная настройка репозитория справочника
+type CatalogOption func(*catalogRepository)
+
+// WithCatalogServiceCache — кэш id сервисов, который сбрасывается при изменении имён, алиасов и слиянии сервисов
+func WithCatalogServiceCache(c *ServiceCache) CatalogOption {
+	return func(r *catalogRepository) { r.services = c }
+}
+
+func NewCatalogRepository(pool *pgxpool.Pool, opts ...CatalogOption) CatalogRepository {
+	r := &catalogRepository{pool: pool}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// ListServices возвращает все сервисы справочника вместе с их алиасами, по возрастанию id
+func (r *catalogRepository) ListServices(ctx context.Context) ([]model.Service, error) {
+	return listServices(ctx, r.pool)
+}
+
+// serviceSelect — выборка сервиса вместе с алиасами, тегами и ценами по регионам, алиас таблицы sv
+const serviceSelect = `SELECT sv.id, sv.name, COALESCE(sv.normalized_name, ''), sv.category,
+	                    sv.website, sv.cancellation_url, sv.logo_url, sv.catalog_version, sv.created_at,
+	                    ARRAY(SELECT sa.alias FROM service_aliases sa WHERE sa.service_id = sv.id ORDER BY sa.alias),
+	                    ARRAY(SELECT st.tag FROM service_tags st WHERE st.service_id = sv.id ORDER BY st.tag),
+	                    ` + pricesJSON + `
+	           FROM services sv`
+
+// pricesJSON — цены сервиса sv по регионам как JSON-массив model.RegionalPrice
+const pricesJSON = `(SELECT COALESCE(json_agg(json_build_object(
+	                        'region', rp.region, 'currency', rp.currency, 'price_minor', rp.price_minor
+	                    ) ORDER BY rp.region), '[]'::json)
+	                     FROM service_regional_prices rp WHERE rp.service_id = sv.id)`
+
+func scanService(row pgx.Row) (model.Service, error) {
+	var s model.Service
+	err := row.Scan(&s.ID, &s.Name, &s.NormalizedName, &s.Category, &s.Website, &s.CancellationURL, &s.LogoURL,
+		&s.CatalogVersion, &s.CreatedAt, &s.Aliases, &s.Tags, &s.Prices)
+	return s, err
+}
+
+func listServices(ctx context.Context, q querier) ([]model.Service, error) {
+	rows, err := q.Query(ctx, serviceSelect+` ORDER BY sv.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]model.Service, 0)
+	for rows.Next() {
+		s, err := scanService(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	components, err := loadComponents(ctx, q, 0)
+	if err != nil {
+		return nil, err
+	}
+	for i := range res {
+		res[i].Components = components[res[i].ID]
+	}
+
+	return res, nil
+}
+
+// loadComponents возвращает состав пакетов по id пакета; bundleID == 0 — все пакеты
+func loadComponents(ctx context.Context, q querier, bundleID int) (map[int][]model.BundleComponent, error) {
+	const sql = `SELECT bc.bundle_id, bc.component_id, s.name, bc.share
+	           FROM service_bundle_components bc
+	           JOIN services s ON s.id = bc.component_id
+	           WHERE $1 = 0 OR bc.bundle_id = $1
+	           ORDER BY bc.bundle_id, s.name`
+
+	rows, err := q.Query(ctx, sql, bundleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make(map[int][]model.BundleComponent)
+	for rows.Next() {
+		var (
+			id int
+			c  model.BundleComponent
+		)
+		if err := rows.Scan(&id, &c.ServiceID, &c.Name, &c.Share); err != nil {
+			return nil, err
+		}
+		res[id] = append(res[id], c)
+	}
+
+	return res, rows.Err()
+}
+
+func (r *catalogRepository) GetService(ctx context.Context, id int) (*model.Service, error) {
+	s, err := scanService(r.pool.QueryRow(ctx, serviceSelect+` WHERE sv.id=$1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, model.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	components, err := loadComponents(ctx, r.pool, id)
+	if err != nil {
+		return nil, err
+	}
+	s.Components = components[id]
+
+	return &s, nil
+}
+
+// SetComponents заменяет состав пакета. Вложенность — один уровень: пакет не может входить
+// в другой пакет, а его компоненты не могут быть пакетами.
+func (r *catalogRepository) SetComponents(ctx context.Context, bundleID int, components []model.BundleComponent) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	const lock = `SELECT id FROM services WHERE id=$1 FOR UPDATE`
+	if err := tx.QueryRow(ctx, lock, bundleID).Scan(new(int)); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.ErrNotFound
+		}
+		return err
+	}
+
+	ids := make([]int, 0, len(components))
+	shares := make([]int, 0, len(components))
+	for _, c := range components {
+		ids = append(ids, c.ServiceID)
+		shares = append(shares, c.Share)
+	}
+
+	if len(ids) > 0 {
+		const nested = `SELECT EXISTS (SELECT 1 FROM service_bundle_components WHERE component_id=$1)`
+		var isComponent bool
+		if err := tx.QueryRow(ctx, nested, bundleID).Scan(&isComponent); err != nil {
+			return err
+		}
+		if isComponent {
+			return &model.ErrInvalid{Msg: "service is a component of another bundle"}
+		}
+
+		const check = `SELECT count(*) FILTER (WHERE s.id IS NULL),
+		                    count(*) FILTER (WHERE EXISTS (SELECT 1 FROM service_bundle_components bc WHERE bc.bundle_id = s.id))
+		             FROM unnest($1::int[]) AS c(id)
+		             LEFT JOIN services s ON s.id = c.id`
+		var missing, bundles int
+		if err := tx.QueryRow(ctx, check, ids).Scan(&missing, &bundles); err != nil {
+			return err
+		}
+		if missing > 0 {
+			return &model.ErrInvalid{Msg: "unknown component service"}
+		}
+		if bundles > 0 {
+			return &model.ErrInvalid{Msg: "component must not be a bundle"}
+		}
+	}
+
+	const del = `DELETE FROM service_bundle_components WHERE bundle_id=$1`
+	if _, err := tx.Exec(ctx, del, bundleID); err != nil {
+		return err
+	}
+
+	const ins = `INSERT INTO service_bundle_components (bundle_id, component_id, share)
+	           SELECT $1, c.id, c.share FROM unnest($2::int[], $3::int[]) AS c(id, share)`
+	if _, err := tx.Exec(ctx, ins, bundleID, ids, shares); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// SetLabels заменяет категорию и набор тегов сервиса; значения уже нормализованы сервисным слоем
+func (r *catalogRepository) SetLabels(ctx context.Context, id int, category *string, tags []string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	const upd = `UPDATE services SET category=$1 WHERE id=$2`
+	ct, err := tx.Exec(ctx, upd, category, id)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+
+	const del = `DELETE FROM service_tags WHERE service_id=$1`
+	if _, err := tx.Exec(ctx, del, id); err != nil {
+		return err
+	}
+
+	const ins = `INSERT INTO service_tags (service_id, tag) SELECT $1, unnest($2::text[]) ON CONFLICT DO NOTHING`
+	if _, err := tx.Exec(ctx, ins, id, tags); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *catalogRepository) ListPlans(ctx context.Context, serviceID int) ([]model.Plan, error) {
+	const sql = `SELECT id, service_id, name, price, billing_period, currency
+	           FROM service_plans WHERE service_id=$1 ORDER BY price, id`
+
+	rows, err := r.pool.Query(ctx, sql, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]model.Plan, 0)
+	for rows.Next() {
+		var p model.Plan
+		if err := rows.Scan(&p.ID, &p.ServiceID, &p.Name, &p.Price, &p.BillingPeriod, &p.Currency); err != nil {
+			return nil, err
+		}
+		res = append(res, p)
+	}
+
+	return res, rows.Err()
+}
+
+// CreatePlan добавляет тариф; тариф с тем же нормализованным именем у сервиса — ошибка валидации
+func (r *catalogRepository) CreatePlan(ctx context.Context, p *model.Plan) (int, error) {
+	const sql = `INSERT INTO service_plans (service_id, name, normalized_name, price, billing_period, currency)
+	           SELECT id, $2, $3, $4, $5, $6 FROM services WHERE id=$1
+	           ON CONFLICT (service_id, normalized_name) DO NOTHING
+	           RETURNING id`
+
+	var id int
+	err := r.pool.QueryRow(ctx, sql, p.ServiceID, p.Name, model.NormalizeServiceName(p.Name), p.Price, p.BillingPeriod, p.Currency).Scan(&id)
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return id, err
+	}
+
+	// строки нет либо из-за отсутствия сервиса, либо из-за конфликта имени
+	if _, err := r.GetService(ctx, p.ServiceID); err != nil {
+		return 0, err
+	}
+	return 0, &model.ErrInvalid{Msg: fmt.Sprintf("plan %q already exists", p.Name)}
+}
+
+// ImportCatalogEntry создаёт или обновляет сервис по записи встроенного каталога. Поля с локальными
+// правками (отличаются от снимка прошлого импорта) сохраняются, см. model.MergeCatalogFields.
+// Алиасы каталога добавляются, только если они свободны. При dryRun изменения откатываются.
+func (r *catalogRepository) ImportCatalogEntry(ctx context.Context, e model.CatalogEntry, version int, dryRun bool) (*model.ImportResult, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	res := &model.ImportResult{Name: e.Name}
+	snapshot, err := json.Marshal(e.CatalogFields)
+	if err != nil {
+		return nil, err
+	}
+
+	const find = `SELECT sv.id, sv.category, sv.website, sv.cancellation_url, sv.logo_url,
+	                    sv.catalog_version, sv.catalog_snapshot, ` + pricesJSON + `
+	            FROM services sv
+	            WHERE sv.id = (SELECT id FROM services WHERE normalized_name=$1
+	                           UNION ALL
+	                           SELECT service_id FROM service_aliases WHERE alias_normalized=$1
+	                           LIMIT 1)
+	            FOR UPDATE`
+	var (
+		cur        model.CatalogFields
+		curVersion *int
+		prev       *model.CatalogFields
+	)
+	err = tx.QueryRow(ctx, find, model.NormalizeServiceName(e.Name)).Scan(&res.ServiceID, &cur.Category, &cur.Website,
+		&cur.CancellationURL, &cur.LogoURL, &curVersion, &prev, &cur.Prices)
+
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		const ins = `INSERT INTO services (name, normalized_name, category, website, cancellation_url, logo_url,
+		                                 catalog_version, catalog_snapshot)
+		           VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+		err = tx.QueryRow(ctx, ins, model.CleanServiceName(e.Name), model.NormalizeServiceName(e.Name), e.Category,
+			e.Website, e.CancellationURL, e.LogoURL, version, snapshot).Scan(&res.ServiceID)
+		if err != nil {
+			return nil, err
+		}
+		if err := replacePrices(ctx, tx, res.ServiceID, e.Prices); err != nil {
+			return nil, err
+		}
+		res.Action = model.ImportCreated
+	case err != nil:
+		return nil, err
+	default:
+		merged, kept := model.MergeCatalogFields(cur, prev, e.CatalogFields)
+		if len(cur.Prices) == 0 {
+			cur.Prices = nil
+		}
+		if len(merged.Prices) == 0 {
+			merged.Prices = nil
+		}
+		res.Kept = kept
+		res.Action = model.ImportUnchanged
+		if !reflect.DeepEqual(merged, cur) || curVersion == nil || *curVersion != version {
+			res.Action = model.ImportUpdated
+		}
+
+		const upd = `UPDATE services SET category=$2, website=$3, cancellation_url=$4, logo_url=$5,
+		                                 catalog_version=$6, catalog_snapshot=$7
+		           WHERE id=$1`
+		if _, err := tx.Exec(ctx, upd, res.ServiceID, merged.Category, merged.Website, merged.CancellationURL,
+			merged.LogoURL, version, snapshot); err != nil {
+			return nil, err
+		}
+		if err := replacePrices(ctx, tx, res.ServiceID, merged.Prices); err != nil {
+			return nil, err
+		}
+	}
+
+	const alias = `INSERT INTO service_aliases (alias_normalized, alias, service_id)
+	             SELECT $1, $2, $3
+	             WHERE NOT EXISTS (SELECT 1 FROM services WHERE normalized_name=$1)
+	             ON CONFLICT (alias_normalized) DO NOTHING`
+	for _, a := range e.Aliases {
+		if _, err := tx.Exec(ctx, alias, model.NormalizeServiceName(a), model.CleanServiceName(a), res.ServiceID); err != nil {
+			return nil, err
+		}
+	}
+
+	if dryRun {
+		return res, nil
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	r.services.Invalidate()
+
+	return res, nil
+}
+
+// ApplyPriceChange записывает новую цену в историю каждой подписки сервиса, активной в c.EffectiveMonth
+// или позже, если цена в этом месяце отличается. Подписки без тарифа считаются в model.DefaultCurrency.
+// При dryRun изменения откатываются, возвращается только прогноз.
+func (r *catalogRepository) ApplyPriceChange(ctx context.Context, c model.ServicePriceChange, dryRun bool) (*model.PriceChangeResult, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	const lock = `SELECT id FROM services WHERE id=$1 FOR SHARE`
+	if err := tx.QueryRow(ctx, lock, c.ServiceID).Scan(new(int)); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, model.ErrNotFound
+		}
+		return nil, err
+	}
+
+	// $2 — первое число месяца: подписка, закончившаяся в этом месяце (по UTC), ещё затрагивается
+	const sel = `SELECT us.id, us.user_id::text,
+	                  COALESCE((SELECT pc.price FROM subscription_price_changes pc
+	                            WHERE pc.subscription_id = us.id AND pc.effective_month <= $2
+	                            ORDER BY pc.effective_month DESC LIMIT 1), us.price)
+	           FROM user_subscriptions us
+	           LEFT JOIN service_plans sp ON sp.id = us.plan_id
+	           WHERE us.service_id = $1
+	             AND (us.end_date IS NULL OR us.end_date >= $2::date::timestamp AT TIME ZONE 'UTC')
+	             AND ($3 = '' OR sp.normalized_name = $3)
+	             AND ($4 = '' OR COALESCE(sp.currency, $5) = $4)
+	           ORDER BY us.id
+	           FOR UPDATE OF us`
+	rows, err := tx.Query(ctx, sel, c.ServiceID, c.EffectiveMonth, model.NormalizeServiceName(c.Plan), c.Currency, model.DefaultCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &model.PriceChangeResult{
+		ServiceID:      c.ServiceID,
+		EffectiveMonth: c.EffectiveMonth,
+		Price:          c.Price,
+		Affected:       make([]model.PriceChangeItem, 0),
+		DryRun:         dryRun,
+	}
+	for rows.Next() {
+		var it model.PriceChangeItem
+		if err := rows.Scan(&it.SubscriptionID, &it.UserID, &it.OldPrice); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if it.OldPrice == c.Price {
+			continue
+		}
+		it.NewPrice = c.Price
+		it.Delta = it.NewPrice - it.OldPrice
+		res.MonthlyDelta += it.Delta
+		res.Affected = append(res.Affected, it)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	const ins = `INSERT INTO subscription_price_changes (subscription_id, effective_month, price) VALUES ($1, $2, $3)
+	           ON CONFLICT (subscription_id, effective_month) DO UPDATE SET price=EXCLUDED.price, created_at=now()`
+	for _, it := range res.Affected {
+		if _, err := tx.Exec(ctx, ins, it.SubscriptionID, c.EffectiveMonth, c.Price); err != nil {
+			return nil, err
+		}
+	}
+
+	audit := map[string]interface{}{
+		"effective_month": c.EffectiveMonth,
+		"price":           c.Price,
+		"plan":            c.Plan,
+		"currency":        c.Currency,
+		"affected":        len(res.Affected),
+		"monthly_delta":   res.MonthlyDelta,
+	}
+	if err := writeAudit(ctx, tx, "service.price_change", "service", c.ServiceID, audit); err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return res, nil
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func replacePrices(ctx context.Context, tx pgx.Tx, serviceID int, prices []model.RegionalPrice) error {
+	const del = `DELETE FROM service_regional_prices WHERE service_id=$1`
+	if _, err := tx.Exec(ctx, del, serviceID); err != nil {
+		return err
+	}
+
+	const ins = `INSERT INTO service_regional_prices (service_id, region, currency, price_minor) VALUES ($1, $2, $3, $4)`
+	for _, p := range prices {
+		if _, err := tx.Exec(ctx, ins, serviceID, p.Region, p.Currency, p.PriceMinor); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *catalogRepository) SetNormalizedName(ctx context.Context, id int, normalized string) error {
+	const sql = `UPDATE services SET normalized_name=$1 WHERE id=$2`
+	ct, err := r.pool.Exec(ctx, sql, normalized, id)
+	if err != nil {
+		return err
+	}
+	r.services.Invalidate()
+
+	if ct.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+// AddAlias привязывает альтернативное имя к сервису; существующий алиас переназначается
+func (r *catalogRepository) AddAlias(ctx context.Context, serviceID int, alias string) error {
+	const sql = `INSERT INTO service_aliases (alias_normalized, alias, service_id) VALUES ($1, $2, $3)
+	           ON CONFLICT (alias_normalized) DO UPDATE SET alias=EXCLUDED.alias, service_id=EXCLUDED.service_id`
+	if _, err := r.pool.Exec(ctx, sql, model.NormalizeServiceName(alias), model.CleanServiceName(alias), serviceID); err != nil {
+		return err
+	}
+	r.services.Invalidate()
+	return nil
+}
+
+// MergeServices в одной транзакции переносит подписки и алиасы source на target,
+// сохраняет имя source как алиас (если оно отличается от target), пишет запись в audit_log
+// и удаляет source. При dryRun изменения откатываются, возвращается только прогноз.
+func (r *catalogRepository) MergeServices(ctx context.Context, sourceID, targetID int, dryRun bool) (*model.MergeResult, error) {
+	if sourceID == targetID {
+		return nil, &model.ErrInvalid{Msg: "cannot merge service into itself"}
+	}
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	res := &model.MergeResult{SourceID: sourceID, TargetID: targetID, DryRun: dryRun}
+
+	// блокируем обе строки в порядке id, чтобы параллельные слияния не пересеклись
+	const lock = `SELECT id, name, COALESCE(normalized_name, '') FROM services WHERE id IN ($1, $2) ORDER BY id FOR UPDATE`
+	rows, err := tx.Query(ctx, lock, sourceID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	var srcNormalized, dstNormalized string
+	locked := 0
+	for rows.Next() {
+		var (
+			id               int
+			name, normalized string
+		)
+		if err := rows.Scan(&id, &name, &normalized); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if id == sourceID {
+			res.SourceName, srcNormalized = name, normalized
+		} else {
+			res.TargetName, dstNormalized = name, normalized
+		}
+		locked++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if locked != 2 {
+		return nil, model.ErrNotFound
+	}
+
+	// подписки source, пересекающиеся с подписками того же пользователя на target, нарушили бы
+	// user_subscriptions_no_overlap: переносим их с отметкой, как при OVERLAP_POLICY=warn
+	const allowOverlaps = `UPDATE user_subscriptions s SET allow_overlap=TRUE, updated_at=now()
+	                     WHERE s.service_id=$1 AND NOT s.allow_overlap
+	                       AND EXISTS (SELECT 1 FROM user_subscriptions t
+	                                   WHERE t.service_id=$2 AND NOT t.allow_overlap
+	                                     AND t.user_id=s.user_id AND t.active_months && s.active_months)`
+	ct, err := tx.Exec(ctx, allowOverlaps, sourceID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	res.OverlapsAllowed = int(ct.RowsAffected())
+
+	const moveSubs = `UPDATE user_subscriptions SET service_id=$2, updated_at=now() WHERE service_id=$1`
+	ct, err = tx.Exec(ctx, moveSubs, sourceID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	res.MovedSubscriptions = int(ct.RowsAffected())
+
+	// подписки на тарифы, которые есть у target под тем же именем, переводим на тарифы target,
+	// остальные тарифы переносятся целиком, оставшиеся удалятся каскадно вместе с source
+	const remapPlans = `UPDATE user_subscriptions us SET plan_id = tp.id
+	                  FROM service_plans sp
+	                  JOIN service_plans tp ON tp.service_id = $2 AND tp.normalized_name = sp.normalized_name
+	                  WHERE sp.service_id = $1 AND us.plan_id = sp.id`
+	if _, err := tx.Exec(ctx, remapPlans, sourceID, targetID); err != nil {
+		return nil, err
+	}
+
+	const movePlans = `UPDATE service_plans SET service_id=$2
+	                 WHERE service_id=$1
+	                   AND normalized_name NOT IN (SELECT normalized_name FROM service_plans WHERE service_id=$2)`
+	ct, err = tx.Exec(ctx, movePlans, sourceID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	res.MovedPlans = int(ct.RowsAffected())
+
+	// состав пакетов: source заменяется на target там, где это не даёт дублей и ссылок на себя
+	const moveBundles = `UPDATE service_bundle_components SET bundle_id=$2
+	                   WHERE bundle_id=$1 AND component_id <> $2
+	                     AND component_id NOT IN (SELECT component_id FROM service_bundle_components WHERE bundle_id=$2)`
+	if _, err := tx.Exec(ctx, moveBundles, sourceID, targetID); err != nil {
+		return nil, err
+	}
+	const moveComponents = `UPDATE service_bundle_components SET component_id=$2
+	                      WHERE component_id=$1 AND bundle_id <> $2
+	                        AND bundle_id NOT IN (SELECT bundle_id FROM service_bundle_components WHERE component_id=$2)`
+	if _, err := tx.Exec(ctx, moveComponents, sourceID, targetID); err != nil {
+		return nil, err
+	}
+
+	const moveAliases = `UPDATE service_aliases SET service_id=$2 WHERE service_id=$1`
+	ct, err = tx.Exec(ctx, moveAliases, sourceID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	res.MovedAliases = int(ct.RowsAffected())
+
+	if srcNormalized != dstNormalized {
+		const addAlias = `INSERT INTO service_aliases (alias_normalized, alias, service_id) VALUES ($1, $2, $3)
+		                ON CONFLICT (alias_normalized) DO UPDATE SET service_id=EXCLUDED.service_id`
+		if _, err := tx.Exec(ctx, addAlias, srcNormalized, res.SourceName, targetID); err != nil {
+			return nil, err
+		}
+		res.AliasAdded = true
+	}
+
+	const del = `DELETE FROM services WHERE id=$1`
+	if _, err := tx.Exec(ctx, del, sourceID); err != nil {
+		return nil, err
+	}
+
+	if err := writeAudit(ctx, tx, "service.merge", "service", sourceID, res); err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return res, nil
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	r.services.Invalidate()
+
+	return res, nil
+}
+
+// writeAudit добавляет запись в audit_log, details сериализуется в JSON
+func writeAudit(ctx context.Context, tx pgx.Tx, action, entity string, entityID int, details interface{}) error {
+	raw, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	const sql = `INSERT INTO audit_log (action, entity, entity_id, details) VALUES ($1, $2, $3, $4)`
+	_, err = tx.Exec(ctx, sql, action, entity, entityID, raw)
+	return err
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"subs-collector/internal/model"
+)
+
+// TestMergeServices_OverlappingSubscriptions — подписки пользователя на оба сливаемых сервиса с общими месяцами
+// не ломают слияние: перенесённая подписка помечается allow_overlap, пересечение видно в FindOverlaps
+func TestMergeServices_OverlappingSubscriptions(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	r := NewSubscriptionRepository(pool)
+	catalog := NewCatalogRepository(pool)
+
+	user := uuid.NewString()
+	suffix := uuid.NewString()[:8]
+	source, target := "merge-src-"+suffix, "merge-dst-"+suffix
+	t.Cleanup(func() {
+		_, _ = pool.Exec(ctx, `DELETE FROM user_subscriptions WHERE user_id=$1`, user)
+		_, _ = pool.Exec(ctx, `DELETE FROM service_aliases WHERE alias_normalized=$1`, model.NormalizeServiceName(source))
+		_, _ = pool.Exec(ctx, `DELETE FROM services WHERE normalized_name IN ($1, $2)`,
+			model.NormalizeServiceName(source), model.NormalizeServiceName(target))
+	})
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 5, 0)
+	moved, err := r.Create(ctx, &model.Subscription{ServiceName: source, Price: 100, UserID: user, StartDate: start, EndDate: &end})
+	require.NoError(t, err)
+	later := start.AddDate(1, 0, 0)
+	_, err = r.Create(ctx, &model.Subscription{ServiceName: source, Price: 100, UserID: user, StartDate: later})
+	require.NoError(t, err)
+	kept, err := r.Create(ctx, &model.Subscription{ServiceName: target, Price: 100, UserID: user, StartDate: start.AddDate(0, 3, 0), EndDate: &end})
+	require.NoError(t, err)
+
+	serviceID := func(name string) int {
+		var id int
+		require.NoError(t, pool.QueryRow(ctx, `SELECT id FROM services WHERE normalized_name=$1`, model.NormalizeServiceName(name)).Scan(&id))
+		return id
+	}
+	sourceID, targetID := serviceID(source), serviceID(target)
+
+	for _, dryRun := range []bool{true, false} {
+		res, err := catalog.MergeServices(ctx, sourceID, targetID, dryRun)
+		require.NoError(t, err, "dry run %v", dryRun)
+		assert.Equal(t, 2, res.MovedSubscriptions)
+		assert.Equal(t, 1, res.OverlapsAllowed)
+	}
+
+	overlaps, err := r.FindOverlaps(ctx, user)
+	require.NoError(t, err)
+	require.Len(t, overlaps, 1)
+	assert.Equal(t, []int{moved, kept}, []int{overlaps[0].SubscriptionID, overlaps[0].OtherID})
+	assert.Equal(t, target, overlaps[0].ServiceName)
+}
@@ -0,0 +1,51 @@
+package repository_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+
+	"subs-collector/internal/model"
+	"subs-collector/internal/repository"
+	"subs-collector/internal/repository/repotest"
+)
+
+func TestContract_Memory(t *testing.T) {
+	repotest.Run(t, func(t *testing.T, _ string) repository.SubscriptionRepository {
+		return repository.NewMemorySubscriptionRepository()
+	})
+}
+
+func TestContract_File(t *testing.T) {
+	repotest.Run(t, func(t *testing.T, _ string) repository.SubscriptionRepository {
+		r, err := repository.OpenFileSubscriptionRepository(filepath.Join(t.TempDir(), "subs.jsonl"))
+		require.NoError(t, err)
+		t.Cleanup(func() { require.NoError(t, r.Close()) })
+		return r
+	})
+}
+
+func TestContract_Postgres(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL не задан")
+	}
+	pool, err := pgxpool.New(context.Background(), url)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	repotest.Run(t, func(t *testing.T, prefix string) repository.SubscriptionRepository {
+		t.Cleanup(func() {
+			ctx := context.Background()
+			like := model.NormalizeServiceName(prefix) + "%"
+			_, _ = pool.Exec(ctx, `DELETE FROM user_subscriptions
+			                       WHERE service_id IN (SELECT id FROM services WHERE normalized_name LIKE $1)`, like)
+			_, _ = pool.Exec(ctx, `DELETE FROM services WHERE normalized_name LIKE $1`, like)
+		})
+		return repository.NewSubscriptionRepository(pool)
+	})
+}
@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"subs-collector/internal/model"
+)
+
+// ExportToFile переносит справочник сервисов (имена, алиасы, категории) и подписки с историей цен из Postgres
+// в новый файл хранилища path, сохраняя id. Тарифы, теги и пакеты в файле не хранятся: у подписки остаётся
+// только цена. Возвращает число перенесённых подписок.
+func ExportToFile(ctx context.Context, pool *pgxpool.Pool, path string) (int, error) {
+	if _, err := os.Stat(path); err == nil {
+		return 0, fmt.Errorf("%s already exists", path)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+
+	tx, err := pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	records, err := exportServices(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+	subs, err := exportSubscriptions(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range subs {
+		records = append(records, memRecord{Op: memOpPut, Subscription: m})
+	}
+
+	fr, err := OpenFileSubscriptionRepository(path)
+	if err != nil {
+		return 0, err
+	}
+	err = fr.(*fileRepository).restore(records)
+	if cerr := fr.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return 0, err
+	}
+	return len(subs), nil
+}
+
+func exportServices(ctx context.Context, q querier) ([]memRecord, error) {
+	const sel = `SELECT sv.id, sv.name, COALESCE(sv.normalized_name, ''), sv.category,
+	                  COALESCE((SELECT array_agg(sa.alias ORDER BY sa.alias) FROM service_aliases sa
+	                            WHERE sa.service_id = sv.id), '{}')
+	           FROM services sv ORDER BY sv.id`
+	rows, err := q.Query(ctx, sel)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []memRecord
+	for rows.Next() {
+		svc := &memService{}
+		if err := rows.Scan(&svc.ID, &svc.Name, &svc.Normalized, &svc.Category, &svc.Aliases); err != nil {
+			return nil, err
+		}
+		if svc.Normalized == "" {
+			svc.Normalized = model.NormalizeServiceName(svc.Name)
+		}
+		res = append(res, memRecord{Op: memOpService, Service: svc})
+	}
+	return res, rows.Err()
+}
+
+func exportSubscriptions(ctx context.Context, q querier) ([]*memSubscription, error) {
+	const sel = `SELECT id, service_id, price, user_id::text, start_date, end_date, allow_overlap
+	           FROM user_subscriptions ORDER BY id`
+	rows, err := q.Query(ctx, sel)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*memSubscription
+	byID := make(map[int]*memSubscription)
+	for rows.Next() {
+		m := &memSubscription{}
+		if err := rows.Scan(&m.ID, &m.ServiceID, &m.Price, &m.UserID, &m.StartDate, &m.EndDate, &m.AllowOverlap); err != nil {
+			return nil, err
+		}
+		m.StartDate = m.StartDate.UTC()
+		if m.EndDate != nil {
+			end := m.EndDate.UTC()
+			m.EndDate = &end
+		}
+		res = append(res, m)
+		byID[m.ID] = m
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	const history = `SELECT subscription_id, effective_month, price FROM subscription_price_changes
+	               ORDER BY subscription_id, effective_month`
+	hrows, err := q.Query(ctx, history)
+	if err != nil {
+		return nil, err
+	}
+	defer hrows.Close()
+	for hrows.Next() {
+		var id int
+		var pc model.PriceChange
+		if err := hrows.Scan(&id, &pc.EffectiveMonth, &pc.Price); err != nil {
+			return nil, err
+		}
+		if m, ok := byID[id]; ok {
+			m.PriceChanges = append(m.PriceChanges, pc)
+		}
+	}
+	return res, hrows.Err()
+}
+
+// ImportFromFile переносит подписки с историей цен из файла хранилища path в Postgres одной транзакцией.
+// Сервисы находятся по имени (недостающие создаются, их алиасы добавляются, если свободны), подписки
+// получают новые id; пересечение с подпиской в Postgres — ошибка, перенос отменяется.
+// Возвращает число перенесённых подписок.
+func ImportFromFile(ctx context.Context, path string, pool *pgxpool.Pool) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	fr, err := OpenFileSubscriptionRepository(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = fr.Close() }()
+	src := fr.(*fileRepository)
+
+	src.store.mu.RLock()
+	defer src.store.mu.RUnlock()
+
+	var n int
+	err = NewSubscriptionRepository(pool).WithTx(ctx, func(tx SubscriptionRepository) error {
+		pg := tx.(*subscriptionRepository)
+
+		const alias = `INSERT INTO service_aliases (alias_normalized, alias, service_id)
+		             SELECT $1, $2, $3
+		             WHERE NOT EXISTS (SELECT 1 FROM services WHERE normalized_name=$1)
+		             ON CONFLICT (alias_normalized) DO NOTHING`
+		const category = `UPDATE services SET category=$2 WHERE id=$1 AND category IS NULL`
+		ids := make([]int, 0, len(src.store.services))
+		for id := range src.store.services {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		serviceIDs := make(map[int]int, len(ids))
+		for _, id := range ids {
+			svc := src.store.services[id]
+			pgID, err := pg.ensureService(ctx, pg.db, svc.Name)
+			if err != nil {
+				return err
+			}
+			serviceIDs[id] = pgID
+			for _, a := range svc.Aliases {
+				if _, err := pg.db.Exec(ctx, alias, model.NormalizeServiceName(a), a, pgID); err != nil {
+					return err
+				}
+			}
+			if svc.Category != nil {
+				if _, err := pg.db.Exec(ctx, category, pgID, *svc.Category); err != nil {
+					return err
+				}
+			}
+		}
+
+		const ins = `INSERT INTO user_subscriptions (service_id, price, user_id, start_date, end_date, allow_overlap)
+		           VALUES ($1, $2, $3::uuid, $4, $5, $6) RETURNING id`
+		const history = `INSERT INTO subscription_price_changes (subscription_id, effective_month, price) VALUES ($1, $2, $3)`
+		for _, m := range src.store.sorted() {
+			var id int
+			err := pg.db.QueryRow(ctx, ins, serviceIDs[m.ServiceID], m.Price, m.UserID, m.StartDate, m.EndDate, m.AllowOverlap).Scan(&id)
+			if err != nil {
+				return fmt.Errorf("subscription %d: %w", m.ID, mapWriteErr(err))
+			}
+			for _, pc := range m.PriceChanges {
+				if _, err := pg.db.Exec(ctx, history, id, pc.EffectiveMonth.Format(time.DateOnly), pc.Price); err != nil {
+					return fmt.Errorf("subscription %d: %w", m.ID, err)
+				}
+			}
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,30 @@
+//go:build !unix
+
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// lockFile создаёт файл блокировки path; он удаляется unlock. После аварийного завершения процесса
+// файл остаётся, и его нужно удалить вручную.
+func lockFile(path string) (func() error, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("%s exists: storage is used by another process or was not closed", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		_ = f.Close()
+		return os.Remove(path)
+	}, nil
+}
+
+// syncDir — сброс каталога на этих системах не поддерживается, переименование атомарно и так
+func syncDir(string) error {
+	return nil
+}
@@ -0,0 +1,258 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// fileCompactMin — сколько устаревших записей журнала допускается сверх числа живых, прежде чем он сжимается
+const fileCompactMin = 1000
+
+// FileRepository — SubscriptionRepository в локальном файле для однопользовательского режима.
+// Данные держатся в памяти (как NewMemorySubscriptionRepository), каждая зафиксированная транзакция
+// дописывается в журнал JSON-строкой на изменение и завершается записью commit.
+type FileRepository interface {
+	SubscriptionRepository
+	// Compact переписывает журнал снимком текущих данных
+	Compact() error
+	// Close сжимает журнал и снимает блокировку файла
+	Close() error
+}
+
+type fileRepository struct {
+	*memoryRepository
+	path   string
+	unlock func() error
+	log    *os.File
+	size   int64 // длина журнала по последнюю зафиксированную транзакцию
+	lines  int   // записей изменений в журнале
+}
+
+// OpenFileSubscriptionRepository открывает хранилище path, создавая файл при необходимости. Файл блокируется
+// до Close: второй процесс получит ошибку. Незавершённая транзакция в конце журнала (сбой при записи)
+// отбрасывается, испорченная запись в середине — ошибка. Опции — как у NewMemorySubscriptionRepository,
+// сервисы WithMemoryCatalog сохраняются в файл.
+func OpenFileSubscriptionRepository(path string, opts ...MemoryOption) (FileRepository, error) {
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return nil, err
+	}
+
+	r := &fileRepository{memoryRepository: newMemoryRepository(opts...), path: path, unlock: unlock}
+	if err := r.load(); err != nil {
+		_ = unlock()
+		return nil, err
+	}
+	r.store.persist = r.appendRecords
+	if err := r.seedCatalog(); err != nil {
+		_ = r.log.Close()
+		_ = unlock()
+		return nil, err
+	}
+	return r, nil
+}
+
+// load читает журнал, применяя транзакции, завершённые записью commit
+func (r *fileRepository) load() error {
+	f, err := os.OpenFile(r.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	var (
+		pending       []memRecord
+		offset, good  int64
+		torn          bool // запись не разобралась: допустимо только в незавершённой транзакции в конце
+		tornAt, total int64
+	)
+	rd := bufio.NewReader(f)
+	for {
+		line, err := rd.ReadBytes('\n')
+		total += int64(len(line))
+		if errors.Is(err, io.EOF) {
+			break // строка без перевода строки — оборванная запись
+		}
+		if err != nil {
+			_ = f.Close()
+			return err
+		}
+		offset += int64(len(line))
+
+		var rec memRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			if !torn {
+				torn, tornAt = true, offset-int64(len(line))
+			}
+			continue
+		}
+		if rec.Op != memOpCommit {
+			pending = append(pending, rec)
+			continue
+		}
+		if torn {
+			_ = f.Close()
+			return fmt.Errorf("%s: corrupted record at byte %d", r.path, tornAt)
+		}
+		for _, p := range pending {
+			if err := r.store.apply(p); err != nil {
+				_ = f.Close()
+				return fmt.Errorf("%s: %w", r.path, err)
+			}
+		}
+		r.store.lastService = max(r.store.lastService, rec.LastService)
+		r.store.lastSub = max(r.store.lastSub, rec.LastSub)
+		r.lines += len(pending)
+		pending, good = nil, offset
+	}
+
+	if good < total {
+		if err := f.Truncate(good); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	r.log, r.size = f, good
+	return nil
+}
+
+// appendRecords дописывает транзакцию одной записью в файл и ждёт её сброса на диск.
+// При ошибке журнал обрезается до прежней длины, транзакция откатывается.
+func (r *fileRepository) appendRecords(records []memRecord) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, rec := range append(records, r.commitRecord()) {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+
+	if _, err := r.log.Write(buf.Bytes()); err != nil {
+		_ = r.log.Truncate(r.size)
+		return err
+	}
+	if err := r.log.Sync(); err != nil {
+		_ = r.log.Truncate(r.size)
+		return err
+	}
+	r.size += int64(buf.Len())
+	r.lines += len(records)
+
+	// транзакция уже на диске: ошибка сжатия её не отменяет, сжатие повторится при следующей записи
+	if live := len(r.store.services) + len(r.store.subs); r.lines-live > max(fileCompactMin, live) {
+		_ = r.compact()
+	}
+	return nil
+}
+
+func (r *fileRepository) Compact() error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.compact()
+}
+
+// compact пишет снимок во временный файл и атомарно подменяет им журнал
+func (r *fileRepository) compact() error {
+	tmp := r.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp) }()
+
+	n, err := r.writeSnapshot(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, r.path); err != nil {
+		return err
+	}
+	if err := syncDir(r.path); err != nil {
+		return err
+	}
+
+	log, err := os.OpenFile(r.path, os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := log.Stat()
+	if err != nil {
+		_ = log.Close()
+		return err
+	}
+	_ = r.log.Close()
+	r.log, r.size, r.lines = log, info.Size(), n
+	return nil
+}
+
+// writeSnapshot пишет все данные одной транзакцией: сервисы по id, затем подписки по id
+func (r *fileRepository) writeSnapshot(w io.Writer) (int, error) {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	services := make([]*memService, 0, len(r.store.services))
+	for _, svc := range r.store.services {
+		services = append(services, svc)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].ID < services[j].ID })
+
+	var n int
+	for _, svc := range services {
+		if err := enc.Encode(memRecord{Op: memOpService, Service: svc}); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	for _, m := range r.store.sorted() {
+		if err := enc.Encode(memRecord{Op: memOpPut, Subscription: m}); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	if err := enc.Encode(r.commitRecord()); err != nil {
+		return 0, err
+	}
+	return n, bw.Flush()
+}
+
+func (r *fileRepository) commitRecord() memRecord {
+	return memRecord{Op: memOpCommit, LastService: r.store.lastService, LastSub: r.store.lastSub}
+}
+
+// restore применяет и сохраняет записи одной транзакцией, минуя проверки Create (перенос из другого хранилища)
+func (r *fileRepository) restore(records []memRecord) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	for _, rec := range records {
+		if err := r.store.apply(rec); err != nil {
+			return err
+		}
+	}
+	return r.appendRecords(records)
+}
+
+func (r *fileRepository) Close() error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	err := r.compact()
+	if cerr := r.log.Close(); err == nil {
+		err = cerr
+	}
+	if uerr := r.unlock(); err == nil {
+		err = uerr
+	}
+	return err
+}
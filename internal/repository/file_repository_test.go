@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"subs-collector/internal/model"
+)
+
+// TestFileRepository_PersistsAcrossReopen — после повторного открытия данные те же, откаченная транзакция
+// в файл не попала, незавершённая запись в конце журнала отбрасывается
+func TestFileRepository_PersistsAcrossReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "subs.jsonl")
+	category := "video"
+	r, err := OpenFileSubscriptionRepository(path, WithMemoryCatalog([]model.CatalogEntry{
+		{Name: "VideoHub", Aliases: []string{"VH"}, CatalogFields: model.CatalogFields{Category: &category}}}))
+	require.NoError(t, err)
+
+	user := uuid.NewString()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 5, 0)
+	first, err := r.Create(ctx, &model.Subscription{ServiceName: "vh", Price: 100, UserID: user, StartDate: start, EndDate: &end})
+	require.NoError(t, err)
+	second, err := r.Create(ctx, &model.Subscription{ServiceName: "MusicBox", Price: 50, UserID: user, StartDate: start})
+	require.NoError(t, err)
+	require.NoError(t, r.Update(ctx, second, &model.Subscription{ServiceName: "MusicBox", Price: 70, UserID: user, StartDate: start}))
+	third, err := r.Create(ctx, &model.Subscription{ServiceName: "MusicBox", Price: 10, UserID: user, StartDate: start.AddDate(-1, 0, 0),
+		EndDate: &start, AllowOverlap: true})
+	require.NoError(t, err)
+	require.NoError(t, r.Delete(ctx, third))
+
+	boom := errors.New("boom")
+	err = r.WithTx(ctx, func(tx SubscriptionRepository) error {
+		_, err := tx.Create(ctx, &model.Subscription{ServiceName: "Rolled", Price: 1, UserID: user, StartDate: start})
+		require.NoError(t, err)
+		return boom
+	})
+	require.ErrorIs(t, err, boom)
+
+	want, err := r.List(ctx, model.SubscriptionFilter{})
+	require.NoError(t, err)
+	total, err := r.SumTotal(ctx, start, start.AddDate(0, 11, 0), model.SubscriptionFilter{Category: "Video"})
+	require.NoError(t, err)
+	assert.Equal(t, 600, total)
+	require.NoError(t, r.Close())
+
+	// сбой посреди записи: транзакция без commit и оборванная строка
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"op":"delete","id":` + "1}\n" + `{"op":"put","subscr`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	r, err = OpenFileSubscriptionRepository(path)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, r.Close()) }()
+
+	got, err := r.List(ctx, model.SubscriptionFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+	assert.Equal(t, []int{first, second}, []int{got[0].ID, got[1].ID})
+	assert.Equal(t, 70, got[1].Price)
+	total, err = r.SumTotal(ctx, start, start.AddDate(0, 11, 0), model.SubscriptionFilter{Category: "Video"})
+	require.NoError(t, err)
+	assert.Equal(t, 600, total)
+
+	// новые id продолжают последовательность
+	id, err := r.Create(ctx, &model.Subscription{ServiceName: "Rolled", Price: 1, UserID: user, StartDate: start})
+	require.NoError(t, err)
+	assert.Greater(t, id, third)
+}
+
+func TestFileRepository_CorruptedRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "subs.jsonl")
+	log := `{"op":"service","service":{"id":1,"name":"A","normalized_name":"a"}}` + "\n" +
+		`{"op":"pu` + "\n" +
+		`{"op":"commit"}` + "\n"
+	require.NoError(t, os.WriteFile(path, []byte(log), 0o600))
+
+	_, err := OpenFileSubscriptionRepository(path)
+	assert.ErrorContains(t, err, "corrupted record")
+}
+
+func TestFileRepository_LockAndCompact(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "subs.jsonl")
+	r, err := OpenFileSubscriptionRepository(path)
+	require.NoError(t, err)
+
+	_, err = OpenFileSubscriptionRepository(path)
+	assert.Error(t, err, "второй процесс не открывает заблокированное хранилище")
+
+	user := uuid.NewString()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	id, err := r.Create(ctx, &model.Subscription{ServiceName: "VideoHub", Price: 1, UserID: user, StartDate: start})
+	require.NoError(t, err)
+	for i := 2; i <= 20; i++ {
+		require.NoError(t, r.Update(ctx, id, &model.Subscription{ServiceName: "VideoHub", Price: i, UserID: user, StartDate: start}))
+	}
+
+	require.NoError(t, r.Compact())
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 3, bytes.Count(raw, []byte("\n")), "сервис, подписка и commit")
+	require.NoError(t, r.Close())
+
+	r, err = OpenFileSubscriptionRepository(path)
+	require.NoError(t, err)
+	s, err := r.GetByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, 20, s.Price)
+	require.NoError(t, r.Close())
+}
+
+// TestFileBridge — перенос из Postgres в файл сохраняет id и историю цен, из файла в Postgres — создаёт подписки
+func TestFileBridge(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	r := NewSubscriptionRepository(pool)
+
+	user := uuid.NewString()
+	service := "bridge-" + uuid.NewString()[:8]
+	t.Cleanup(func() {
+		_, _ = pool.Exec(ctx, `DELETE FROM user_subscriptions WHERE user_id=$1`, user)
+		_, _ = pool.Exec(ctx, `DELETE FROM services WHERE normalized_name=$1`, model.NormalizeServiceName(service))
+	})
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	id, err := r.Create(ctx, &model.Subscription{ServiceName: service, Price: 100, UserID: user, StartDate: start})
+	require.NoError(t, err)
+	_, err = pool.Exec(ctx, `INSERT INTO subscription_price_changes (subscription_id, effective_month, price) VALUES ($1, '2025-04-01', 150)`, id)
+	require.NoError(t, err)
+	want, err := r.SumTotal(ctx, start, start.AddDate(0, 11, 0), model.SubscriptionFilter{UserID: user})
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "subs.jsonl")
+	_, err = ExportToFile(ctx, pool, path)
+	require.NoError(t, err)
+	fr, err := OpenFileSubscriptionRepository(path)
+	require.NoError(t, err)
+	got, err := fr.SumTotal(ctx, start, start.AddDate(0, 11, 0), model.SubscriptionFilter{UserID: user})
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+	s, err := fr.GetByID(ctx, id)
+	require.NoError(t, err)
+	assert.Len(t, s.PriceChanges, 1)
+
+	// обратно — под новым пользователем, чтобы не пересечься с исходной подпиской
+	other := uuid.NewString()
+	t.Cleanup(func() { _, _ = pool.Exec(ctx, `DELETE FROM user_subscriptions WHERE user_id=$1`, other) })
+	require.NoError(t, fr.Close())
+	fresh := filepath.Join(t.TempDir(), "fresh.jsonl")
+	fr, err = OpenFileSubscriptionRepository(fresh)
+	require.NoError(t, err)
+	_, err = fr.Create(ctx, &model.Subscription{ServiceName: service, Price: 100, UserID: other, StartDate: start})
+	require.NoError(t, err)
+	require.NoError(t, fr.Close())
+
+	n, err := ImportFromFile(ctx, fresh, pool)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	list, err := r.List(ctx, model.SubscriptionFilter{UserID: other, ServiceName: service})
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"subs-collector/internal/model"
+)
+
+// IdempotencyRepository хранит ответы на запросы с Idempotency-Key (таблица idempotency_keys)
+type IdempotencyRepository interface {
+	// Reserve занимает ключ на время выполнения запроса lease: если процесс упадёт, не сохранив ответ,
+	// ключ освободится по его истечении. Если ключ уже занят и не истёк, возвращает его запись и false.
+	Reserve(ctx context.Context, key, fingerprint string, lease time.Duration) (*model.StoredResponse, bool, error)
+	// Complete сохраняет ответ на ttl, если ключ всё ещё занят запросом с отпечатком resp.Fingerprint
+	Complete(ctx context.Context, key string, resp model.StoredResponse, ttl time.Duration) error
+	// Release освобождает ключ, занятый запросом с отпечатком fingerprint, ответ которого не сохраняется
+	Release(ctx context.Context, key, fingerprint string) error
+	// Purge удаляет истёкшие ключи, возвращает их число
+	Purge(ctx context.Context) (int64, error)
+}
+
+type idempotencyRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewIdempotencyRepository(pool *pgxpool.Pool) IdempotencyRepository {
+	return &idempotencyRepository{pool: pool}
+}
+
+func (r *idempotencyRepository) Reserve(ctx context.Context, key, fingerprint string, lease time.Duration) (*model.StoredResponse, bool, error) {
+	// истёкшая запись занимается заново той же командой
+	const ins = `INSERT INTO idempotency_keys (key, fingerprint, expires_at) VALUES ($1, $2, now() + $3 * interval '1 second')
+	           ON CONFLICT (key) DO UPDATE
+	               SET fingerprint = EXCLUDED.fingerprint, status = NULL, content_type = NULL, body = NULL,
+	                   created_at = now(), expires_at = EXCLUDED.expires_at
+	               WHERE idempotency_keys.expires_at <= now()
+	           RETURNING key`
+	const sel = `SELECT fingerprint, COALESCE(status, 0), COALESCE(content_type, ''), body
+	           FROM idempotency_keys WHERE key = $1 AND expires_at > now()`
+
+	// запись может истечь или освободиться между командами — тогда пробуем ещё раз
+	for attempt := 0; attempt < 3; attempt++ {
+		var k string
+		err := r.pool.QueryRow(ctx, ins, key, fingerprint, lease.Seconds()).Scan(&k)
+		if err == nil {
+			return nil, true, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return nil, false, err
+		}
+
+		var resp model.StoredResponse
+		err = r.pool.QueryRow(ctx, sel, key).Scan(&resp.Fingerprint, &resp.Status, &resp.ContentType, &resp.Body)
+		if err == nil {
+			return &resp, false, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return nil, false, err
+		}
+	}
+	return nil, false, fmt.Errorf("idempotency key %q: reservation keeps conflicting", key)
+}
+
+// Complete не трогает ключ, занятый заново другим запросом после истечения lease
+func (r *idempotencyRepository) Complete(ctx context.Context, key string, resp model.StoredResponse, ttl time.Duration) error {
+	const sql = `UPDATE idempotency_keys
+	             SET status = $3, content_type = $4, body = $5, expires_at = now() + $6 * interval '1 second'
+	             WHERE key = $1 AND fingerprint = $2 AND status IS NULL`
+	_, err := r.pool.Exec(ctx, sql, key, resp.Fingerprint, resp.Status, resp.ContentType, resp.Body, ttl.Seconds())
+	return err
+}
+
+func (r *idempotencyRepository) Release(ctx context.Context, key, fingerprint string) error {
+	const sql = `DELETE FROM idempotency_keys WHERE key = $1 AND fingerprint = $2 AND status IS NULL`
+	_, err := r.pool.Exec(ctx, sql, key, fingerprint)
+	return err
+}
+
+func (r *idempotencyRepository) Purge(ctx context.Context) (int64, error) {
+	ct, err := r.pool.Exec(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= now()`)
+	return ct.RowsAffected(), err
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"subs-collector/internal/model"
+)
+
+// TestIdempotency_LeaseExpires — ключ упавшего запроса освобождается по истечении lease, а поздний Complete
+// этого запроса не затирает ключ, занятый заново другим запросом
+func TestIdempotency_LeaseExpires(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	r := NewIdempotencyRepository(pool)
+	key := "test-" + uuid.NewString()
+	t.Cleanup(func() { _, _ = pool.Exec(ctx, `DELETE FROM idempotency_keys WHERE key=$1`, key) })
+
+	_, reserved, err := r.Reserve(ctx, key, "first", 500*time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, reserved)
+	stored, reserved, err := r.Reserve(ctx, key, "first", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, reserved, "lease ещё не истёк")
+	assert.Zero(t, stored.Status)
+
+	time.Sleep(time.Second)
+	_, reserved, err = r.Reserve(ctx, key, "second", time.Minute)
+	require.NoError(t, err)
+	require.True(t, reserved, "ключ освобождается по истечении lease")
+
+	require.NoError(t, r.Complete(ctx, key, model.StoredResponse{Fingerprint: "first", Status: 201}, time.Hour))
+	require.NoError(t, r.Release(ctx, key, "first"))
+	stored, _, err = r.Reserve(ctx, key, "third", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "second", stored.Fingerprint)
+	assert.Zero(t, stored.Status, "чужой Complete не сохранил ответ")
+
+	require.NoError(t, r.Complete(ctx, key, model.StoredResponse{Fingerprint: "second", Status: 201}, time.Hour))
+	var ttl float64
+	require.NoError(t, pool.QueryRow(ctx, `SELECT EXTRACT(EPOCH FROM expires_at - now())::float8 FROM idempotency_keys WHERE key=$1`, key).Scan(&ttl))
+	assert.Greater(t, ttl, (59 * time.Minute).Seconds(), "ответ хранится ttl")
+}
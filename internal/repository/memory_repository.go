@@ -0,0 +1,664 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"subs-collector/internal/model"
+)
+
+// memService — сервис справочника в памяти. Тарифы, теги и пакеты не хранятся: фильтры по ним
+// ничего не находят, подписка с тарифом отклоняется как с неизвестным тарифом.
+type memService struct {
+	ID         int      `json:"id"`
+	Name       string   `json:"name"`
+	Normalized string   `json:"normalized_name"`
+	Aliases    []string `json:"aliases,omitempty"`
+	Category   *string  `json:"category,omitempty"`
+}
+
+// memSubscription — подписка в памяти; записи не меняются на месте, изменение заменяет указатель
+type memSubscription struct {
+	ID           int        `json:"id"`
+	ServiceID    int        `json:"service_id"`
+	Price        int        `json:"price"`
+	UserID       string     `json:"user_id"`
+	StartDate    time.Time  `json:"start_date"`
+	EndDate      *time.Time `json:"end_date,omitempty"`
+	AllowOverlap bool       `json:"allow_overlap,omitempty"`
+	// PriceChanges — история цены по возрастанию EffectiveMonth
+	PriceChanges []model.PriceChange `json:"price_changes,omitempty"`
+}
+
+// Действия записи журнала изменений: сервис и подписка пишутся целиком, commit завершает транзакцию
+const (
+	memOpService = "service"
+	memOpPut     = "put"
+	memOpDelete  = "delete"
+	memOpCommit  = "commit"
+)
+
+// memRecord — одно изменение данных: из них состоит журнал файлового хранилища. Запись commit хранит
+// последние выданные id, чтобы id удалённых подписок не выдавались повторно.
+type memRecord struct {
+	Op           string           `json:"op"`
+	Service      *memService      `json:"service,omitempty"`
+	Subscription *memSubscription `json:"subscription,omitempty"`
+	ID           int              `json:"id,omitempty"`
+	LastService  int              `json:"last_service,omitempty"`
+	LastSub      int              `json:"last_subscription,omitempty"`
+}
+
+// memState — данные репозитория в памяти; id не переиспользуются и при откате, как последовательности
+type memState struct {
+	services    map[int]*memService
+	names       map[string]int // нормализованное имя → id сервиса
+	aliases     map[string]int // нормализованный алиас → id сервиса
+	subs        map[int]*memSubscription
+	lastService int
+	lastSub     int
+}
+
+// apply применяет изменение из журнала
+func (st *memState) apply(rec memRecord) error {
+	switch {
+	case rec.Op == memOpService && rec.Service != nil:
+		svc := rec.Service
+		st.services[svc.ID] = svc
+		st.names[svc.Normalized] = svc.ID
+		for _, alias := range svc.Aliases {
+			st.aliases[model.NormalizeServiceName(alias)] = svc.ID
+		}
+		st.lastService = max(st.lastService, svc.ID)
+	case rec.Op == memOpPut && rec.Subscription != nil:
+		if _, ok := st.services[rec.Subscription.ServiceID]; !ok {
+			return fmt.Errorf("subscription %d refers to unknown service %d", rec.Subscription.ID, rec.Subscription.ServiceID)
+		}
+		st.subs[rec.Subscription.ID] = rec.Subscription
+		st.lastSub = max(st.lastSub, rec.Subscription.ID)
+	case rec.Op == memOpDelete:
+		delete(st.subs, rec.ID)
+	default:
+		return fmt.Errorf("unknown record %q", rec.Op)
+	}
+	return nil
+}
+
+type memStore struct {
+	mu sync.RWMutex
+	memState
+	// persist сохраняет изменения зафиксированной транзакции; ошибка откатывает её
+	persist func(records []memRecord) error
+}
+
+// memTx — транзакция WithTx: обратные действия для отката и изменения для журнала, в порядке записи
+type memTx struct {
+	undo    []func()
+	records []memRecord
+}
+
+func (t *memTx) rollback() {
+	for i := len(t.undo) - 1; i >= 0; i-- {
+		t.undo[i]()
+	}
+}
+
+type memoryRepository struct {
+	store         *memStore
+	tx            *memTx // не nil внутри WithTx: блокировка уже взята
+	strictCatalog bool
+	catalog       []model.CatalogEntry
+}
+
+// MemoryOption — необязательная настройка репозитория в памяти
+type MemoryOption func(*memoryRepository)
+
+// WithMemoryStrictCatalog — как WithStrictCatalog: неизвестное имя сервиса возвращает *model.UnknownServiceError
+func WithMemoryStrictCatalog(strict bool) MemoryOption {
+	return func(r *memoryRepository) { r.strictCatalog = strict }
+}
+
+// WithMemoryCatalog добавляет в справочник недостающие сервисы каталога: имя, алиасы (если свободны) и категорию
+func WithMemoryCatalog(entries []model.CatalogEntry) MemoryOption {
+	return func(r *memoryRepository) { r.catalog = entries }
+}
+
+// NewMemorySubscriptionRepository создаёт SubscriptionRepository в памяти процесса — для демо и разработки
+// без Postgres. Результаты совпадают с реализацией на Postgres, включая сводки с историей цен; транзакции
+// WithTx выполняются по одной и откатываются обратными действиями.
+func NewMemorySubscriptionRepository(opts ...MemoryOption) SubscriptionRepository {
+	r := newMemoryRepository(opts...)
+	// без журнала заполнение справочника ошибиться не может
+	_ = r.seedCatalog()
+	return r
+}
+
+func newMemoryRepository(opts ...MemoryOption) *memoryRepository {
+	r := &memoryRepository{store: &memStore{memState: memState{
+		services: make(map[int]*memService),
+		names:    make(map[string]int),
+		aliases:  make(map[string]int),
+		subs:     make(map[int]*memSubscription),
+	}}}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// seedCatalog добавляет сервисы WithMemoryCatalog, которых ещё нет в справочнике
+func (r *memoryRepository) seedCatalog() error {
+	if len(r.catalog) == 0 {
+		return nil
+	}
+	return r.WithTx(context.Background(), func(tx SubscriptionRepository) error {
+		txr := tx.(*memoryRepository)
+		for _, e := range r.catalog {
+			if _, ok := txr.store.names[model.NormalizeServiceName(e.Name)]; !ok {
+				txr.addService(e.Name, e.Category, e.Aliases)
+			}
+		}
+		return nil
+	})
+}
+
+// addService создаёт сервис; алиасы, занятые другими сервисами, пропускаются
+func (r *memoryRepository) addService(name string, category *string, aliases []string) *memService {
+	st := &r.store.memState
+	st.lastService++
+	svc := &memService{ID: st.lastService, Name: model.CleanServiceName(name), Normalized: model.NormalizeServiceName(name),
+		Category: category}
+	var added []string
+	for _, alias := range aliases {
+		n := model.NormalizeServiceName(alias)
+		if _, ok := st.names[n]; ok || n == svc.Normalized {
+			continue
+		}
+		if _, ok := st.aliases[n]; ok {
+			continue
+		}
+		st.aliases[n] = svc.ID
+		added = append(added, n)
+		svc.Aliases = append(svc.Aliases, model.CleanServiceName(alias))
+	}
+	st.services[svc.ID] = svc
+	st.names[svc.Normalized] = svc.ID
+
+	r.tx.records = append(r.tx.records, memRecord{Op: memOpService, Service: svc})
+	r.tx.undo = append(r.tx.undo, func() {
+		delete(st.services, svc.ID)
+		delete(st.names, svc.Normalized)
+		for _, n := range added {
+			delete(st.aliases, n)
+		}
+	})
+	return svc
+}
+
+// read выполняет fn под блокировкой чтения (внутри WithTx блокировка уже взята)
+func (r *memoryRepository) read(fn func(st *memState) error) error {
+	if r.tx == nil {
+		r.store.mu.RLock()
+		defer r.store.mu.RUnlock()
+	}
+	return fn(&r.store.memState)
+}
+
+// write выполняет fn в транзакции: текущей внутри WithTx, иначе в отдельной
+func (r *memoryRepository) write(ctx context.Context, fn func(tx *memoryRepository) error) error {
+	if r.tx != nil {
+		return fn(r)
+	}
+	return r.WithTx(ctx, func(tx SubscriptionRepository) error { return fn(tx.(*memoryRepository)) })
+}
+
+func (r *memoryRepository) WithTx(ctx context.Context, fn func(SubscriptionRepository) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if r.tx == nil {
+		r.store.mu.Lock()
+		defer r.store.mu.Unlock()
+	}
+
+	txRepo := *r
+	txRepo.tx = &memTx{}
+	// паника fn откатывает транзакцию, как ошибка: иначе блокировка снимется с наполовину применёнными изменениями
+	defer func() {
+		if p := recover(); p != nil {
+			txRepo.tx.rollback()
+			panic(p)
+		}
+	}()
+	if err := fn(&txRepo); err != nil {
+		txRepo.tx.rollback()
+		return err
+	}
+	if r.tx != nil {
+		// точка сохранения: откат внешней транзакции отменит и её изменения
+		r.tx.undo = append(r.tx.undo, txRepo.tx.undo...)
+		r.tx.records = append(r.tx.records, txRepo.tx.records...)
+		return nil
+	}
+	if r.store.persist != nil && len(txRepo.tx.records) > 0 {
+		if err := r.store.persist(txRepo.tx.records); err != nil {
+			txRepo.tx.rollback()
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memoryRepository) Import(ctx context.Context, subs []*model.Subscription, o model.ImportOptions) ([]model.ImportRowResult, bool, error) {
+	return importSubscriptions(ctx, r, subs, o)
+}
+
+func (r *memoryRepository) Batch(ctx context.Context, ops []model.BatchOp, o model.BatchOptions) ([]model.BatchOpResult, bool, error) {
+	return batchSubscriptions(ctx, r, ops, o)
+}
+
+// putSubscription записывает подписку с возможностью отката
+func (r *memoryRepository) putSubscription(s *memSubscription) {
+	st := &r.store.memState
+	prev, ok := st.subs[s.ID]
+	st.subs[s.ID] = s
+	r.tx.records = append(r.tx.records, memRecord{Op: memOpPut, Subscription: s})
+	r.tx.undo = append(r.tx.undo, func() {
+		if ok {
+			st.subs[s.ID] = prev
+		} else {
+			delete(st.subs, s.ID)
+		}
+	})
+}
+
+func (r *memoryRepository) Create(ctx context.Context, s *model.Subscription) (int, error) {
+	var id int
+	err := r.write(ctx, func(tx *memoryRepository) error {
+		m, err := tx.subscriptionOf(s)
+		if err != nil {
+			return err
+		}
+		if err := tx.checkOverlap(m); err != nil {
+			return err
+		}
+		tx.store.lastSub++
+		m.ID = tx.store.lastSub
+		tx.putSubscription(m)
+		id = m.ID
+		return nil
+	})
+	return id, err
+}
+
+func (r *memoryRepository) Update(ctx context.Context, id int, s *model.Subscription) error {
+	return r.write(ctx, func(tx *memoryRepository) error {
+		m, err := tx.subscriptionOf(s)
+		if err != nil {
+			return err
+		}
+		prev, ok := tx.store.subs[id]
+		if !ok {
+			return model.ErrNotFound
+		}
+		m.ID, m.PriceChanges = id, prev.PriceChanges
+		if err := tx.checkOverlap(m); err != nil {
+			return err
+		}
+		tx.putSubscription(m)
+		return nil
+	})
+}
+
+func (r *memoryRepository) Delete(ctx context.Context, id int) error {
+	return r.write(ctx, func(tx *memoryRepository) error {
+		st := &tx.store.memState
+		prev, ok := st.subs[id]
+		if !ok {
+			return model.ErrNotFound
+		}
+		delete(st.subs, id)
+		tx.tx.records = append(tx.tx.records, memRecord{Op: memOpDelete, ID: id})
+		tx.tx.undo = append(tx.tx.undo, func() { st.subs[id] = prev })
+		return nil
+	})
+}
+
+// subscriptionOf проверяет подписку и находит её сервис, как resolveRefs и приведения типов в SQL
+func (r *memoryRepository) subscriptionOf(s *model.Subscription) (*memSubscription, error) {
+	userID, err := uuid.Parse(s.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid input syntax for type uuid: %q", s.UserID)
+	}
+	serviceID, err := r.ensureService(s.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+	if s.Plan != nil && *s.Plan != "" {
+		return nil, &model.ErrInvalid{Msg: fmt.Sprintf("unknown plan %q for service %q", *s.Plan, s.ServiceName)}
+	}
+	s.Plan = nil
+
+	m := &memSubscription{ServiceID: serviceID, Price: s.Price, UserID: userID.String(),
+		StartDate: s.StartDate.UTC(), AllowOverlap: s.AllowOverlap}
+	if s.EndDate != nil {
+		end := s.EndDate.UTC()
+		m.EndDate = &end
+	}
+	if lo, hi := m.months(); hi < lo {
+		return nil, errors.New("range lower bound must be less than or equal to range upper bound")
+	}
+	return m, nil
+}
+
+// ensureService — как subscriptionRepository.ensureService: имя важнее алиаса, в строгом режиме сервис не создаётся
+func (r *memoryRepository) ensureService(name string) (int, error) {
+	st := &r.store.memState
+	normalized := model.NormalizeServiceName(name)
+	if id, ok := st.names[normalized]; ok {
+		return id, nil
+	}
+	if id, ok := st.aliases[normalized]; ok {
+		return id, nil
+	}
+
+	if r.strictCatalog {
+		services := make([]model.Service, 0, len(st.services))
+		for _, svc := range st.services {
+			services = append(services, model.Service{ID: svc.ID, Name: svc.Name, NormalizedName: svc.Normalized, Aliases: svc.Aliases})
+		}
+		return 0, &model.UnknownServiceError{Name: name, Suggestions: model.SuggestServiceNames(name, services)}
+	}
+
+	return r.addService(name, nil, nil).ID, nil
+}
+
+// checkOverlap — ограничение user_subscriptions_no_overlap: подписки без allow_overlap одного пользователя
+// на один сервис не пересекаются по месяцам
+func (r *memoryRepository) checkOverlap(m *memSubscription) error {
+	if m.AllowOverlap {
+		return nil
+	}
+	lo, hi := m.months()
+	for _, o := range r.store.subs {
+		if o.ID == m.ID || o.AllowOverlap || o.UserID != m.UserID || o.ServiceID != m.ServiceID {
+			continue
+		}
+		if olo, ohi := o.months(); max(lo, olo) < min(hi, ohi) {
+			return model.ErrOverlap
+		}
+	}
+	return nil
+}
+
+// subscription — подписка в виде, который возвращает subscriptionSelect
+func (st *memState) subscription(m *memSubscription) model.Subscription {
+	return model.Subscription{ID: m.ID, ServiceName: st.services[m.ServiceID].Name, Price: m.Price,
+		UserID: m.UserID, StartDate: m.StartDate, EndDate: m.EndDate}
+}
+
+func (r *memoryRepository) GetByID(ctx context.Context, id int) (*model.Subscription, error) {
+	var res *model.Subscription
+	err := r.read(func(st *memState) error {
+		m, ok := st.subs[id]
+		if !ok {
+			return model.ErrNotFound
+		}
+		s := st.subscription(m)
+		s.PriceChanges = append([]model.PriceChange(nil), m.PriceChanges...)
+		res = &s
+		return nil
+	})
+	return res, err
+}
+
+func (r *memoryRepository) List(ctx context.Context, f model.SubscriptionFilter) ([]model.Subscription, error) {
+	res := make([]model.Subscription, 0)
+	err := r.ListEach(ctx, f, func(s model.Subscription) error {
+		res = append(res, s)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ListEach отбирает подписки под блокировкой, а в fn передаёт уже без неё: медленный получатель не задерживает запись
+func (r *memoryRepository) ListEach(ctx context.Context, f model.SubscriptionFilter, fn func(model.Subscription) error) error {
+	var list []model.Subscription
+	err := r.read(func(st *memState) error {
+		for _, m := range st.sorted() {
+			if st.matches(m, f) {
+				list = append(list, st.subscription(m))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, s := range list {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sorted — подписки по возрастанию id
+func (st *memState) sorted() []*memSubscription {
+	list := make([]*memSubscription, 0, len(st.subs))
+	for _, m := range st.subs {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// matches — условия filterCond
+func (st *memState) matches(m *memSubscription, f model.SubscriptionFilter) bool {
+	svc := st.services[m.ServiceID]
+	if f.UserID != "" && !strings.EqualFold(m.UserID, f.UserID) {
+		return false
+	}
+	if f.ServiceName != "" {
+		n := model.NormalizeServiceName(f.ServiceName)
+		if id, ok := st.aliases[n]; svc.Normalized != n && (!ok || id != svc.ID) {
+			return false
+		}
+	}
+	if f.Category != "" && (svc.Category == nil || *svc.Category != model.NormalizeLabel(f.Category)) {
+		return false
+	}
+	if f.Tag != "" || f.Plan != "" {
+		return false
+	}
+	if !f.ActiveFrom.IsZero() || !f.ActiveTo.IsZero() {
+		lo, hi := math.MinInt, math.MaxInt
+		if !f.ActiveFrom.IsZero() {
+			lo = monthIndex(f.ActiveFrom)
+		}
+		if !f.ActiveTo.IsZero() {
+			hi = monthIndex(f.ActiveTo) + 1
+		}
+		if mlo, mhi := m.months(); max(lo, mlo) >= min(hi, mhi) {
+			return false
+		}
+	}
+	return true
+}
+
+// monthIndex — номер месяца t (UTC) от начала эры, месяцы подписки — полуинтервалы таких номеров
+func monthIndex(t time.Time) int {
+	t = t.UTC()
+	return t.Year()*12 + int(t.Month()) - 1
+}
+
+func monthOf(i int) time.Time {
+	return time.Date(i/12, time.Month(i%12+1), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// months — active_months подписки: [месяц начала, месяц после окончания), бессрочная — до math.MaxInt
+func (m *memSubscription) months() (int, int) {
+	if m.EndDate == nil {
+		return monthIndex(m.StartDate), math.MaxInt
+	}
+	return monthIndex(m.StartDate), monthIndex(*m.EndDate) + 1
+}
+
+// amount — стоимость подписки за месяцы [lo, hi) по отрезкам истории цен, как segmentsFrom и segmentAmount.
+// ok == false, если подписка в периоде не активна (в SQL у неё нет ни одного отрезка).
+func (m *memSubscription) amount(lo, hi int) (total int, ok bool) {
+	mlo, mhi := m.months()
+	lo, hi = max(lo, mlo), min(hi, mhi)
+	if lo >= hi {
+		return 0, false
+	}
+
+	// цена из истории действует с первого полного месяца после effective_month; при нескольких изменениях
+	// на один месяц побеждает последнее
+	price, from := m.Price, math.MinInt
+	for _, pc := range m.PriceChanges {
+		start := monthIndex(pc.EffectiveMonth.AddDate(0, 0, -1)) + 1
+		if start > from {
+			total += price * max(0, min(hi, start)-max(lo, from))
+		}
+		price, from = pc.Price, start
+	}
+	total += price * max(0, hi-max(lo, from))
+	return total, true
+}
+
+func (r *memoryRepository) SumTotal(ctx context.Context, from, to time.Time, f model.SubscriptionFilter) (int, error) {
+	var total int
+	err := r.read(func(st *memState) error {
+		lo, hi := monthIndex(from), monthIndex(to)+1
+		for _, m := range st.subs {
+			if !st.matches(m, f) {
+				continue
+			}
+			amount, _ := m.amount(lo, hi)
+			total += amount
+		}
+		return nil
+	})
+	return total, err
+}
+
+// SumGrouped — как в Postgres: пакеты не хранятся, поэтому AttributeBundles ничего не меняет, а у группы
+// по тарифу ключ всегда пустой
+func (r *memoryRepository) SumGrouped(ctx context.Context, from, to time.Time, f model.SubscriptionFilter, g model.Grouping) ([]model.SummaryGroup, error) {
+	if _, ok := groupExprs[g.By]; !ok {
+		return nil, &model.ErrInvalid{Msg: "unsupported group_by"}
+	}
+
+	res := make([]model.SummaryGroup, 0)
+	err := r.read(func(st *memState) error {
+		lo, hi := monthIndex(from), monthIndex(to)+1
+		totals := make(map[string]int)
+		var nullTotal int
+		var hasNull bool
+		for _, m := range st.subs {
+			if !st.matches(m, f) {
+				continue
+			}
+			amount, ok := m.amount(lo, hi)
+			if !ok {
+				continue
+			}
+			var key *string
+			switch svc := st.services[m.ServiceID]; g.By {
+			case model.GroupByService:
+				key = &svc.Name
+			case model.GroupByCategory:
+				key = svc.Category
+			}
+			if key == nil {
+				nullTotal, hasNull = nullTotal+amount, true
+			} else {
+				totals[*key] += amount
+			}
+		}
+
+		for k, total := range totals {
+			res = append(res, model.SummaryGroup{Key: &k, Total: total})
+		}
+		if hasNull {
+			res = append(res, model.SummaryGroup{Total: nullTotal})
+		}
+		// ORDER BY total DESC, key: NULL — последним среди равных
+		sort.Slice(res, func(i, j int) bool {
+			if res[i].Total != res[j].Total {
+				return res[i].Total > res[j].Total
+			}
+			if res[i].Key == nil || res[j].Key == nil {
+				return res[j].Key == nil && res[i].Key != nil
+			}
+			return *res[i].Key < *res[j].Key
+		})
+		return nil
+	})
+	return res, err
+}
+
+// FindBundleOverlaps — пакеты в памяти не хранятся, пересечений нет
+func (r *memoryRepository) FindBundleOverlaps(ctx context.Context, userID string) ([]model.BundleOverlap, error) {
+	return make([]model.BundleOverlap, 0), nil
+}
+
+func (r *memoryRepository) FindOverlaps(ctx context.Context, userID string) ([]model.SubscriptionOverlap, error) {
+	res := make([]model.SubscriptionOverlap, 0)
+	err := r.read(func(st *memState) error {
+		byUser := make(map[string][]*memSubscription)
+		for _, m := range st.sorted() {
+			if userID == "" || strings.EqualFold(m.UserID, userID) {
+				byUser[m.UserID] = append(byUser[m.UserID], m)
+			}
+		}
+
+		for _, subs := range byUser {
+			for i, a := range subs {
+				alo, ahi := a.months()
+				for _, b := range subs[i+1:] {
+					blo, bhi := b.months()
+					lo, hi := max(alo, blo), min(ahi, bhi)
+					if b.ServiceID != a.ServiceID || lo >= hi {
+						continue
+					}
+					o := model.SubscriptionOverlap{UserID: a.UserID, ServiceName: st.services[a.ServiceID].Name,
+						SubscriptionID: a.ID, OtherID: b.ID, From: monthOf(lo)}
+					if hi != math.MaxInt {
+						to := monthOf(hi - 1)
+						o.To = &to
+					}
+					res = append(res, o)
+				}
+			}
+		}
+		// ORDER BY user_id, a.id, b.id
+		sort.Slice(res, func(i, j int) bool {
+			if res[i].UserID != res[j].UserID {
+				return res[i].UserID < res[j].UserID
+			}
+			if res[i].SubscriptionID != res[j].SubscriptionID {
+				return res[i].SubscriptionID < res[j].SubscriptionID
+			}
+			return res[i].OtherID < res[j].OtherID
+		})
+		return nil
+	})
+	return res, err
+}
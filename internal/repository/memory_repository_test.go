@@ -0,0 +1,199 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"subs-collector/internal/model"
+)
+
+// monthSeriesTotal — эталон как seriesMonthsFrom: по каждому месяцу периода цена последнего изменения
+// с effective_month не позже первого числа месяца, иначе базовая цена
+func monthSeriesTotal(m *memSubscription, from, to time.Time) int {
+	lo, hi := m.months()
+	var total int
+	for i := monthIndex(from); i <= monthIndex(to); i++ {
+		if i < lo || i >= hi {
+			continue
+		}
+		price := m.Price
+		for _, pc := range m.PriceChanges {
+			if !pc.EffectiveMonth.After(monthOf(i)) {
+				price = pc.Price
+			}
+		}
+		total += price
+	}
+	return total
+}
+
+// TestMemorySumTotal_MatchesMonthSeries — тот же эталон, что и для SQL (TestSumTotal_MatchesMonthSeries):
+// случайные подписки с историей цен, в том числе с несколькими изменениями на один месяц
+func TestMemorySumTotal_MatchesMonthSeries(t *testing.T) {
+	ctx := context.Background()
+	r := NewMemorySubscriptionRepository().(*memoryRepository)
+
+	seed := time.Now().UnixNano()
+	t.Logf("seed %d", seed)
+	rnd := rand.New(rand.NewSource(seed))
+
+	users := []string{uuid.NewString(), uuid.NewString()}
+	services := []string{"Alpha", "Beta", "Gamma"}
+	for i := 0; i < 40; i++ {
+		start := randomMonth(rnd)
+		var end *time.Time
+		if rnd.Intn(3) > 0 {
+			e := start.AddDate(0, rnd.Intn(30), rnd.Intn(20))
+			end = &e
+		}
+		s := &model.Subscription{ServiceName: services[rnd.Intn(len(services))], Price: 100 + rnd.Intn(900),
+			UserID: users[rnd.Intn(len(users))], StartDate: start, EndDate: end, AllowOverlap: true}
+		id, err := r.Create(ctx, s)
+		require.NoError(t, err)
+
+		// история цен задаётся напрямую: в памяти нет справочника с изменением цен сервиса
+		m := *r.store.subs[id]
+		em := start
+		for j := rnd.Intn(4); j > 0; j-- {
+			em = em.AddDate(0, 0, rnd.Intn(60))
+			m.PriceChanges = append(m.PriceChanges, model.PriceChange{EffectiveMonth: em, Price: 50 + rnd.Intn(900)})
+			em = em.AddDate(0, 0, 1)
+		}
+		r.store.subs[id] = &m
+	}
+
+	filters := []model.SubscriptionFilter{{}, {UserID: users[0]}, {ServiceName: "beta"}, {UserID: users[1], ServiceName: "Gamma"}}
+	for i := 0; i < 30; i++ {
+		from := randomMonth(rnd)
+		to := from.AddDate(0, rnd.Intn(40), 0)
+		for _, f := range filters {
+			var want int
+			groups := map[string]int{}
+			for _, m := range r.store.subs {
+				if r.store.matches(m, f) {
+					amount := monthSeriesTotal(m, from, to)
+					want += amount
+					groups[r.store.services[m.ServiceID].Name] += amount
+				}
+			}
+
+			got, err := r.SumTotal(ctx, from, to, f)
+			require.NoError(t, err)
+			assert.Equal(t, want, got, "period %s..%s, filter %+v", from, to, f)
+
+			grouped, err := r.SumGrouped(ctx, from, to, f, model.Grouping{By: model.GroupByService})
+			require.NoError(t, err)
+			gotGroups := map[string]int{}
+			for _, g := range grouped {
+				gotGroups[*g.Key] = g.Total
+			}
+			for k, v := range groups {
+				if v == 0 {
+					// группа без активных месяцев в SQL не появляется, с нулевой суммой — может
+					delete(groups, k)
+					delete(gotGroups, k)
+				}
+			}
+			assert.Equal(t, groups, gotGroups)
+		}
+	}
+}
+
+// TestMemoryWithTx_RollsBack — ошибка fn откатывает подписку и созданный для неё сервис,
+// ошибка вложенного WithTx — только его изменения
+func TestMemoryWithTx_RollsBack(t *testing.T) {
+	ctx := context.Background()
+	r := NewMemorySubscriptionRepository().(*memoryRepository)
+	user := uuid.NewString()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	boom := errors.New("boom")
+	err := r.WithTx(ctx, func(tx SubscriptionRepository) error {
+		_, err := tx.Create(ctx, &model.Subscription{ServiceName: "VideoHub", Price: 100, UserID: user, StartDate: start})
+		require.NoError(t, err)
+		return boom
+	})
+	assert.ErrorIs(t, err, boom)
+	assert.Empty(t, r.store.subs)
+	assert.Empty(t, r.store.services)
+
+	err = r.WithTx(ctx, func(tx SubscriptionRepository) error {
+		if _, err := tx.Create(ctx, &model.Subscription{ServiceName: "VideoHub", Price: 100, UserID: user, StartDate: start}); err != nil {
+			return err
+		}
+		inner := tx.WithTx(ctx, func(sp SubscriptionRepository) error {
+			_, err := sp.Create(ctx, &model.Subscription{ServiceName: "MusicBox", Price: 200, UserID: user, StartDate: start})
+			require.NoError(t, err)
+			return boom
+		})
+		assert.ErrorIs(t, inner, boom)
+		return nil
+	})
+	require.NoError(t, err)
+
+	list, err := r.List(ctx, model.SubscriptionFilter{UserID: user})
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "VideoHub", list[0].ServiceName)
+	assert.Len(t, r.store.services, 1)
+}
+
+func TestMemoryRepository_OverlapsAndStrictCatalog(t *testing.T) {
+	ctx := context.Background()
+	r := NewMemorySubscriptionRepository(WithMemoryStrictCatalog(true),
+		WithMemoryCatalog([]model.CatalogEntry{{Name: "Netflix", Aliases: []string{"NFLX"}}}))
+	user := uuid.NewString()
+	month := func(m time.Month) time.Time { return time.Date(2025, m, 1, 0, 0, 0, 0, time.UTC) }
+	end := month(6)
+
+	_, err := r.Create(ctx, &model.Subscription{ServiceName: "Netflx", UserID: user, StartDate: month(1)})
+	var unknown *model.UnknownServiceError
+	require.ErrorAs(t, err, &unknown)
+	assert.Equal(t, []string{"Netflix"}, unknown.Suggestions)
+
+	first, err := r.Create(ctx, &model.Subscription{ServiceName: "Netflix", Price: 100, UserID: user, StartDate: month(1), EndDate: &end})
+	require.NoError(t, err)
+	_, err = r.Create(ctx, &model.Subscription{ServiceName: "nflx", Price: 100, UserID: user, StartDate: month(6)})
+	assert.ErrorIs(t, err, model.ErrOverlap)
+	second, err := r.Create(ctx, &model.Subscription{ServiceName: "nflx", Price: 100, UserID: user, StartDate: month(6), AllowOverlap: true})
+	require.NoError(t, err)
+
+	overlaps, err := r.FindOverlaps(ctx, user)
+	require.NoError(t, err)
+	assert.Equal(t, []model.SubscriptionOverlap{{UserID: user, ServiceName: "Netflix", SubscriptionID: first,
+		OtherID: second, From: month(6), To: &end}}, overlaps)
+}
+
+func TestMemoryRepository_ConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	r := NewMemorySubscriptionRepository()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := &model.Subscription{ServiceName: "VideoHub", Price: 10, UserID: uuid.NewString(), StartDate: start}
+			if _, err := r.Create(ctx, s); err != nil {
+				t.Error(err)
+			}
+			if _, err := r.SumTotal(ctx, start, start, model.SubscriptionFilter{}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	total, err := r.SumTotal(ctx, start, start, model.SubscriptionFilter{ServiceName: "videohub"})
+	require.NoError(t, err)
+	assert.Equal(t, 200, total)
+}
@@ -0,0 +1,87 @@
+package mocks
+
+import (
+	"context"
+
+	"subs-collector/internal/model"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// CatalogRepository — мок репозитория справочника сервисов
+type CatalogRepository struct {
+	mock.Mock
+}
+
+func (m *CatalogRepository) ListServices(ctx context.Context) ([]model.Service, error) {
+	args := m.Called(ctx)
+	if v := args.Get(0); v != nil {
+		return v.([]model.Service), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *CatalogRepository) GetService(ctx context.Context, id int) (*model.Service, error) {
+	args := m.Called(ctx, id)
+	if v := args.Get(0); v != nil {
+		return v.(*model.Service), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *CatalogRepository) SetLabels(ctx context.Context, id int, category *string, tags []string) error {
+	args := m.Called(ctx, id, category, tags)
+	return args.Error(0)
+}
+
+func (m *CatalogRepository) SetComponents(ctx context.Context, bundleID int, components []model.BundleComponent) error {
+	args := m.Called(ctx, bundleID, components)
+	return args.Error(0)
+}
+
+func (m *CatalogRepository) ListPlans(ctx context.Context, serviceID int) ([]model.Plan, error) {
+	args := m.Called(ctx, serviceID)
+	if v := args.Get(0); v != nil {
+		return v.([]model.Plan), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *CatalogRepository) CreatePlan(ctx context.Context, p *model.Plan) (int, error) {
+	args := m.Called(ctx, p)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *CatalogRepository) ImportCatalogEntry(ctx context.Context, e model.CatalogEntry, version int, dryRun bool) (*model.ImportResult, error) {
+	args := m.Called(ctx, e, version, dryRun)
+	if v := args.Get(0); v != nil {
+		return v.(*model.ImportResult), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *CatalogRepository) ApplyPriceChange(ctx context.Context, c model.ServicePriceChange, dryRun bool) (*model.PriceChangeResult, error) {
+	args := m.Called(ctx, c, dryRun)
+	if v := args.Get(0); v != nil {
+		return v.(*model.PriceChangeResult), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *CatalogRepository) SetNormalizedName(ctx context.Context, id int, normalized string) error {
+	args := m.Called(ctx, id, normalized)
+	return args.Error(0)
+}
+
+func (m *CatalogRepository) AddAlias(ctx context.Context, serviceID int, alias string) error {
+	args := m.Called(ctx, serviceID, alias)
+	return args.Error(0)
+}
+
+func (m *CatalogRepository) MergeServices(ctx context.Context, sourceID, targetID int, dryRun bool) (*model.MergeResult, error) {
+	args := m.Called(ctx, sourceID, targetID, dryRun)
+	if v := args.Get(0); v != nil {
+		return v.(*model.MergeResult), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"subs-collector/internal/model"
+	"subs-collector/internal/repository"
 
 	"github.com/stretchr/testify/mock"
 )
@@ -37,15 +38,78 @@ func (m *SubscriptionRepository) Delete(ctx context.Context, id int) error {
 	return args.Error(0)
 }
 
-func (m *SubscriptionRepository) List(ctx context.Context, userID, serviceName string) ([]model.Subscription, error) {
-	args := m.Called(ctx, userID, serviceName)
+func (m *SubscriptionRepository) List(ctx context.Context, f model.SubscriptionFilter) ([]model.Subscription, error) {
+	args := m.Called(ctx, f)
 	if v := args.Get(0); v != nil {
 		return v.([]model.Subscription), args.Error(1)
 	}
 	return nil, args.Error(1)
 }
 
-func (m *SubscriptionRepository) SumTotal(ctx context.Context, from, to time.Time, userID, serviceName string) (int, error) {
-	args := m.Called(ctx, from, to, userID, serviceName)
+// ListEach отдаёт в fn подписки, заданные первым значением Return
+func (m *SubscriptionRepository) ListEach(ctx context.Context, f model.SubscriptionFilter, fn func(model.Subscription) error) error {
+	args := m.Called(ctx, f)
+	if v := args.Get(0); v != nil {
+		for _, s := range v.([]model.Subscription) {
+			if err := fn(s); err != nil {
+				return err
+			}
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *SubscriptionRepository) SumTotal(ctx context.Context, from, to time.Time, f model.SubscriptionFilter) (int, error) {
+	args := m.Called(ctx, from, to, f)
 	return args.Int(0), args.Error(1)
 }
+
+func (m *SubscriptionRepository) SumGrouped(ctx context.Context, from, to time.Time, f model.SubscriptionFilter, g model.Grouping) ([]model.SummaryGroup, error) {
+	args := m.Called(ctx, from, to, f, g)
+	if v := args.Get(0); v != nil {
+		return v.([]model.SummaryGroup), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *SubscriptionRepository) FindBundleOverlaps(ctx context.Context, userID string) ([]model.BundleOverlap, error) {
+	args := m.Called(ctx, userID)
+	if v := args.Get(0); v != nil {
+		return v.([]model.BundleOverlap), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *SubscriptionRepository) FindOverlaps(ctx context.Context, userID string) ([]model.SubscriptionOverlap, error) {
+	args := m.Called(ctx, userID)
+	if v := args.Get(0); v != nil {
+		return v.([]model.SubscriptionOverlap), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *SubscriptionRepository) Import(ctx context.Context, subs []*model.Subscription, o model.ImportOptions) ([]model.ImportRowResult, bool, error) {
+	args := m.Called(ctx, subs, o)
+	if v := args.Get(0); v != nil {
+		return v.([]model.ImportRowResult), args.Bool(1), args.Error(2)
+	}
+	return nil, args.Bool(1), args.Error(2)
+}
+
+func (m *SubscriptionRepository) Batch(ctx context.Context, ops []model.BatchOp, o model.BatchOptions) ([]model.BatchOpResult, bool, error) {
+	args := m.Called(ctx, ops, o)
+	if v := args.Get(0); v != nil {
+		return v.([]model.BatchOpResult), args.Bool(1), args.Error(2)
+	}
+	return nil, args.Bool(1), args.Error(2)
+}
+
+// WithTx вызывает fn с этим же моком. Ошибка fn возвращается как есть — транзакция «откатывается»,
+// иначе возвращается ошибка из Return (например, ошибка фиксации).
+func (m *SubscriptionRepository) WithTx(ctx context.Context, fn func(repository.SubscriptionRepository) error) error {
+	args := m.Called(ctx)
+	if err := fn(m); err != nil {
+		return err
+	}
+	return args.Error(0)
+}
@@ -0,0 +1,403 @@
+// Package repotest — контрактные тесты SubscriptionRepository: любая реализация (Postgres, память, файл,
+// обёртки над ними) должна вести себя одинаково с точки зрения сервисного слоя.
+package repotest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"subs-collector/internal/model"
+	"subs-collector/internal/repository"
+)
+
+// Factory возвращает репозиторий для одного теста. Все сервисы, которые создаст тест, называются
+// с prefix: реализация с общей базой убирает по нему за собой данные (t.Cleanup).
+type Factory func(t *testing.T, prefix string) repository.SubscriptionRepository
+
+// Run прогоняет контракт на репозиториях из newRepo. Тесты не рассчитывают на пустое хранилище:
+// у каждого свои пользователи и сервисы.
+func Run(t *testing.T, newRepo Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, c *contract)
+	}{
+		{"CRUD", testCRUD},
+		{"Overlaps", testOverlaps},
+		{"Filters", testFilters},
+		{"SumTotal", testSumTotal},
+		{"SumGrouped", testSumGrouped},
+		{"WithTx", testWithTx},
+		{"Import", testImport},
+		{"Batch", testBatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix := "contract-" + uuid.NewString()[:8] + "-"
+			tt.fn(t, &contract{repo: newRepo(t, prefix), prefix: prefix, ctx: context.Background()})
+		})
+	}
+}
+
+type contract struct {
+	repo   repository.SubscriptionRepository
+	prefix string
+	ctx    context.Context
+}
+
+// service — имя сервиса теста
+func (c *contract) service(name string) string {
+	return c.prefix + name
+}
+
+func (c *contract) create(t *testing.T, s model.Subscription) int {
+	t.Helper()
+	id, err := c.repo.Create(c.ctx, &s)
+	require.NoError(t, err)
+	require.Positive(t, id)
+	return id
+}
+
+// month — первое число месяца 2025 года, смещение считается от января
+func month(offset int) time.Time {
+	return time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC).AddDate(0, offset, 0)
+}
+
+func ptr(t time.Time) *time.Time { return &t }
+
+func ids(list []model.Subscription) []int {
+	res := make([]int, 0, len(list))
+	for _, s := range list {
+		res = append(res, s.ID)
+	}
+	return res
+}
+
+func testCRUD(t *testing.T, c *contract) {
+	user := uuid.NewString()
+	name := c.service("Video")
+	id := c.create(t, model.Subscription{ServiceName: name, Price: 100, UserID: user, StartDate: month(0), EndDate: ptr(month(5))})
+
+	got, err := c.repo.GetByID(c.ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, id, got.ID)
+	assert.Equal(t, name, got.ServiceName)
+	assert.Equal(t, 100, got.Price)
+	assert.Equal(t, user, got.UserID)
+	assert.True(t, month(0).Equal(got.StartDate), "start %s", got.StartDate)
+	require.NotNil(t, got.EndDate)
+	assert.True(t, month(5).Equal(*got.EndDate), "end %s", *got.EndDate)
+
+	// имя сервиса сравнивается без учёта регистра: подписка попадает в тот же сервис
+	require.NoError(t, c.repo.Update(c.ctx, id, &model.Subscription{ServiceName: "  " + c.service("VIDEO"), Price: 150,
+		UserID: user, StartDate: month(1)}))
+	got, err = c.repo.GetByID(c.ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, name, got.ServiceName)
+	assert.Equal(t, 150, got.Price)
+	assert.True(t, month(1).Equal(got.StartDate), "start %s", got.StartDate)
+	assert.Nil(t, got.EndDate)
+
+	_, err = c.repo.Create(c.ctx, &model.Subscription{ServiceName: name, Price: 1, UserID: "not-a-uuid", StartDate: month(0)})
+	assert.Error(t, err)
+	_, err = c.repo.Create(c.ctx, &model.Subscription{ServiceName: c.service("Music"), Price: 1, UserID: user,
+		StartDate: month(3), EndDate: ptr(month(1))})
+	assert.Error(t, err, "окончание раньше начала")
+
+	require.NoError(t, c.repo.Delete(c.ctx, id))
+	_, err = c.repo.GetByID(c.ctx, id)
+	assert.ErrorIs(t, err, model.ErrNotFound)
+	assert.ErrorIs(t, c.repo.Delete(c.ctx, id), model.ErrNotFound)
+	err = c.repo.Update(c.ctx, id, &model.Subscription{ServiceName: name, Price: 1, UserID: user, StartDate: month(0)})
+	assert.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func testOverlaps(t *testing.T, c *contract) {
+	user := uuid.NewString()
+	name := c.service("Video")
+	first := c.create(t, model.Subscription{ServiceName: name, Price: 100, UserID: user, StartDate: month(0), EndDate: ptr(month(2))})
+
+	// месяц окончания входит в подписку
+	_, err := c.repo.Create(c.ctx, &model.Subscription{ServiceName: name, Price: 100, UserID: user, StartDate: month(2)})
+	assert.ErrorIs(t, err, model.ErrOverlap)
+
+	// соседний месяц, другой пользователь и другой сервис не пересекаются
+	c.create(t, model.Subscription{ServiceName: name, Price: 100, UserID: user, StartDate: month(3), EndDate: ptr(month(4))})
+	c.create(t, model.Subscription{ServiceName: name, Price: 100, UserID: uuid.NewString(), StartDate: month(0)})
+	c.create(t, model.Subscription{ServiceName: c.service("Music"), Price: 100, UserID: user, StartDate: month(0)})
+
+	// своя же подписка при изменении не мешает
+	require.NoError(t, c.repo.Update(c.ctx, first, &model.Subscription{ServiceName: name, Price: 120, UserID: user,
+		StartDate: month(0), EndDate: ptr(month(2))}))
+	err = c.repo.Update(c.ctx, first, &model.Subscription{ServiceName: name, Price: 120, UserID: user, StartDate: month(0)})
+	assert.ErrorIs(t, err, model.ErrOverlap)
+
+	accepted := c.create(t, model.Subscription{ServiceName: name, Price: 100, UserID: user, StartDate: month(1), AllowOverlap: true})
+	overlaps, err := c.repo.FindOverlaps(c.ctx, user)
+	require.NoError(t, err)
+	require.Len(t, overlaps, 2)
+	assert.Equal(t, first, overlaps[0].SubscriptionID)
+	assert.Equal(t, accepted, overlaps[0].OtherID)
+	assert.Equal(t, name, overlaps[0].ServiceName)
+	assert.True(t, month(1).Equal(overlaps[0].From), "from %s", overlaps[0].From)
+	require.NotNil(t, overlaps[0].To)
+	assert.True(t, month(2).Equal(*overlaps[0].To), "to %s", *overlaps[0].To)
+	assert.Equal(t, accepted, overlaps[1].OtherID)
+	assert.True(t, month(3).Equal(overlaps[1].From), "from %s", overlaps[1].From)
+
+	none, err := c.repo.FindOverlaps(c.ctx, uuid.NewString())
+	require.NoError(t, err)
+	assert.Empty(t, none)
+}
+
+func testFilters(t *testing.T, c *contract) {
+	user, other := uuid.NewString(), uuid.NewString()
+	video, music := c.service("Video"), c.service("Music")
+	early := c.create(t, model.Subscription{ServiceName: video, Price: 100, UserID: user, StartDate: month(0), EndDate: ptr(month(1))})
+	open := c.create(t, model.Subscription{ServiceName: music, Price: 50, UserID: user, StartDate: month(3)})
+	late := c.create(t, model.Subscription{ServiceName: video, Price: 100, UserID: user, StartDate: month(6), EndDate: ptr(month(8))})
+	foreign := c.create(t, model.Subscription{ServiceName: video, Price: 100, UserID: other, StartDate: month(0)})
+
+	cases := []struct {
+		name string
+		f    model.SubscriptionFilter
+		want []int
+	}{
+		{"user", model.SubscriptionFilter{UserID: user}, []int{early, open, late}},
+		{"service any case", model.SubscriptionFilter{ServiceName: c.service("VIDEO")}, []int{early, late, foreign}},
+		{"user and service", model.SubscriptionFilter{UserID: other, ServiceName: video}, []int{foreign}},
+		{"unknown service", model.SubscriptionFilter{UserID: user, ServiceName: c.service("Unknown")}, []int{}},
+		{"active from", model.SubscriptionFilter{UserID: user, ActiveFrom: month(2)}, []int{open, late}},
+		{"active to", model.SubscriptionFilter{UserID: user, ActiveTo: month(2)}, []int{early}},
+		{"active month", model.SubscriptionFilter{UserID: user, ActiveFrom: month(1), ActiveTo: month(1)}, []int{early}},
+		{"active within month", model.SubscriptionFilter{UserID: user, ActiveFrom: month(7).AddDate(0, 0, 20),
+			ActiveTo: month(7).AddDate(0, 0, 25)}, []int{open, late}},
+		{"active gap", model.SubscriptionFilter{UserID: user, ServiceName: video, ActiveFrom: month(2), ActiveTo: month(5)}, []int{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			list, err := c.repo.List(c.ctx, tc.f)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, ids(list))
+
+			var each []model.Subscription
+			require.NoError(t, c.repo.ListEach(c.ctx, tc.f, func(s model.Subscription) error {
+				each = append(each, s)
+				return nil
+			}))
+			assert.Equal(t, tc.want, ids(each), "ListEach отдаёт то же, что List")
+		})
+	}
+
+	stop := errors.New("stop")
+	var seen int
+	err := c.repo.ListEach(c.ctx, model.SubscriptionFilter{UserID: user}, func(model.Subscription) error {
+		seen++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, seen)
+}
+
+func testSumTotal(t *testing.T, c *contract) {
+	user := uuid.NewString()
+	name := c.service("Video")
+	// 100 за январь–март, 40 с мая без окончания; подписка с середины месяца считается за весь месяц
+	c.create(t, model.Subscription{ServiceName: name, Price: 100, UserID: user, StartDate: month(0), EndDate: ptr(month(2))})
+	c.create(t, model.Subscription{ServiceName: name, Price: 40, UserID: user, StartDate: month(4).AddDate(0, 0, 14)})
+
+	cases := []struct {
+		name     string
+		from, to time.Time
+		want     int
+	}{
+		{"whole year", month(0), month(11), 300 + 8*40},
+		{"same month", month(1), month(1), 100},
+		{"same month mid dates", month(1).AddDate(0, 0, 10), month(1).AddDate(0, 0, 20), 100},
+		{"end month included", month(2), month(2), 100},
+		{"month after end", month(3), month(3), 0},
+		{"start month of mid-month start", month(4), month(4), 40},
+		{"open-ended far ahead", month(12), month(23), 12 * 40},
+		{"across both", month(2), month(5), 100 + 2*40},
+		{"before any", month(-12), month(-1), 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := c.repo.SumTotal(c.ctx, tc.from, tc.to, model.SubscriptionFilter{UserID: user})
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	got, err := c.repo.SumTotal(c.ctx, month(0), month(11), model.SubscriptionFilter{UserID: uuid.NewString()})
+	require.NoError(t, err)
+	assert.Zero(t, got, "нет подписок")
+	got, err = c.repo.SumTotal(c.ctx, month(0), month(11), model.SubscriptionFilter{UserID: user, ServiceName: c.service("Music")})
+	require.NoError(t, err)
+	assert.Zero(t, got, "фильтр по другому сервису")
+}
+
+func testSumGrouped(t *testing.T, c *contract) {
+	user := uuid.NewString()
+	video, music, news := c.service("Video"), c.service("Music"), c.service("News")
+	c.create(t, model.Subscription{ServiceName: video, Price: 100, UserID: user, StartDate: month(0), EndDate: ptr(month(1))})
+	c.create(t, model.Subscription{ServiceName: music, Price: 50, UserID: user, StartDate: month(0)})
+	c.create(t, model.Subscription{ServiceName: news, Price: 10, UserID: user, StartDate: month(6)})
+
+	groups, err := c.repo.SumGrouped(c.ctx, month(0), month(3), model.SubscriptionFilter{UserID: user},
+		model.Grouping{By: model.GroupByService})
+	require.NoError(t, err)
+	// по убыванию суммы, равные — по ключу; сервис без активных месяцев в период не попадает
+	require.Len(t, groups, 2)
+	for i, want := range []struct {
+		key   string
+		total int
+	}{{music, 200}, {video, 200}} {
+		require.NotNil(t, groups[i].Key)
+		assert.Equal(t, want.key, *groups[i].Key)
+		assert.Equal(t, want.total, groups[i].Total)
+	}
+
+	total, err := c.repo.SumTotal(c.ctx, month(0), month(3), model.SubscriptionFilter{UserID: user})
+	require.NoError(t, err)
+	assert.Equal(t, 400, total, "сумма групп равна SumTotal")
+
+	_, err = c.repo.SumGrouped(c.ctx, month(0), month(3), model.SubscriptionFilter{UserID: user}, model.Grouping{By: "color"})
+	var invalid *model.ErrInvalid
+	assert.ErrorAs(t, err, &invalid)
+}
+
+func testWithTx(t *testing.T, c *contract) {
+	user := uuid.NewString()
+	boom := errors.New("boom")
+
+	err := c.repo.WithTx(c.ctx, func(tx repository.SubscriptionRepository) error {
+		if _, err := tx.Create(c.ctx, &model.Subscription{ServiceName: c.service("Video"), Price: 100, UserID: user, StartDate: month(0)}); err != nil {
+			return err
+		}
+		return boom
+	})
+	assert.ErrorIs(t, err, boom)
+	list, err := c.repo.List(c.ctx, model.SubscriptionFilter{UserID: user})
+	require.NoError(t, err)
+	assert.Empty(t, list, "ошибка fn откатывает транзакцию")
+
+	var kept int
+	err = c.repo.WithTx(c.ctx, func(tx repository.SubscriptionRepository) error {
+		id, err := tx.Create(c.ctx, &model.Subscription{ServiceName: c.service("Video"), Price: 100, UserID: user, StartDate: month(0)})
+		if err != nil {
+			return err
+		}
+		kept = id
+		// транзакция видит свои изменения
+		if _, err := tx.GetByID(c.ctx, id); err != nil {
+			return err
+		}
+		inner := tx.WithTx(c.ctx, func(sp repository.SubscriptionRepository) error {
+			if _, err := sp.Create(c.ctx, &model.Subscription{ServiceName: c.service("Music"), Price: 50, UserID: user, StartDate: month(0)}); err != nil {
+				return err
+			}
+			return boom
+		})
+		if !errors.Is(inner, boom) {
+			return inner
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	list, err = c.repo.List(c.ctx, model.SubscriptionFilter{UserID: user})
+	require.NoError(t, err)
+	assert.Equal(t, []int{kept}, ids(list), "ошибка вложенного WithTx откатывает только его изменения")
+
+	assert.PanicsWithValue(t, "boom", func() {
+		_ = c.repo.WithTx(c.ctx, func(tx repository.SubscriptionRepository) error {
+			if err := tx.Delete(c.ctx, kept); err != nil {
+				return err
+			}
+			if _, err := tx.Create(c.ctx, &model.Subscription{ServiceName: c.service("Music"), Price: 50, UserID: user, StartDate: month(0)}); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	})
+	list, err = c.repo.List(c.ctx, model.SubscriptionFilter{UserID: user})
+	require.NoError(t, err)
+	assert.Equal(t, []int{kept}, ids(list), "паника fn откатывает транзакцию")
+}
+
+func testImport(t *testing.T, c *contract) {
+	user := uuid.NewString()
+	name := c.service("Video")
+	subs := func() []*model.Subscription {
+		return []*model.Subscription{
+			{ServiceName: name, Price: 100, UserID: user, StartDate: month(0), EndDate: ptr(month(2))},
+			{ServiceName: name, Price: 1, UserID: "not-a-uuid", StartDate: month(0)},
+			{ServiceName: name, Price: 100, UserID: user, StartDate: month(1)},
+		}
+	}
+
+	// при all_or_nothing ошибка строки откатывает записанные, dry run ничего не сохраняет
+	res, committed, err := c.repo.Import(c.ctx, subs(), model.ImportOptions{AllOrNothing: true, RetryOverlap: true})
+	require.NoError(t, err)
+	assert.False(t, committed)
+	assert.Equal(t, []string{model.ImportRowRolledBack, model.ImportRowFailed, model.ImportRowRolledBack},
+		[]string{res[0].Status, res[1].Status, res[2].Status})
+	res, committed, err = c.repo.Import(c.ctx, subs(), model.ImportOptions{DryRun: true})
+	require.NoError(t, err)
+	assert.False(t, committed)
+	assert.Equal(t, []string{model.ImportRowValid, model.ImportRowFailed, model.ImportRowFailed},
+		[]string{res[0].Status, res[1].Status, res[2].Status})
+	assert.ErrorIs(t, res[2].Err, model.ErrOverlap)
+	list, err := c.repo.List(c.ctx, model.SubscriptionFilter{UserID: user})
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	// построчно ошибка откатывает только свою строку, пересечение повторяется с AllowOverlap
+	res, committed, err = c.repo.Import(c.ctx, subs(), model.ImportOptions{RetryOverlap: true})
+	require.NoError(t, err)
+	assert.True(t, committed)
+	assert.Equal(t, []string{model.ImportRowCreated, model.ImportRowFailed, model.ImportRowCreated},
+		[]string{res[0].Status, res[1].Status, res[2].Status})
+	assert.True(t, res[2].Overlap)
+	list, err = c.repo.List(c.ctx, model.SubscriptionFilter{UserID: user})
+	require.NoError(t, err)
+	assert.Equal(t, []int{res[0].ID, res[2].ID}, ids(list))
+}
+
+func testBatch(t *testing.T, c *contract) {
+	user := uuid.NewString()
+	name := c.service("Video")
+	id := c.create(t, model.Subscription{ServiceName: name, Price: 100, UserID: user, StartDate: month(0)})
+	ops := func() []model.BatchOp {
+		return []model.BatchOp{
+			{Op: model.BatchUpdate, ID: id, Subscription: model.Subscription{ServiceName: name, Price: 150, UserID: user, StartDate: month(6)}},
+			{Op: model.BatchDelete, ID: -1},
+			{Op: model.BatchCreate, Subscription: model.Subscription{ServiceName: name, Price: 100, UserID: user, StartDate: month(0), EndDate: ptr(month(2))}},
+		}
+	}
+
+	res, committed, err := c.repo.Batch(c.ctx, ops(), model.BatchOptions{})
+	require.NoError(t, err)
+	assert.False(t, committed)
+	assert.Equal(t, []string{model.BatchOpRolledBack, model.BatchOpFailed, model.BatchOpSkipped},
+		[]string{res[0].Status, res[1].Status, res[2].Status})
+	got, err := c.repo.GetByID(c.ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, 100, got.Price, "изменение откатилось вместе с пакетом")
+
+	res, committed, err = c.repo.Batch(c.ctx, ops(), model.BatchOptions{ContinueOnError: true})
+	require.NoError(t, err)
+	assert.True(t, committed)
+	assert.Equal(t, []string{model.BatchOpOK, model.BatchOpFailed, model.BatchOpOK},
+		[]string{res[0].Status, res[1].Status, res[2].Status})
+	assert.ErrorIs(t, res[1].Err, model.ErrNotFound)
+	list, err := c.repo.List(c.ctx, model.SubscriptionFilter{UserID: user})
+	require.NoError(t, err)
+	assert.Equal(t, []int{id, res[2].ID}, ids(list))
+}
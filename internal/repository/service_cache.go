@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type serviceEntry struct {
+	name    string
+	id      int
+	expires time.Time
+}
+
+// ServiceCache — ограниченный LRU-кэш нормализованное имя (или алиас) → id сервиса. Общий для
+// репозиториев подписок и справочника: изменения справочника через CatalogRepository сбрасывают его
+// целиком, изменения из другого процесса (admin) — уведомление services_changed, см. Listen.
+// Нулевой *ServiceCache — отключённый кэш.
+type ServiceCache struct {
+	ttl  time.Duration
+	size int
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // от недавно использованных к давним
+	gen     uint64     // поколение: id, найденный до сброса, после сброса не кэшируется
+}
+
+// NewServiceCache создаёт кэш на size имён с временем жизни ttl; size или ttl 0 — кэш отключён (nil)
+func NewServiceCache(size int, ttl time.Duration) *ServiceCache {
+	if size <= 0 || ttl <= 0 {
+		return nil
+	}
+	return &ServiceCache{
+		ttl:     ttl,
+		size:    size,
+		now:     time.Now,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// get возвращает id по нормализованному имени и текущее поколение для последующего put
+func (c *ServiceCache) get(name string) (int, bool, uint64) {
+	if c == nil {
+		return 0, false, 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[name]; ok {
+		e := el.Value.(*serviceEntry)
+		if c.now().Before(e.expires) {
+			c.lru.MoveToFront(el)
+			return e.id, true, c.gen
+		}
+		c.remove(el)
+	}
+	return 0, false, c.gen
+}
+
+// put запоминает id, если с момента get (поколение gen) кэш не сбрасывался
+func (c *ServiceCache) put(name string, id int, gen uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen != gen {
+		return
+	}
+	if el, ok := c.entries[name]; ok {
+		c.remove(el)
+	}
+	c.entries[name] = c.lru.PushFront(&serviceEntry{name: name, id: id, expires: c.now().Add(c.ttl)})
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *ServiceCache) generation() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// Invalidate сбрасывает кэш
+func (c *ServiceCache) Invalidate() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+func (c *ServiceCache) remove(el *list.Element) {
+	delete(c.entries, el.Value.(*serviceEntry).name)
+	c.lru.Remove(el)
+}
+
+// servicesChangedChannel — канал уведомлений об изменениях справочника (миграция 015)
+const servicesChangedChannel = "services_changed"
+
+// Listen подписывается на services_changed и сбрасывает кэш по каждому уведомлению. Блокируется до отмены ctx
+// или ошибки соединения; кэш сбрасывается и сразу после подписки — уведомления, пропущенные без соединения,
+// не теряются. Вызывающий перезапускает Listen после ошибки.
+func (c *ServiceCache) Listen(ctx context.Context, pool *pgxpool.Pool) error {
+	if c == nil {
+		return nil
+	}
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// соединение в режиме LISTEN в пул не возвращаем
+	defer func() { _ = conn.Hijack().Close(context.Background()) }()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+servicesChangedChannel); err != nil {
+		return err
+	}
+	c.Invalidate()
+	for {
+		if _, err := conn.Conn().WaitForNotification(ctx); err != nil {
+			return err
+		}
+		c.Invalidate()
+	}
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"subs-collector/internal/model"
+)
+
+func TestServiceCache_EvictsAndExpires(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewServiceCache(2, time.Minute)
+	c.now = func() time.Time { return now }
+
+	_, _, gen := c.get("netflix")
+	c.put("netflix", 1, gen)
+	c.put("spotify", 2, gen)
+	_, ok, _ := c.get("netflix") // netflix становится недавним
+	assert.True(t, ok)
+	c.put("youtube", 3, gen)
+
+	_, ok, _ = c.get("spotify")
+	assert.False(t, ok, "давняя запись вытесняется")
+	id, ok, _ := c.get("netflix")
+	assert.True(t, ok)
+	assert.Equal(t, 1, id)
+
+	now = now.Add(time.Minute)
+	_, ok, _ = c.get("netflix")
+	assert.False(t, ok, "запись истекает по TTL")
+}
+
+func TestServiceCache_InvalidateDropsStalePut(t *testing.T) {
+	c := NewServiceCache(10, time.Minute)
+	_, _, gen := c.get("netflix")
+	c.Invalidate()
+	c.put("netflix", 1, gen)
+
+	_, ok, _ := c.get("netflix")
+	assert.False(t, ok, "id, найденный до сброса, не кэшируется")
+
+	var disabled *ServiceCache
+	disabled.put("netflix", 1, 0)
+	disabled.Invalidate()
+	_, ok, _ = disabled.get("netflix")
+	assert.False(t, ok)
+	assert.Nil(t, NewServiceCache(10, 0))
+}
+
+// TestEnsureService_Cached — имя и алиас дают один id, сервис из откаченной транзакции в кэш не попадает,
+// добавление алиаса через справочник сбрасывает кэш
+func TestEnsureService_Cached(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	cache := NewServiceCache(100, time.Minute)
+	r := NewSubscriptionRepository(pool, WithServiceCache(cache)).(*subscriptionRepository)
+	catalog := NewCatalogRepository(pool, WithCatalogServiceCache(cache))
+
+	service := "cache-" + uuid.NewString()[:8]
+	alias := service + "-alias"
+	t.Cleanup(func() {
+		_, _ = pool.Exec(ctx, `DELETE FROM services WHERE normalized_name=$1`, model.NormalizeServiceName(service))
+	})
+
+	boom := errors.New("boom")
+	err := r.WithTx(ctx, func(tx SubscriptionRepository) error {
+		txr := tx.(*subscriptionRepository)
+		_, err := txr.ensureService(ctx, txr.db, service)
+		require.NoError(t, err)
+		return boom
+	})
+	require.ErrorIs(t, err, boom)
+	_, ok, _ := cache.get(model.NormalizeServiceName(service))
+	assert.False(t, ok, "откаченный сервис не кэшируется")
+
+	id, err := r.ensureService(ctx, r.db, service)
+	require.NoError(t, err)
+	again, err := r.ensureService(ctx, r.db, "  "+service+" ")
+	require.NoError(t, err)
+	assert.Equal(t, id, again)
+
+	require.NoError(t, catalog.AddAlias(ctx, id, alias))
+	_, ok, _ = cache.get(model.NormalizeServiceName(service))
+	assert.False(t, ok, "изменение справочника сбрасывает кэш")
+	byAlias, err := r.ensureService(ctx, r.db, alias)
+	require.NoError(t, err)
+	assert.Equal(t, id, byAlias)
+}
+
+// TestServiceCache_ListenInvalidates — удаление сервиса в другом соединении (как командой admin) сбрасывает кэш
+func TestServiceCache_ListenInvalidates(t *testing.T) {
+	pool := testPool(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cache := NewServiceCache(100, time.Minute)
+	r := NewSubscriptionRepository(pool, WithServiceCache(cache)).(*subscriptionRepository)
+
+	service := "listen-" + uuid.NewString()[:8]
+	normalized := model.NormalizeServiceName(service)
+	t.Cleanup(func() {
+		_, _ = pool.Exec(context.Background(), `DELETE FROM services WHERE normalized_name=$1`, normalized)
+	})
+
+	gen := cache.generation()
+	done := make(chan error, 1)
+	go func() { done <- cache.Listen(ctx, pool) }()
+	require.Eventually(t, func() bool { return cache.generation() != gen }, 5*time.Second, 10*time.Millisecond,
+		"подписка сбрасывает кэш")
+
+	_, err := r.ensureService(ctx, r.db, service)
+	require.NoError(t, err)
+	_, ok, _ := cache.get(normalized)
+	require.True(t, ok)
+
+	_, err = pool.Exec(ctx, `DELETE FROM services WHERE normalized_name=$1`, normalized)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, ok, _ := cache.get(normalized)
+		return !ok
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
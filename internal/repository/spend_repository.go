@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SpendRepository обслуживает предрасчитанную таблицу monthly_spend. Строки поддерживаются триггерами
+// на подписках и истории цен, здесь — горизонт развёртки бессрочных подписок и полный пересчёт.
+type SpendRepository interface {
+	Horizon(ctx context.Context) (time.Time, error)
+	Rebuild(ctx context.Context, horizon time.Time) (int64, error)
+}
+
+type spendRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewSpendRepository(pool *pgxpool.Pool) SpendRepository {
+	return &spendRepository{pool: pool}
+}
+
+// Horizon возвращает первый месяц, не покрытый monthly_spend
+func (r *spendRepository) Horizon(ctx context.Context) (time.Time, error) {
+	return spendHorizon(ctx, r.pool)
+}
+
+// Rebuild пересчитывает monthly_spend с нуля до месяца horizon (не включая его), возвращает число строк
+func (r *spendRepository) Rebuild(ctx context.Context, horizon time.Time) (int64, error) {
+	var n int64
+	err := r.pool.QueryRow(ctx, `SELECT monthly_spend_rebuild($1::date)`, monthStart(horizon)).Scan(&n)
+	return n, err
+}
+
+func spendHorizon(ctx context.Context, q querier) (time.Time, error) {
+	var horizon time.Time
+	err := q.QueryRow(ctx, `SELECT horizon FROM monthly_spend_state`).Scan(&horizon)
+	return horizon, err
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"subs-collector/internal/model"
+)
+
+// errRollback — fn для WithTx возвращает её, чтобы отменить транзакцию без ошибки для вызывающего
+var errRollback = errors.New("rollback")
+
+// Batch выполняет операции в одной транзакции, каждую — в своей точке сохранения. Без o.ContinueOnError
+// первая ошибка откатывает пакет: выполненные операции получают статус rolled_back, оставшиеся — skipped.
+// С o.ContinueOnError откатываются только неудавшиеся операции. Index в результатах не заполняется;
+// второй результат — были ли изменения сохранены.
+func (r *subscriptionRepository) Batch(ctx context.Context, ops []model.BatchOp, o model.BatchOptions) ([]model.BatchOpResult, bool, error) {
+	return batchSubscriptions(ctx, r, ops, o)
+}
+
+// batchSubscriptions — Batch поверх WithTx репозитория repo, общий для всех хранилищ
+func batchSubscriptions(ctx context.Context, repo SubscriptionRepository, ops []model.BatchOp, o model.BatchOptions) ([]model.BatchOpResult, bool, error) {
+	var res []model.BatchOpResult
+	err := repo.WithTx(ctx, func(tx SubscriptionRepository) error {
+		res = make([]model.BatchOpResult, len(ops))
+		for i := range ops {
+			res[i] = model.BatchOpResult{Op: ops[i].Op, Status: model.BatchOpSkipped, ID: ops[i].ID}
+		}
+		for i := range ops {
+			op := &ops[i]
+			id, err := writeSavepoint(ctx, tx, &op.Subscription, o.RetryOverlap, func(sp SubscriptionRepository) (int, error) {
+				return batchOp(ctx, sp, op)
+			})
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				res[i].Status, res[i].Err = model.BatchOpFailed, err
+				if o.ContinueOnError {
+					continue
+				}
+				for j := 0; j < i; j++ {
+					res[j].Status = model.BatchOpRolledBack
+					if res[j].Op == model.BatchCreate {
+						res[j].ID = 0
+					}
+				}
+				return errRollback
+			}
+			res[i].Status, res[i].ID, res[i].Overlap = model.BatchOpOK, id, op.Subscription.AllowOverlap
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errRollback) {
+		return nil, false, err
+	}
+	return res, err == nil, nil
+}
+
+// batchOp выполняет операцию через repo, возвращает id подписки
+func batchOp(ctx context.Context, repo SubscriptionRepository, op *model.BatchOp) (int, error) {
+	switch op.Op {
+	case model.BatchCreate:
+		return repo.Create(ctx, &op.Subscription)
+	case model.BatchUpdate:
+		return op.ID, repo.Update(ctx, op.ID, &op.Subscription)
+	case model.BatchDelete:
+		return op.ID, repo.Delete(ctx, op.ID)
+	}
+	return 0, &model.ErrInvalid{Msg: fmt.Sprintf("unknown op %q", op.Op)}
+}
+
+// writeSavepoint выполняет write в точке сохранения tx: ошибка откатывает только её.
+// При пересечении и retryOverlap повторяет запись s с AllowOverlap.
+func writeSavepoint(ctx context.Context, tx SubscriptionRepository, s *model.Subscription, retryOverlap bool,
+	write func(SubscriptionRepository) (int, error)) (int, error) {
+	attempt := func() (id int, err error) {
+		err = tx.WithTx(ctx, func(sp SubscriptionRepository) (err error) {
+			id, err = write(sp)
+			return err
+		})
+		return id, err
+	}
+
+	s.AllowOverlap = false
+	id, err := attempt()
+	if errors.Is(err, model.ErrOverlap) && retryOverlap {
+		s.AllowOverlap = true
+		id, err = attempt()
+	}
+	return id, err
+}
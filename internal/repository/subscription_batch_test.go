@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"subs-collector/internal/model"
+)
+
+// TestBatch_RollsBackOnError — ошибка операции без ContinueOnError откатывает уже выполненные,
+// с ContinueOnError откатывается только она
+func TestBatch_RollsBackOnError(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	r := NewSubscriptionRepository(pool)
+
+	user := uuid.NewString()
+	t.Cleanup(func() { _, _ = pool.Exec(ctx, `DELETE FROM user_subscriptions WHERE user_id=$1`, user) })
+	sub := model.Subscription{ServiceName: "batch-" + user[:8], Price: 100, UserID: user,
+		StartDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	t.Cleanup(func() {
+		_, _ = pool.Exec(ctx, `DELETE FROM services WHERE normalized_name=$1`, model.NormalizeServiceName(sub.ServiceName))
+	})
+
+	existing := sub
+	id, err := r.Create(ctx, &existing)
+	require.NoError(t, err)
+	moved := sub
+	moved.StartDate = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	ops := func() []model.BatchOp {
+		return []model.BatchOp{
+			{Op: model.BatchUpdate, ID: id, Subscription: moved},
+			{Op: model.BatchDelete, ID: -1},
+			{Op: model.BatchCreate, Subscription: sub},
+		}
+	}
+
+	res, committed, err := r.Batch(ctx, ops(), model.BatchOptions{})
+	require.NoError(t, err)
+	assert.False(t, committed)
+	assert.Equal(t, []string{model.BatchOpRolledBack, model.BatchOpFailed, model.BatchOpSkipped},
+		[]string{res[0].Status, res[1].Status, res[2].Status})
+	got, err := r.GetByID(ctx, id)
+	require.NoError(t, err)
+	assert.True(t, got.StartDate.Equal(sub.StartDate), "изменение откатилось вместе с пакетом")
+
+	res, committed, err = r.Batch(ctx, ops(), model.BatchOptions{ContinueOnError: true})
+	require.NoError(t, err)
+	assert.True(t, committed)
+	assert.Equal(t, []string{model.BatchOpOK, model.BatchOpFailed, model.BatchOpOK},
+		[]string{res[0].Status, res[1].Status, res[2].Status})
+	assert.ErrorIs(t, res[1].Err, model.ErrNotFound)
+	got, err = r.GetByID(ctx, id)
+	require.NoError(t, err)
+	assert.True(t, got.StartDate.Equal(moved.StartDate))
+}
@@ -0,0 +1,231 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"subs-collector/internal/model"
+)
+
+// BulkLoader — массовая загрузка подписок для больших файлов: строки потоком идут через COPY во временную
+// таблицу, сервисы, тарифы и пересечения разрешаются запросами над всей таблицей, затем одна вставка.
+type BulkLoader interface {
+	// BulkLoad читает строки из next до io.EOF. Строки с ошибкой разбора (ImportRow.Err) и не прошедшие
+	// проверку в БД пропускаются и попадают в результат; ошибка next прерывает загрузку.
+	BulkLoad(ctx context.Context, next func() (model.ImportRow, error), o model.BulkLoadOptions) (*model.BulkLoadResult, error)
+}
+
+// NewBulkLoader создаёт загрузчик, из опций учитывается WithStrictCatalog
+func NewBulkLoader(pool *pgxpool.Pool, opts ...Option) BulkLoader {
+	r := &subscriptionRepository{db: pool}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// bulkStaging — временная таблица загрузки; months — то же выражение, что active_months в user_subscriptions
+const bulkStaging = `CREATE TEMP TABLE bulk_subscriptions (
+	           line               INT         NOT NULL,
+	           service_name       TEXT        NOT NULL,
+	           service_normalized TEXT        NOT NULL,
+	           plan               TEXT        NULL,
+	           plan_normalized    TEXT        NULL,
+	           price              INT         NOT NULL,
+	           user_id            UUID        NOT NULL,
+	           start_date         TIMESTAMPTZ NOT NULL,
+	           end_date           TIMESTAMPTZ NULL,
+	           service_id         INT         NULL,
+	           plan_id            INT         NULL,
+	           allow_overlap      BOOLEAN     NOT NULL DEFAULT FALSE,
+	           error              TEXT        NULL,
+	           months             daterange GENERATED ALWAYS AS (
+	               daterange(date_trunc('month', start_date AT TIME ZONE 'UTC')::date,
+	                         (date_trunc('month', end_date AT TIME ZONE 'UTC') + interval '1 month')::date,
+	                         '[)')) STORED
+	       ) ON COMMIT DROP`
+
+var bulkColumns = []string{"line", "service_name", "service_normalized", "plan", "plan_normalized", "price",
+	"user_id", "start_date", "end_date"}
+
+// BulkLoad выполняет загрузку в одной транзакции. Пересчёт monthly_spend откладывается до конца
+// (миграция 013) и выполняется один раз на пару пользователь–сервис. Строка, пересекающаяся с подпиской
+// в БД или с более ранней строкой загрузки, при RetryOverlap сохраняется с allow_overlap, иначе отклоняется.
+func (r *subscriptionRepository) BulkLoad(ctx context.Context, next func() (model.ImportRow, error), o model.BulkLoadOptions) (*model.BulkLoadResult, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, bulkStaging); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `SET LOCAL subs_collector.defer_monthly_spend = 'on'`); err != nil {
+		return nil, err
+	}
+
+	res := &model.BulkLoadResult{}
+	var parseErrs []model.BulkLoadError
+	src := pgx.CopyFromFunc(func() ([]any, error) {
+		for {
+			row, err := next()
+			if errors.Is(err, io.EOF) {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			res.Rows++
+			if row.Err != nil {
+				res.Rejected++
+				if len(parseErrs) < model.BulkLoadMaxErrors {
+					parseErrs = append(parseErrs, model.BulkLoadError{Line: row.Line, Error: row.Err.Error()})
+				}
+				continue
+			}
+
+			s := row.Subscription
+			var plan, planNormalized *string
+			if s.Plan != nil && *s.Plan != "" {
+				n := model.NormalizeServiceName(*s.Plan)
+				plan, planNormalized = s.Plan, &n
+			}
+			return []any{row.Line, model.CleanServiceName(s.ServiceName), model.NormalizeServiceName(s.ServiceName),
+				plan, planNormalized, s.Price, s.UserID, s.StartDate, s.EndDate}, nil
+		}
+	})
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"bulk_subscriptions"}, bulkColumns, src); err != nil {
+		return nil, err
+	}
+
+	if !r.strictCatalog {
+		// недостающие сервисы — одной вставкой, имя берётся из первой строки с ним
+		const ins = `INSERT INTO services (name, normalized_name)
+	               SELECT DISTINCT ON (b.service_normalized) b.service_name, b.service_normalized
+	               FROM bulk_subscriptions b
+	               WHERE NOT EXISTS (SELECT 1 FROM services sv WHERE sv.normalized_name = b.service_normalized)
+	                 AND NOT EXISTS (SELECT 1 FROM service_aliases sa WHERE sa.alias_normalized = b.service_normalized)
+	               ORDER BY b.service_normalized, b.line
+	               ON CONFLICT DO NOTHING`
+		ct, err := tx.Exec(ctx, ins)
+		if err != nil {
+			return nil, err
+		}
+		res.CreatedServices = int(ct.RowsAffected())
+	}
+
+	// имя сервиса важнее совпадающего алиаса, как в findService
+	const resolve = `UPDATE bulk_subscriptions b SET service_id = k.id
+	           FROM (SELECT DISTINCT ON (name) name, id
+	                 FROM (SELECT normalized_name AS name, id, 0 AS prio FROM services
+	                       UNION ALL
+	                       SELECT alias_normalized, service_id, 1 FROM service_aliases) names
+	                 ORDER BY name, prio) k
+	           WHERE k.name = b.service_normalized`
+	// цена 0 при указанном тарифе — цена тарифа в пересчёте на месяц, как model.Plan.MonthlyPrice
+	const plans = `UPDATE bulk_subscriptions b
+	           SET plan_id = sp.id,
+	               plan = sp.name,
+	               price = CASE
+	                           WHEN b.price <> 0 THEN b.price
+	                           WHEN sp.billing_period = 'year' THEN (sp.price + 6) / 12
+	                           ELSE sp.price END
+	           FROM service_plans sp
+	           WHERE sp.service_id = b.service_id AND sp.normalized_name = b.plan_normalized`
+	const unresolved = `UPDATE bulk_subscriptions
+	           SET error = CASE
+	                           WHEN service_id IS NULL THEN format('unknown service "%s"', service_name)
+	                           ELSE format('unknown plan "%s" for service "%s"', plan, service_name) END
+	           WHERE service_id IS NULL OR (plan_normalized IS NOT NULL AND plan_id IS NULL)`
+	for _, sql := range []string{resolve, plans, unresolved} {
+		if _, err := tx.Exec(ctx, sql); err != nil {
+			return nil, err
+		}
+	}
+
+	const overlapping = `WITH o AS (
+	               SELECT b.line FROM bulk_subscriptions b
+	               WHERE b.error IS NULL
+	                 AND (EXISTS (SELECT 1 FROM user_subscriptions us
+	                              WHERE us.user_id = b.user_id AND us.service_id = b.service_id
+	                                AND NOT us.allow_overlap AND us.active_months && b.months)
+	                   OR EXISTS (SELECT 1 FROM bulk_subscriptions e
+	                              WHERE e.error IS NULL AND e.line < b.line
+	                                AND e.user_id = b.user_id AND e.service_id = b.service_id
+	                                AND e.months && b.months)))
+	           UPDATE bulk_subscriptions b
+	           SET allow_overlap = $1, error = CASE WHEN $1 THEN NULL ELSE $2 END
+	           FROM o WHERE o.line = b.line`
+	ct, err := tx.Exec(ctx, overlapping, o.RetryOverlap, model.ErrOverlap.Error())
+	if err != nil {
+		return nil, err
+	}
+	if o.RetryOverlap {
+		res.Overlapping = int(ct.RowsAffected())
+	}
+
+	const merge = `INSERT INTO user_subscriptions (service_id, plan_id, price, user_id, start_date, end_date, allow_overlap)
+	           SELECT service_id, plan_id, price, user_id, start_date, end_date, allow_overlap
+	           FROM bulk_subscriptions WHERE error IS NULL ORDER BY line`
+	if ct, err = tx.Exec(ctx, merge); err != nil {
+		return nil, mapWriteErr(err)
+	}
+	res.Inserted = int(ct.RowsAffected())
+
+	const refresh = `SELECT monthly_spend_refresh(user_id, service_id)
+	           FROM (SELECT DISTINCT user_id, service_id FROM bulk_subscriptions WHERE error IS NULL) p`
+	if _, err := tx.Exec(ctx, refresh); err != nil {
+		return nil, err
+	}
+
+	if err := r.collectBulkErrors(ctx, tx, res, parseErrs); err != nil {
+		return nil, err
+	}
+
+	if o.DryRun {
+		return res, nil
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	res.Committed = true
+	return res, nil
+}
+
+// collectBulkErrors добавляет к ошибкам разбора ошибки проверки в БД, оставляя первые по номеру строки
+func (r *subscriptionRepository) collectBulkErrors(ctx context.Context, tx pgx.Tx, res *model.BulkLoadResult, parseErrs []model.BulkLoadError) error {
+	const sel = `SELECT line, error, count(*) OVER () FROM bulk_subscriptions
+	           WHERE error IS NOT NULL ORDER BY line LIMIT $1`
+	rows, err := tx.Query(ctx, sel, model.BulkLoadMaxErrors)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	errs := parseErrs
+	var total int
+	for rows.Next() {
+		var e model.BulkLoadError
+		if err := rows.Scan(&e.Line, &e.Error, &total); err != nil {
+			return err
+		}
+		errs = append(errs, e)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	res.Rejected += total
+
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Line < errs[j].Line })
+	if len(errs) > model.BulkLoadMaxErrors {
+		errs = errs[:model.BulkLoadMaxErrors]
+	}
+	res.Errors = errs
+	return nil
+}
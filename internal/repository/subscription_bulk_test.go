@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"subs-collector/internal/model"
+)
+
+// rowSource отдаёт строки по одной, как subsfile.Reader
+func rowSource(rows []model.ImportRow) func() (model.ImportRow, error) {
+	return func() (model.ImportRow, error) {
+		if len(rows) == 0 {
+			return model.ImportRow{}, io.EOF
+		}
+		row := rows[0]
+		rows = rows[1:]
+		return row, nil
+	}
+}
+
+// TestBulkLoad_ResolvesAndRejects — новые сервисы создаются, ошибочные и пересекающиеся строки
+// отклоняются, а сумма по загруженным подпискам совпадает с суммой тех же строк, записанных через Create
+func TestBulkLoad_ResolvesAndRejects(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	r := NewSubscriptionRepository(pool).(*subscriptionRepository)
+	loader := NewBulkLoader(pool)
+
+	user := uuid.NewString()
+	service := "bulk-" + uuid.NewString()[:8]
+	t.Cleanup(func() {
+		_, _ = pool.Exec(ctx, `DELETE FROM user_subscriptions WHERE user_id=$1`, user)
+		_, _ = pool.Exec(ctx, `DELETE FROM services WHERE normalized_name=$1`, model.NormalizeServiceName(service))
+	})
+
+	month := func(y int, m time.Month) time.Time { return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC) }
+	end := month(2025, 6)
+	unknownPlan := "no-such-plan"
+	rows := []model.ImportRow{
+		{Line: 2, Subscription: model.Subscription{ServiceName: service, Price: 300, UserID: user, StartDate: month(2025, 1), EndDate: &end}},
+		{Line: 3, Err: &model.ErrInvalid{Msg: "invalid start_date"}},
+		{Line: 4, Subscription: model.Subscription{ServiceName: "  " + service + " ", Price: 100, UserID: user, StartDate: month(2025, 3)}},
+		{Line: 5, Subscription: model.Subscription{ServiceName: service, Plan: &unknownPlan, UserID: user, StartDate: month(2026, 1)}},
+		{Line: 6, Subscription: model.Subscription{ServiceName: service, Price: 50, UserID: user, StartDate: month(2025, 7)}},
+	}
+
+	res, err := loader.BulkLoad(ctx, rowSource(rows), model.BulkLoadOptions{})
+	require.NoError(t, err)
+	assert.True(t, res.Committed)
+	assert.Equal(t, 5, res.Rows)
+	assert.Equal(t, 2, res.Inserted)
+	assert.Equal(t, 1, res.CreatedServices)
+	assert.Equal(t, 3, res.Rejected)
+	lines := make([]int, 0, len(res.Errors))
+	for _, e := range res.Errors {
+		lines = append(lines, e.Line)
+	}
+	assert.Equal(t, []int{3, 4, 5}, lines)
+	assert.Equal(t, model.ErrOverlap.Error(), res.Errors[1].Error)
+
+	total, err := r.SumTotal(ctx, month(2025, 1), month(2025, 12), model.SubscriptionFilter{UserID: user})
+	require.NoError(t, err)
+	assert.Equal(t, 6*300+6*50, total)
+
+	var spend int
+	err = pool.QueryRow(ctx, `SELECT COALESCE(sum(amount), 0) FROM monthly_spend
+	                          WHERE user_id=$1 AND month BETWEEN '2025-01-01' AND '2025-12-01'`, user).Scan(&spend)
+	require.NoError(t, err)
+	assert.Equal(t, total, spend, "monthly_spend пересчитан после загрузки")
+
+	// при RetryOverlap та же строка сохраняется с отметкой, при DryRun — ничего
+	res, err = loader.BulkLoad(ctx, rowSource(rows[2:3]), model.BulkLoadOptions{RetryOverlap: true, DryRun: true})
+	require.NoError(t, err)
+	assert.False(t, res.Committed)
+	assert.Equal(t, 1, res.Inserted)
+	assert.Equal(t, 1, res.Overlapping)
+}
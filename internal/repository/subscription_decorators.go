@@ -0,0 +1,271 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"subs-collector/internal/logger"
+	"subs-collector/internal/metrics"
+	"subs-collector/internal/model"
+)
+
+// Call — вызов метода репозитория, который видит Middleware
+type Call struct {
+	Method string
+	// ReadOnly — метод только читает и отдаёт результат целиком: его можно повторить после обрыва соединения
+	ReadOnly bool
+	// InTx — вызов внутри WithTx: ошибка прерывает всю транзакцию, повторяется только WithTx верхнего уровня
+	InTx bool
+}
+
+// Middleware оборачивает вызов метода репозитория: next выполняет сам вызов (или следующую обёртку)
+type Middleware func(ctx context.Context, c Call, next func(context.Context) error) error
+
+// Decorate оборачивает каждый вызов next цепочкой mws, первая — внешняя. Репозиторий, переданный в fn
+// у WithTx, обёрнут той же цепочкой.
+func Decorate(next SubscriptionRepository, mws ...Middleware) SubscriptionRepository {
+	if len(mws) == 0 {
+		return next
+	}
+	return &decoratedRepository{next: next, mws: mws}
+}
+
+type decoratedRepository struct {
+	next SubscriptionRepository
+	mws  []Middleware
+	inTx bool
+}
+
+func (d *decoratedRepository) call(ctx context.Context, method string, readOnly bool, fn func(context.Context) error) error {
+	c := Call{Method: method, ReadOnly: readOnly, InTx: d.inTx}
+	for i := len(d.mws) - 1; i >= 0; i-- {
+		mw, next := d.mws[i], fn
+		fn = func(ctx context.Context) error { return mw(ctx, c, next) }
+	}
+	return fn(ctx)
+}
+
+func (d *decoratedRepository) Create(ctx context.Context, s *model.Subscription) (int, error) {
+	var id int
+	err := d.call(ctx, "Create", false, func(ctx context.Context) (err error) {
+		id, err = d.next.Create(ctx, s)
+		return err
+	})
+	return id, err
+}
+
+func (d *decoratedRepository) GetByID(ctx context.Context, id int) (*model.Subscription, error) {
+	var res *model.Subscription
+	err := d.call(ctx, "GetByID", true, func(ctx context.Context) (err error) {
+		res, err = d.next.GetByID(ctx, id)
+		return err
+	})
+	return res, err
+}
+
+func (d *decoratedRepository) Update(ctx context.Context, id int, s *model.Subscription) error {
+	return d.call(ctx, "Update", false, func(ctx context.Context) error {
+		return d.next.Update(ctx, id, s)
+	})
+}
+
+func (d *decoratedRepository) Delete(ctx context.Context, id int) error {
+	return d.call(ctx, "Delete", false, func(ctx context.Context) error {
+		return d.next.Delete(ctx, id)
+	})
+}
+
+func (d *decoratedRepository) List(ctx context.Context, f model.SubscriptionFilter) ([]model.Subscription, error) {
+	var res []model.Subscription
+	err := d.call(ctx, "List", true, func(ctx context.Context) (err error) {
+		res, err = d.next.List(ctx, f)
+		return err
+	})
+	return res, err
+}
+
+// ListEach не считается чтением для повторов: fn мог уже получить часть подписок
+func (d *decoratedRepository) ListEach(ctx context.Context, f model.SubscriptionFilter, fn func(model.Subscription) error) error {
+	return d.call(ctx, "ListEach", false, func(ctx context.Context) error {
+		return d.next.ListEach(ctx, f, fn)
+	})
+}
+
+func (d *decoratedRepository) SumTotal(ctx context.Context, from, to time.Time, f model.SubscriptionFilter) (int, error) {
+	var total int
+	err := d.call(ctx, "SumTotal", true, func(ctx context.Context) (err error) {
+		total, err = d.next.SumTotal(ctx, from, to, f)
+		return err
+	})
+	return total, err
+}
+
+func (d *decoratedRepository) SumGrouped(ctx context.Context, from, to time.Time, f model.SubscriptionFilter, g model.Grouping) ([]model.SummaryGroup, error) {
+	var res []model.SummaryGroup
+	err := d.call(ctx, "SumGrouped", true, func(ctx context.Context) (err error) {
+		res, err = d.next.SumGrouped(ctx, from, to, f, g)
+		return err
+	})
+	return res, err
+}
+
+func (d *decoratedRepository) FindBundleOverlaps(ctx context.Context, userID string) ([]model.BundleOverlap, error) {
+	var res []model.BundleOverlap
+	err := d.call(ctx, "FindBundleOverlaps", true, func(ctx context.Context) (err error) {
+		res, err = d.next.FindBundleOverlaps(ctx, userID)
+		return err
+	})
+	return res, err
+}
+
+func (d *decoratedRepository) FindOverlaps(ctx context.Context, userID string) ([]model.SubscriptionOverlap, error) {
+	var res []model.SubscriptionOverlap
+	err := d.call(ctx, "FindOverlaps", true, func(ctx context.Context) (err error) {
+		res, err = d.next.FindOverlaps(ctx, userID)
+		return err
+	})
+	return res, err
+}
+
+func (d *decoratedRepository) Import(ctx context.Context, subs []*model.Subscription, o model.ImportOptions) ([]model.ImportRowResult, bool, error) {
+	var (
+		res       []model.ImportRowResult
+		committed bool
+	)
+	err := d.call(ctx, "Import", false, func(ctx context.Context) (err error) {
+		res, committed, err = d.next.Import(ctx, subs, o)
+		return err
+	})
+	return res, committed, err
+}
+
+func (d *decoratedRepository) Batch(ctx context.Context, ops []model.BatchOp, o model.BatchOptions) ([]model.BatchOpResult, bool, error) {
+	var (
+		res       []model.BatchOpResult
+		committed bool
+	)
+	err := d.call(ctx, "Batch", false, func(ctx context.Context) (err error) {
+		res, committed, err = d.next.Batch(ctx, ops, o)
+		return err
+	})
+	return res, committed, err
+}
+
+// WithTx повторяется целиком, поэтому fn должна допускать повторный запуск (как fn сервисного слоя)
+func (d *decoratedRepository) WithTx(ctx context.Context, fn func(SubscriptionRepository) error) error {
+	return d.call(ctx, "WithTx", false, func(ctx context.Context) error {
+		return d.next.WithTx(ctx, func(tx SubscriptionRepository) error {
+			return fn(&decoratedRepository{next: tx, mws: d.mws, inTx: true})
+		})
+	})
+}
+
+// isUnexpected — ошибка, требующая внимания. Ошибки предметной области и отмена запроса — обычная работа;
+// ошибка WithTx — это ошибка fn: неудачный вызов внутри уже учтён сам, остальное решил вызывающий.
+func isUnexpected(c Call, err error) bool {
+	if err == nil || c.Method == "WithTx" {
+		return false
+	}
+	var invalid *model.ErrInvalid
+	var unknown *model.UnknownServiceError
+	return !errors.Is(err, model.ErrNotFound) && !errors.Is(err, model.ErrOverlap) && !errors.Is(err, context.Canceled) &&
+		!errors.As(err, &invalid) && !errors.As(err, &unknown)
+}
+
+// Logging пишет каждый вызов с длительностью; неожиданные ошибки — уровнем ERROR
+func Logging(l *logger.Logger) Middleware {
+	return func(ctx context.Context, c Call, next func(context.Context) error) error {
+		start := time.Now()
+		err := next(ctx)
+		keyvals := []interface{}{"method", c.Method, "tx", c.InTx, "duration", time.Since(start)}
+		switch {
+		case isUnexpected(c, err):
+			l.Error("repository call failed", append(keyvals, "err", err)...)
+		case err != nil:
+			l.Info("repository call", append(keyvals, "err", err)...)
+		default:
+			l.Info("repository call", keyvals...)
+		}
+		return err
+	}
+}
+
+// Metrics считает в reg по методу число вызовов (repository_calls_total), неожиданных ошибок
+// (repository_errors_total) и суммарную длительность (repository_call_duration_microseconds_total)
+func Metrics(reg *metrics.Registry) Middleware {
+	return func(ctx context.Context, c Call, next func(context.Context) error) error {
+		label := `{method="` + c.Method + `"}`
+		start := time.Now()
+		err := next(ctx)
+		reg.Counter("repository_calls_total" + label).Inc()
+		reg.Counter("repository_call_duration_microseconds_total" + label).Add(time.Since(start).Microseconds())
+		if isUnexpected(c, err) {
+			reg.Counter("repository_errors_total" + label).Inc()
+		}
+		return err
+	}
+}
+
+// SQLSTATE ошибок, после которых транзакция откачена сервером и её можно повторить
+const (
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+)
+
+// isTransient — ошибка, после которой повтор вызова безопасен и может пройти
+func isTransient(err error, c Call) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == serializationFailure || pgErr.Code == deadlockDetected
+	}
+	// запрос не ушёл на сервер
+	if pgconn.SafeToRetry(err) {
+		return true
+	}
+	// обрыв соединения посреди запроса: запись могла примениться, чтение — нет
+	return c.ReadOnly && (errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF))
+}
+
+// Retry повторяет вызов после временной ошибки Postgres (конфликт сериализации, взаимоблокировка,
+// обрыв соединения) до attempts раз. Пауза перед n-м повтором — случайная в пределах backoff·2^(n-1).
+// Вызовы внутри WithTx не повторяются: повторяется транзакция целиком.
+func Retry(attempts int, backoff time.Duration) Middleware {
+	return func(ctx context.Context, c Call, next func(context.Context) error) error {
+		err := next(ctx)
+		if c.InTx {
+			return err
+		}
+		for n := 1; n < attempts && err != nil && isTransient(err, c); n++ {
+			wait := backoff << (n - 1)
+			if wait > 0 {
+				wait = wait/2 + rand.N(wait/2+1)
+			}
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(wait):
+			}
+			err = next(ctx)
+		}
+		return err
+	}
+}
+
+// Timeout ограничивает каждый вызов временем d. WithTx и ListEach не ограничиваются: их длительность
+// зависит от вызывающего (fn), вызовы внутри транзакции ограничиваются по отдельности.
+func Timeout(d time.Duration) Middleware {
+	return func(ctx context.Context, c Call, next func(context.Context) error) error {
+		if c.Method == "WithTx" || c.Method == "ListEach" {
+			return next(ctx)
+		}
+		ctx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+		return next(ctx)
+	}
+}
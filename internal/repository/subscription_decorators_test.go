@@ -0,0 +1,123 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"subs-collector/internal/logger"
+	"subs-collector/internal/metrics"
+	"subs-collector/internal/model"
+	"subs-collector/internal/repository"
+	"subs-collector/internal/repository/mocks"
+	"subs-collector/internal/repository/repotest"
+)
+
+// TestDecorate_Contract — обёрнутый репозиторий выполняет тот же контракт, что и исходный
+func TestDecorate_Contract(t *testing.T) {
+	repotest.Run(t, func(t *testing.T, _ string) repository.SubscriptionRepository {
+		return repository.Decorate(repository.NewMemorySubscriptionRepository(), repository.Metrics(metrics.NewRegistry()),
+			repository.Logging(logger.New()), repository.Retry(3, time.Millisecond), repository.Timeout(time.Second))
+	})
+}
+
+func TestRetry_TransientErrors(t *testing.T) {
+	ctx := context.Background()
+	serialization := &pgconn.PgError{Code: "40001"}
+
+	m := &mocks.SubscriptionRepository{}
+	repo := repository.Decorate(m, repository.Retry(3, time.Millisecond))
+
+	m.On("GetByID", mock.Anything, 1).Return(nil, serialization).Twice()
+	m.On("GetByID", mock.Anything, 1).Return(&model.Subscription{ID: 1}, nil).Once()
+	s, err := repo.GetByID(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, s.ID)
+
+	// обрыв соединения повторяется только для чтения
+	m.On("GetByID", mock.Anything, 2).Return(nil, io.ErrUnexpectedEOF).Once()
+	m.On("GetByID", mock.Anything, 2).Return(&model.Subscription{ID: 2}, nil).Once()
+	_, err = repo.GetByID(ctx, 2)
+	require.NoError(t, err)
+	m.On("Delete", mock.Anything, 3).Return(io.ErrUnexpectedEOF).Once()
+	assert.ErrorIs(t, repo.Delete(ctx, 3), io.ErrUnexpectedEOF)
+
+	// не временная ошибка и исчерпанные попытки возвращаются как есть
+	m.On("Delete", mock.Anything, 4).Return(model.ErrNotFound).Once()
+	assert.ErrorIs(t, repo.Delete(ctx, 4), model.ErrNotFound)
+	m.On("Delete", mock.Anything, 5).Return(serialization).Times(3)
+	assert.ErrorIs(t, repo.Delete(ctx, 5), serialization)
+
+	m.AssertExpectations(t)
+}
+
+// TestRetry_WholeTransaction — ошибка внутри WithTx повторяет транзакцию, а не отдельный вызов
+func TestRetry_WholeTransaction(t *testing.T) {
+	ctx := context.Background()
+	deadlock := &pgconn.PgError{Code: "40P01"}
+
+	m := &mocks.SubscriptionRepository{}
+	repo := repository.Decorate(m, repository.Retry(3, time.Millisecond))
+	m.On("WithTx", mock.Anything).Return(nil)
+	m.On("Create", mock.Anything, mock.Anything).Return(0, deadlock).Once()
+	m.On("Create", mock.Anything, mock.Anything).Return(7, nil).Once()
+
+	var id int
+	err := repo.WithTx(ctx, func(tx repository.SubscriptionRepository) (err error) {
+		id, err = tx.Create(ctx, &model.Subscription{ServiceName: "VideoHub"})
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 7, id)
+	m.AssertNumberOfCalls(t, "WithTx", 2)
+	m.AssertNumberOfCalls(t, "Create", 2)
+}
+
+func TestTimeout(t *testing.T) {
+	ctx := context.Background()
+	m := &mocks.SubscriptionRepository{}
+	repo := repository.Decorate(m, repository.Timeout(time.Minute))
+
+	hasDeadline := func(want bool) func(mock.Arguments) {
+		return func(args mock.Arguments) {
+			_, ok := args.Get(0).(context.Context).Deadline()
+			assert.Equal(t, want, ok)
+		}
+	}
+	m.On("SumTotal", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Run(hasDeadline(true)).Return(0, nil)
+	m.On("WithTx", mock.Anything).Run(hasDeadline(false)).Return(nil)
+	m.On("Delete", mock.Anything, 1).Run(hasDeadline(true)).Return(nil)
+
+	_, err := repo.SumTotal(ctx, time.Now(), time.Now(), model.SubscriptionFilter{})
+	require.NoError(t, err)
+	require.NoError(t, repo.WithTx(ctx, func(tx repository.SubscriptionRepository) error {
+		return tx.Delete(ctx, 1)
+	}))
+	m.AssertExpectations(t)
+}
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	m := &mocks.SubscriptionRepository{}
+	reg := metrics.NewRegistry()
+	repo := repository.Decorate(m, repository.Metrics(reg))
+
+	m.On("Delete", mock.Anything, 1).Return(nil)
+	m.On("Delete", mock.Anything, 2).Return(model.ErrNotFound)
+	m.On("Delete", mock.Anything, 3).Return(errors.New("connection refused"))
+	for id := 1; id <= 3; id++ {
+		_ = repo.Delete(ctx, id)
+	}
+
+	snap := reg.Snapshot()
+	assert.Equal(t, int64(3), snap[`repository_calls_total{method="Delete"}`])
+	assert.Equal(t, int64(1), snap[`repository_errors_total{method="Delete"}`], "ErrNotFound не ошибка")
+	assert.Contains(t, snap, `repository_call_duration_microseconds_total{method="Delete"}`)
+}
@@ -3,9 +3,13 @@ package repository
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"subs-collector/internal/model"
@@ -16,152 +20,641 @@ type SubscriptionRepository interface {
 	GetByID(ctx context.Context, id int) (*model.Subscription, error)
 	Update(ctx context.Context, id int, s *model.Subscription) error
 	Delete(ctx context.Context, id int) error
-	List(ctx context.Context, userID, serviceName string) ([]model.Subscription, error)
-	SumTotal(ctx context.Context, from, to time.Time, userID, serviceName string) (int, error)
+	List(ctx context.Context, f model.SubscriptionFilter) ([]model.Subscription, error)
+	ListEach(ctx context.Context, f model.SubscriptionFilter, fn func(model.Subscription) error) error
+	SumTotal(ctx context.Context, from, to time.Time, f model.SubscriptionFilter) (int, error)
+	SumGrouped(ctx context.Context, from, to time.Time, f model.SubscriptionFilter, g model.Grouping) ([]model.SummaryGroup, error)
+	FindBundleOverlaps(ctx context.Context, userID string) ([]model.BundleOverlap, error)
+	FindOverlaps(ctx context.Context, userID string) ([]model.SubscriptionOverlap, error)
+	Import(ctx context.Context, subs []*model.Subscription, o model.ImportOptions) ([]model.ImportRowResult, bool, error)
+	Batch(ctx context.Context, ops []model.BatchOp, o model.BatchOptions) ([]model.BatchOpResult, bool, error)
+	// WithTx выполняет fn в транзакции: все вызовы репозитория, переданного в fn, идут в неё.
+	// Ошибка fn откатывает транзакцию и возвращается как есть, иначе транзакция фиксируется.
+	// WithTx репозитория внутри fn открывает точку сохранения: её ошибка откатывает только вложенные вызовы.
+	// Репозиторий fn нельзя использовать после возврата из fn.
+	WithTx(ctx context.Context, fn func(SubscriptionRepository) error) error
 }
 
 type subscriptionRepository struct {
-	pool *pgxpool.Pool
+	db            dbtx // пул или транзакция WithTx
+	strictCatalog bool
+	monthlySpend  bool
+	services      *ServiceCache
+	// resolved — сервисы, найденные или созданные в транзакции WithTx: в кэш попадают только после фиксации
+	resolved map[string]int
 }
 
-func NewSubscriptionRepository(pool *pgxpool.Pool) SubscriptionRepository {
-	return &subscriptionRepository{pool: pool}
+// Option — необязательная настройка репозитория подписок
+type Option func(*subscriptionRepository)
+
+// WithStrictCatalog запрещает автосоздание сервисов: неизвестное имя возвращает *model.UnknownServiceError
+func WithStrictCatalog(strict bool) Option {
+	return func(r *subscriptionRepository) { r.strictCatalog = strict }
+}
+
+// WithMonthlySpend включает чтение сводок из предрасчитанной таблицы monthly_spend, когда запрос она покрывает
+func WithMonthlySpend(enabled bool) Option {
+	return func(r *subscriptionRepository) { r.monthlySpend = enabled }
+}
+
+// WithServiceCache включает кэш id сервисов по имени, nil — без кэша
+func WithServiceCache(c *ServiceCache) Option {
+	return func(r *subscriptionRepository) { r.services = c }
+}
+
+func NewSubscriptionRepository(pool *pgxpool.Pool, opts ...Option) SubscriptionRepository {
+	r := &subscriptionRepository{db: pool}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
 func (r *subscriptionRepository) Create(ctx context.Context, s *model.Subscription) (int, error) {
-	serviceID, err := r.ensureService(ctx, s.ServiceName)
+	return r.create(ctx, r.db, s)
+}
+
+func (r *subscriptionRepository) create(ctx context.Context, q querier, s *model.Subscription) (int, error) {
+	serviceID, planID, err := r.resolveRefs(ctx, q, s)
 	if err != nil {
 		return 0, err
 	}
 
 	const sql = `INSERT INTO user_subscriptions (
-	               service_id, price, user_id, start_date, end_date
-	           ) VALUES ($1, $2, $3::uuid, $4, $5) RETURNING id`
+	               service_id, plan_id, price, user_id, start_date, end_date, allow_overlap
+	           ) VALUES ($1, $2, $3, $4::uuid, $5, $6, $7) RETURNING id`
 
 	var id int
-	err = r.pool.QueryRow(ctx, sql, serviceID, s.Price, s.UserID, s.StartDate, s.EndDate).Scan(&id)
-	return id, err
+	err = q.QueryRow(ctx, sql, serviceID, planID, s.Price, s.UserID, s.StartDate, s.EndDate, s.AllowOverlap).Scan(&id)
+	return id, mapWriteErr(err)
 }
 
-func (r *subscriptionRepository) GetByID(ctx context.Context, id int) (*model.Subscription, error) {
-	const sql = `SELECT us.id, sv.name AS service_name, us.price, us.user_id::text, us.start_date, us.end_date
+// exclusionViolation — SQLSTATE нарушения ограничения EXCLUDE
+const exclusionViolation = "23P01"
+
+// mapWriteErr переводит нарушение ограничения на пересечения подписок в model.ErrOverlap
+func mapWriteErr(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == exclusionViolation && pgErr.ConstraintName == "user_subscriptions_no_overlap" {
+		return model.ErrOverlap
+	}
+	return err
+}
+
+// subscriptionSelect — выборка подписки с именами сервиса и тарифа, алиасы us, sv, sp
+const subscriptionSelect = `SELECT us.id, sv.name AS service_name, sp.name AS plan, us.price, us.user_id::text, us.start_date, us.end_date
 	           FROM user_subscriptions us
 	           JOIN services sv ON sv.id = us.service_id
-	           WHERE us.id=$1`
+	           LEFT JOIN service_plans sp ON sp.id = us.plan_id`
 
-	row := r.pool.QueryRow(ctx, sql, id)
+func scanSubscription(row pgx.Row) (model.Subscription, error) {
 	var m model.Subscription
-	err := row.Scan(&m.ID, &m.ServiceName, &m.Price, &m.UserID, &m.StartDate, &m.EndDate)
+	err := row.Scan(&m.ID, &m.ServiceName, &m.Plan, &m.Price, &m.UserID, &m.StartDate, &m.EndDate)
+	return m, err
+}
 
+func (r *subscriptionRepository) GetByID(ctx context.Context, id int) (*model.Subscription, error) {
+	m, err := scanSubscription(r.db.QueryRow(ctx, subscriptionSelect+` WHERE us.id=$1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, model.ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	const history = `SELECT effective_month, price FROM subscription_price_changes
+	               WHERE subscription_id=$1 ORDER BY effective_month`
+	rows, err := r.db.Query(ctx, history, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pc model.PriceChange
+		if err := rows.Scan(&pc.EffectiveMonth, &pc.Price); err != nil {
+			return nil, err
+		}
+		m.PriceChanges = append(m.PriceChanges, pc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
 	return &m, nil
 }
 
 func (r *subscriptionRepository) Update(ctx context.Context, id int, s *model.Subscription) error {
-	serviceID, err := r.ensureService(ctx, s.ServiceName)
+	return r.update(ctx, r.db, id, s)
+}
+
+func (r *subscriptionRepository) update(ctx context.Context, q querier, id int, s *model.Subscription) error {
+	serviceID, planID, err := r.resolveRefs(ctx, q, s)
 	if err != nil {
 		return err
 	}
 
 	const sql = `UPDATE user_subscriptions 
-	               SET service_id=$1, price=$2, user_id=$3::uuid, start_date=$4, end_date=$5, updated_at=$6 WHERE id=$7`
-	ct, err := r.pool.Exec(ctx, sql, serviceID, s.Price, s.UserID, s.StartDate, s.EndDate, time.Now().UTC(), id)
+	               SET service_id=$1, plan_id=$2, price=$3, user_id=$4::uuid, start_date=$5, end_date=$6, updated_at=$7,
+	                   allow_overlap=$8
+	               WHERE id=$9`
+	ct, err := q.Exec(ctx, sql, serviceID, planID, s.Price, s.UserID, s.StartDate, s.EndDate, time.Now().UTC(), s.AllowOverlap, id)
 
 	if err != nil {
-		return err
+		return mapWriteErr(err)
 	}
 
 	if ct.RowsAffected() == 0 {
-		return errors.New("not found")
+		return model.ErrNotFound
 	}
 
 	return nil
 }
 
+// resolveRefs находит id сервиса и тарифа подписки. Если указан тариф, а цена не задана (0),
+// в s.Price подставляется цена тарифа в пересчёте на месяц.
+func (r *subscriptionRepository) resolveRefs(ctx context.Context, q querier, s *model.Subscription) (int, *int, error) {
+	serviceID, err := r.ensureService(ctx, q, s.ServiceName)
+	if err != nil {
+		return 0, nil, err
+	}
+	if s.Plan == nil || *s.Plan == "" {
+		s.Plan = nil
+		return serviceID, nil, nil
+	}
+
+	const sql = `SELECT id, service_id, name, price, billing_period, currency
+	           FROM service_plans WHERE service_id=$1 AND normalized_name=$2`
+	var p model.Plan
+	err = q.QueryRow(ctx, sql, serviceID, model.NormalizeServiceName(*s.Plan)).
+		Scan(&p.ID, &p.ServiceID, &p.Name, &p.Price, &p.BillingPeriod, &p.Currency)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil, &model.ErrInvalid{Msg: fmt.Sprintf("unknown plan %q for service %q", *s.Plan, s.ServiceName)}
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if s.Price == 0 {
+		s.Price = p.MonthlyPrice()
+	}
+	s.Plan = &p.Name
+	return serviceID, &p.ID, nil
+}
+
 func (r *subscriptionRepository) Delete(ctx context.Context, id int) error {
+	return deleteSubscription(ctx, r.db, id)
+}
+
+func deleteSubscription(ctx context.Context, q querier, id int) error {
 	const sql = `DELETE FROM user_subscriptions WHERE id=$1`
-	ct, err := r.pool.Exec(ctx, sql, id)
+	ct, err := q.Exec(ctx, sql, id)
 	if err != nil {
 		return err
 	}
 
 	if ct.RowsAffected() == 0 {
-		return errors.New("not found")
+		return model.ErrNotFound
 	}
 
 	return nil
 }
 
-func (r *subscriptionRepository) List(ctx context.Context, userID string, serviceName string) ([]model.Subscription, error) {
-	sql := `SELECT us.id, sv.name AS service_name, us.price, us.user_id::text, us.start_date, us.end_date
-	      FROM user_subscriptions us JOIN services sv ON sv.id = us.service_id`
-	var args []interface{}
-	idx := 1
+func (r *subscriptionRepository) WithTx(ctx context.Context, fn func(SubscriptionRepository) error) error {
+	gen := r.services.generation()
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	txRepo := *r
+	txRepo.db = tx
+	txRepo.resolved = make(map[string]int)
+	if err := fn(&txRepo); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
 
-	if userID != "" {
-		sql += " AND us.user_id=$" + strconv.Itoa(idx) + "::uuid"
-		args = append(args, userID)
-		idx++
+	// созданный в транзакции сервис откатывается вместе с ней, поэтому кэшируем только зафиксированное
+	for name, id := range txRepo.resolved {
+		r.remember(name, id, gen)
 	}
+	return nil
+}
+
+// Import записывает подписки в одной транзакции, каждую — в своей точке сохранения, поэтому ошибка строки
+// не прерывает остальные. Результаты идут в порядке subs, Line не заполняется. Транзакция откатывается
+// при o.DryRun или при o.AllOrNothing с ошибками; второй результат — были ли записи сохранены.
+func (r *subscriptionRepository) Import(ctx context.Context, subs []*model.Subscription, o model.ImportOptions) ([]model.ImportRowResult, bool, error) {
+	return importSubscriptions(ctx, r, subs, o)
+}
+
+// importSubscriptions — Import поверх WithTx репозитория repo, общий для всех хранилищ
+func importSubscriptions(ctx context.Context, repo SubscriptionRepository, subs []*model.Subscription, o model.ImportOptions) ([]model.ImportRowResult, bool, error) {
+	var res []model.ImportRowResult
+	err := repo.WithTx(ctx, func(tx SubscriptionRepository) error {
+		res = make([]model.ImportRowResult, len(subs))
+		failed := false
+		for i, s := range subs {
+			id, err := writeSavepoint(ctx, tx, s, o.RetryOverlap, func(sp SubscriptionRepository) (int, error) {
+				return sp.Create(ctx, s)
+			})
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				res[i] = model.ImportRowResult{Status: model.ImportRowFailed, Err: err}
+				failed = true
+				continue
+			}
+			res[i] = model.ImportRowResult{Status: model.ImportRowCreated, ID: id, Overlap: s.AllowOverlap}
+		}
 
-	if serviceName != "" {
-		sql += " AND sv.name=$" + strconv.Itoa(idx)
-		args = append(args, serviceName)
-		idx++
+		if !o.DryRun && !(o.AllOrNothing && failed) {
+			return nil
+		}
+		status := model.ImportRowValid
+		if !o.DryRun {
+			status = model.ImportRowRolledBack
+		}
+		for i := range res {
+			if res[i].Status == model.ImportRowCreated {
+				res[i].Status, res[i].ID = status, 0
+			}
+		}
+		return errRollback
+	})
+	if err != nil && !errors.Is(err, errRollback) {
+		return nil, false, err
 	}
+	return res, err == nil, nil
+}
 
-	rows, err := r.pool.Query(ctx, sql, args...)
+func (r *subscriptionRepository) List(ctx context.Context, f model.SubscriptionFilter) ([]model.Subscription, error) {
+	res := make([]model.Subscription, 0)
+	err := r.ListEach(ctx, f, func(s model.Subscription) error {
+		res = append(res, s)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return res, nil
+}
+
+// ListEach передаёт подписки по фильтру в fn по одной, в порядке id, не собирая их в память.
+// Ошибка fn прекращает чтение и возвращается как есть; отмена ctx прерывает запрос.
+func (r *subscriptionRepository) ListEach(ctx context.Context, f model.SubscriptionFilter, fn func(model.Subscription) error) error {
+	cond, args := filterCond(f, nil)
+	sql := subscriptionSelect + ` WHERE TRUE` + cond + ` ORDER BY us.id`
+
+	rows, err := r.db.Query(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
 	defer rows.Close()
 
-	res := make([]model.Subscription, 0)
 	for rows.Next() {
-		var s model.Subscription
-		if err := rows.Scan(&s.ID, &s.ServiceName, &s.Price, &s.UserID, &s.StartDate, &s.EndDate); err != nil {
-			return nil, err
+		s, err := scanSubscription(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(s); err != nil {
+			return err
 		}
-		res = append(res, s)
 	}
 
-	return res, rows.Err()
+	return rows.Err()
 }
 
-// SumTotal считает суммарную стоимость за каждый месяц периода [from..to] включительно,
-// учитывая только те месяцы, в которых подписка активна. Если end_date NULL — бесконечная.
-func (r *subscriptionRepository) SumTotal(ctx context.Context, from, to time.Time, userID, serviceName string) (int, error) {
-	sql := `WITH months AS (
-	            SELECT
-	                generate_series(date_trunc('month', $1::timestamptz),
-	                date_trunc('month', $2::timestamptz), interval '1 month') AS m
+// periodCTE и segmentsFrom — подписки, активные в периоде [$1..$2] (месяцы UTC), разбитые по истории цен
+// на отрезки seg: seg.price действует в seg.r (непустое пересечение с периодом). Каждая подписка
+// просматривается один раз, число месяцев отрезка считается арифметически (segmentAmount).
+// Между ними подставляется SELECT, после — дополнительные JOIN и WHERE.
+const periodCTE = `WITH period AS (
+	            SELECT daterange(date_trunc('month', $1::timestamptz AT TIME ZONE 'UTC')::date,
+	                   (date_trunc('month', $2::timestamptz AT TIME ZONE 'UTC') + interval '1 month')::date, '[)') AS p
 	     )
-	     SELECT COALESCE(SUM(us.price), 0) AS total
-	     FROM months mo
-	     JOIN user_subscriptions us
-	       ON date_trunc('month', us.start_date) <= mo.m
-	      AND (us.end_date IS NULL OR date_trunc('month', us.end_date) >= mo.m)
+	     `
+
+// Цена из истории действует с первого полного месяца после effective_month (с него самого, если это 1-е число);
+// при нескольких изменениях, попавших на один месяц, побеждает последнее — предыдущие дают пустые отрезки.
+const segmentsFrom = `
+	     FROM period
+	     JOIN user_subscriptions us ON us.active_months && period.p
 	     JOIN services sv ON sv.id = us.service_id
-	     WHERE ($3 = '' OR us.user_id = $3::uuid)
-	       AND ($4 = '' OR sv.name = $4)`
+	     LEFT JOIN service_plans sp ON sp.id = us.plan_id
+	     JOIN LATERAL (
+	         SELECT h.price,
+	                us.active_months * period.p *
+	                daterange(h.lo, lead(h.lo) OVER (ORDER BY h.lo NULLS FIRST, h.em NULLS FIRST), '[)') AS r
+	         FROM (SELECT us.price, NULL::date AS lo, NULL::date AS em
+	               UNION ALL
+	               SELECT pc.price, (date_trunc('month', pc.effective_month - 1) + interval '1 month')::date, pc.effective_month
+	               FROM subscription_price_changes pc WHERE pc.subscription_id = us.id) h
+	     ) seg ON NOT isempty(seg.r)`
+
+// segmentAmount — стоимость отрезка: цена на число месяцев в seg.r (границы — первые числа месяцев)
+const segmentAmount = `seg.price * ((extract(year FROM upper(seg.r)) - extract(year FROM lower(seg.r))) * 12 +
+	                   extract(month FROM upper(seg.r)) - extract(month FROM lower(seg.r)))::int`
+
+// SumTotal считает суммарную стоимость за каждый месяц периода [from..to] включительно,
+// учитывая только те месяцы, в которых подписка активна. Если end_date NULL — бесконечная.
+func (r *subscriptionRepository) SumTotal(ctx context.Context, from, to time.Time, f model.SubscriptionFilter) (int, error) {
+	spend, err := r.useMonthlySpend(ctx, to, f, model.Grouping{})
+	if err != nil {
+		return 0, err
+	}
+
+	cond, args := filterCond(f, []interface{}{from, to})
+	sql := periodCTE + `SELECT COALESCE(SUM(` + segmentAmount + `), 0) AS total` + segmentsFrom + ` WHERE TRUE` + cond
+	if spend {
+		sql = `SELECT COALESCE(SUM(us.amount), 0)::bigint` + spendFrom + spendWhere + cond
+	}
+
 	var total int
-	err := r.pool.QueryRow(ctx, sql, from, to, userID, serviceName).Scan(&total)
+	err = r.db.QueryRow(ctx, sql, args...).Scan(&total)
 	return total, err
 }
 
-// ensureService возвращает id сервиса, создавая запись при необходимости
-func (r *subscriptionRepository) ensureService(ctx context.Context, name string) (int, error) {
-	const ins = `INSERT INTO services(name) VALUES ($1) ON CONFLICT (name) DO NOTHING`
-	if _, err := r.pool.Exec(ctx, ins, name); err != nil {
+// spendFrom и spendWhere — строки monthly_spend за месяцы периода [$1..$2], между ними — дополнительные JOIN.
+// Алиас us, как у подписок, чтобы подошли условия filterCond; тариф и период активности в таблице
+// не хранятся (см. useMonthlySpend).
+const spendFrom = `
+	     FROM monthly_spend us
+	     JOIN services sv ON sv.id = us.service_id`
+
+const spendWhere = `
+	     WHERE us.month BETWEEN date_trunc('month', $1::timestamptz AT TIME ZONE 'UTC')::date
+	                        AND date_trunc('month', $2::timestamptz AT TIME ZONE 'UTC')::date`
+
+// useMonthlySpend решает, можно ли посчитать сводку по monthly_spend: чтение включено, период
+// не выходит за горизонт развёртки, а фильтр и группировка не требуют тарифа или периода активности
+func (r *subscriptionRepository) useMonthlySpend(ctx context.Context, to time.Time, f model.SubscriptionFilter, g model.Grouping) (bool, error) {
+	if !r.monthlySpend || f.Plan != "" || !f.ActiveFrom.IsZero() || !f.ActiveTo.IsZero() || g.By == model.GroupByPlan {
+		return false, nil
+	}
+
+	horizon, err := spendHorizon(ctx, r.db)
+	if err != nil {
+		return false, err
+	}
+	return monthStart(to).Before(horizon), nil
+}
+
+// groupExprs — SQL-выражения ключа для поддерживаемых группировок сводки,
+// es — алиас сервиса, на который относится сумма (сам сервис или компонент пакета)
+var groupExprs = map[string]string{
+	model.GroupByService:  "es.name",
+	model.GroupByCategory: "es.category",
+	model.GroupByPlan:     "sv.name || ' / ' || sp.name",
+}
+
+// bundleAttribution разворачивает подписку на пакет в строки по компонентам, amount — доля цены
+const bundleAttribution = `
+	     LEFT JOIN service_bundle_components bc ON bc.bundle_id = sv.id
+	     LEFT JOIN (SELECT bundle_id, SUM(share) AS total FROM service_bundle_components GROUP BY bundle_id) bt
+	       ON bt.bundle_id = sv.id
+	     JOIN services es ON es.id = COALESCE(bc.component_id, sv.id)`
+
+// SumGrouped считает ту же сумму, что SumTotal, с разбивкой по g.By. При g.AttributeBundles цена пакета
+// делится между компонентами пропорционально долям, суммы групп округляются до целого.
+func (r *subscriptionRepository) SumGrouped(ctx context.Context, from, to time.Time, f model.SubscriptionFilter, g model.Grouping) ([]model.SummaryGroup, error) {
+	expr, ok := groupExprs[g.By]
+	if !ok {
+		return nil, &model.ErrInvalid{Msg: "unsupported group_by"}
+	}
+
+	spend, err := r.useMonthlySpend(ctx, to, f, g)
+	if err != nil {
+		return nil, err
+	}
+
+	// источник сумм: отрезки подписок или строки monthly_spend
+	cte, amount, source, where := periodCTE, segmentAmount, segmentsFrom, ` WHERE TRUE`
+	if spend {
+		cte, amount, source, where = "", "us.amount", spendFrom, spendWhere
+	}
+
+	joins := ` JOIN services es ON es.id = sv.id`
+	if g.AttributeBundles {
+		amount, joins = amount+" * COALESCE(bc.share, 1)::numeric / COALESCE(bt.total, 1)", bundleAttribution
+	}
+
+	cond, args := filterCond(f, []interface{}{from, to})
+	sql := cte + `SELECT ` + expr + ` AS key, ROUND(SUM(` + amount + `))::int AS total` + source + joins +
+		where + cond + ` GROUP BY 1 ORDER BY 2 DESC, 1`
+
+	rows, err := r.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]model.SummaryGroup, 0)
+	for rows.Next() {
+		var g model.SummaryGroup
+		if err := rows.Scan(&g.Key, &g.Total); err != nil {
+			return nil, err
+		}
+		res = append(res, g)
+	}
+
+	return res, rows.Err()
+}
+
+// FindBundleOverlaps ищет месяцы, когда у пользователя одновременно активны пакет и входящий в него сервис.
+// Пустой userID — по всем пользователям.
+func (r *subscriptionRepository) FindBundleOverlaps(ctx context.Context, userID string) ([]model.BundleOverlap, error) {
+	sql := `SELECT b.user_id::text, b.id, bs.name, c.id, cs.name, ` + commonMonths("b", "c") + `
+	      FROM user_subscriptions b
+	      JOIN services bs ON bs.id = b.service_id
+	      JOIN service_bundle_components bc ON bc.bundle_id = b.service_id
+	      JOIN user_subscriptions c
+	        ON c.user_id = b.user_id AND c.service_id = bc.component_id AND c.active_months && b.active_months
+	      JOIN services cs ON cs.id = c.service_id
+	      WHERE ($1 = '' OR b.user_id = $1::uuid)
+	      ORDER BY b.user_id, b.id, c.id`
+
+	rows, err := r.db.Query(ctx, sql, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]model.BundleOverlap, 0)
+	for rows.Next() {
+		var o model.BundleOverlap
+		if err := rows.Scan(&o.UserID, &o.BundleSubscriptionID, &o.BundleService, &o.ComponentSubscriptionID,
+			&o.ComponentService, &o.From, &o.To); err != nil {
+			return nil, err
+		}
+		res = append(res, o)
+	}
+
+	return res, rows.Err()
+}
+
+// commonMonths — первый и последний (NULL — бессрочно) общие месяцы активности подписок a и b
+func commonMonths(a, b string) string {
+	common := a + `.active_months * ` + b + `.active_months`
+	return `lower(` + common + `), (upper(` + common + `) - interval '1 month')::date`
+}
+
+// FindOverlaps ищет пары подписок пользователя на один сервис с общими месяцами, пустой userID — по всем
+func (r *subscriptionRepository) FindOverlaps(ctx context.Context, userID string) ([]model.SubscriptionOverlap, error) {
+	sql := `SELECT a.user_id::text, sv.name, a.id, b.id, ` + commonMonths("a", "b") + `
+	      FROM user_subscriptions a
+	      JOIN user_subscriptions b
+	        ON b.user_id = a.user_id AND b.service_id = a.service_id AND b.id > a.id
+	       AND a.active_months && b.active_months
+	      JOIN services sv ON sv.id = a.service_id
+	      WHERE ($1 = '' OR a.user_id = $1::uuid)
+	      ORDER BY a.user_id, a.id, b.id`
+
+	rows, err := r.db.Query(ctx, sql, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]model.SubscriptionOverlap, 0)
+	for rows.Next() {
+		var o model.SubscriptionOverlap
+		if err := rows.Scan(&o.UserID, &o.ServiceName, &o.SubscriptionID, &o.OtherID, &o.From, &o.To); err != nil {
+			return nil, err
+		}
+		res = append(res, o)
+	}
+
+	return res, rows.Err()
+}
+
+// filterCond строит условия " AND ..." по фильтру, продолжая нумерацию параметров после args.
+// Алиасы таблиц: us — user_subscriptions, sv — services, sp — service_plans.
+func filterCond(f model.SubscriptionFilter, args []interface{}) (string, []interface{}) {
+	var sb strings.Builder
+	next := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if f.UserID != "" {
+		sb.WriteString(" AND us.user_id=" + next(f.UserID) + "::uuid")
+	}
+	if f.ServiceName != "" {
+		sb.WriteString(" AND " + serviceNameCond(next(model.NormalizeServiceName(f.ServiceName))))
+	}
+	if f.Category != "" {
+		sb.WriteString(" AND sv.category=" + next(model.NormalizeLabel(f.Category)))
+	}
+	if f.Tag != "" {
+		sb.WriteString(" AND EXISTS (SELECT 1 FROM service_tags st WHERE st.service_id = sv.id AND st.tag=" +
+			next(model.NormalizeLabel(f.Tag)) + ")")
+	}
+	if f.Plan != "" {
+		sb.WriteString(" AND sp.normalized_name=" + next(model.NormalizeServiceName(f.Plan)))
+	}
+	if !f.ActiveFrom.IsZero() || !f.ActiveTo.IsZero() {
+		sb.WriteString(" AND us.active_months && daterange(" + next(monthParam(f.ActiveFrom)) + "::date, " +
+			next(monthParam(f.ActiveTo)) + "::date, '[]')")
+	}
+
+	return sb.String(), args
+}
+
+// monthParam — первое число месяца t (UTC) для параметра типа date, нулевое время — NULL (граница не задана)
+func monthParam(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return monthStart(t)
+}
+
+// monthStart — первое число месяца t в UTC
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// serviceNameCond — условие на сервис по нормализованному имени с учётом алиасов, param — плейсхолдер
+func serviceNameCond(param string) string {
+	return `(sv.normalized_name = ` + param + ` OR sv.id IN (
+	           SELECT sa.service_id FROM service_aliases sa WHERE sa.alias_normalized = ` + param + `))`
+}
+
+// ensureService возвращает id сервиса по имени или алиасу, создавая запись при необходимости.
+// В строгом режиме вместо создания возвращается ошибка с похожими именами.
+func (r *subscriptionRepository) ensureService(ctx context.Context, q querier, name string) (int, error) {
+	normalized := model.NormalizeServiceName(name)
+	if id, ok := r.resolved[normalized]; ok {
+		return id, nil
+	}
+	id, ok, gen := r.services.get(normalized)
+	if ok {
+		return id, nil
+	}
+
+	if r.strictCatalog {
+		id, ok, err := findService(ctx, q, normalized)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			services, err := listServices(ctx, q)
+			if err != nil {
+				return 0, err
+			}
+			return 0, &model.UnknownServiceError{Name: name, Suggestions: model.SuggestServiceNames(name, services)}
+		}
+		return r.remember(normalized, id, gen), nil
+	}
+
+	// один запрос: существующий сервис (имя важнее алиаса, как в findService) или вставка нового;
+	// DO UPDATE без изменений нужен, чтобы RETURNING вернул id строки, вставленной конкурентно
+	const upsert = `WITH known AS (
+	               SELECT id FROM services WHERE normalized_name=$2
+	               UNION ALL
+	               SELECT service_id FROM service_aliases WHERE alias_normalized=$2
+	               LIMIT 1
+	           ), ins AS (
+	               INSERT INTO services(name, normalized_name)
+	               SELECT $1, $2 WHERE NOT EXISTS (SELECT 1 FROM known)
+	               ON CONFLICT (normalized_name) DO UPDATE SET normalized_name = EXCLUDED.normalized_name
+	               RETURNING id
+	           )
+	           SELECT id FROM known UNION ALL SELECT id FROM ins`
+	if err := q.QueryRow(ctx, upsert, model.CleanServiceName(name), normalized).Scan(&id); err != nil {
 		return 0, err
 	}
-	const sel = `SELECT id FROM services WHERE name=$1`
+	return r.remember(normalized, id, gen), nil
+}
+
+// remember кэширует id сервиса; внутри транзакции — до её фиксации в resolved
+func (r *subscriptionRepository) remember(normalized string, id int, gen uint64) int {
+	if r.resolved != nil {
+		r.resolved[normalized] = id
+	} else {
+		r.services.put(normalized, id, gen)
+	}
+	return id
+}
+
+// findService ищет сервис по нормализованному имени, затем по алиасам
+func findService(ctx context.Context, q querier, normalized string) (int, bool, error) {
+	const sel = `SELECT id FROM services WHERE normalized_name=$1
+	           UNION ALL
+	           SELECT service_id FROM service_aliases WHERE alias_normalized=$1
+	           LIMIT 1`
 	var id int
-	if err := r.pool.QueryRow(ctx, sel, name).Scan(&id); err != nil {
-		return 0, err
+	err := q.QueryRow(ctx, sel, normalized).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
 	}
-	return id, nil
+	return id, true, nil
 }
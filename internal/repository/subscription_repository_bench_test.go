@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"subs-collector/internal/model"
+)
+
+// benchSubscriptions — размер синтетического набора подписок
+const benchSubscriptions = 200_000
+
+// legacyMonthsCTE и legacyMonthsFrom — прежняя развёртка через date_trunc по start_date/end_date, для сравнения
+const legacyMonthsCTE = `WITH months AS (
+	            SELECT
+	                generate_series(date_trunc('month', $1::timestamptz),
+	                date_trunc('month', $2::timestamptz), interval '1 month') AS m
+	     )
+	     `
+
+const legacyMonthsFrom = `
+	     FROM months mo
+	     JOIN user_subscriptions us
+	       ON date_trunc('month', us.start_date) <= mo.m
+	      AND (us.end_date IS NULL OR date_trunc('month', us.end_date) >= mo.m)
+	     JOIN services sv ON sv.id = us.service_id
+	     LEFT JOIN service_plans sp ON sp.id = us.plan_id
+	     LEFT JOIN LATERAL (
+	         SELECT pc.price FROM subscription_price_changes pc
+	         WHERE pc.subscription_id = us.id AND pc.effective_month <= mo.m
+	         ORDER BY pc.effective_month DESC LIMIT 1
+	     ) pc ON TRUE`
+
+// seedSubscriptions создаёт сервис со случайными подписками за 15 лет, удаляет их по окончании
+func seedSubscriptions(b *testing.B, r *subscriptionRepository, n int) string {
+	b.Helper()
+	ctx := context.Background()
+	name := fmt.Sprintf("bench-%d", time.Now().UnixNano())
+
+	var serviceID int
+	err := r.db.QueryRow(ctx, `INSERT INTO services(name, normalized_name) VALUES ($1, $2) RETURNING id`,
+		name, model.NormalizeServiceName(name)).Scan(&serviceID)
+	if err != nil {
+		b.Fatalf("seed service: %v", err)
+	}
+	b.Cleanup(func() {
+		_, _ = r.db.Exec(ctx, `DELETE FROM user_subscriptions WHERE service_id=$1`, serviceID)
+		_, _ = r.db.Exec(ctx, `DELETE FROM services WHERE id=$1`, serviceID)
+	})
+
+	const seed = `INSERT INTO user_subscriptions (service_id, price, user_id, start_date, end_date, allow_overlap)
+	           SELECT $1, 100 + (random() * 900)::int, gen_random_uuid(), g.s,
+	                  CASE WHEN random() < 0.2 THEN NULL ELSE g.s + (random() * 24)::int * interval '1 month' END, TRUE
+	           FROM (SELECT timestamptz '2010-01-01' + (random() * 180)::int * interval '1 month' AS s
+	                 FROM generate_series(1, $2)) g`
+	if _, err := r.db.Exec(ctx, seed, serviceID, n); err != nil {
+		b.Fatalf("seed subscriptions: %v", err)
+	}
+	if _, err := r.db.Exec(ctx, `ANALYZE user_subscriptions`); err != nil {
+		b.Fatalf("analyze: %v", err)
+	}
+	return name
+}
+
+// BenchmarkSumTotal сравнивает сводку за год с развёрткой по месяцам через active_months и через date_trunc
+func BenchmarkSumTotal(b *testing.B) {
+	r := NewSubscriptionRepository(testPool(b)).(*subscriptionRepository)
+	ctx := context.Background()
+	name := seedSubscriptions(b, r, benchSubscriptions)
+
+	from := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2018, 12, 1, 0, 0, 0, 0, time.UTC)
+	f := model.SubscriptionFilter{ServiceName: name}
+
+	var total, seriesTotal, legacyTotal int
+	b.Run("arithmetic", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var err error
+			if total, err = r.SumTotal(ctx, from, to, f); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("range", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var err error
+			if seriesTotal, err = seriesSumTotal(ctx, r, from, to, f); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("date_trunc", func(b *testing.B) {
+		cond, args := filterCond(f, []interface{}{from, to})
+		sql := legacyMonthsCTE + `SELECT COALESCE(SUM(` + seriesMonthPrice + `), 0)` + legacyMonthsFrom + ` WHERE TRUE` + cond
+		for i := 0; i < b.N; i++ {
+			if err := r.db.QueryRow(ctx, sql, args...).Scan(&legacyTotal); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	if total != seriesTotal || total != legacyTotal {
+		b.Fatalf("суммы расходятся: arithmetic %d, range %d, date_trunc %d", total, seriesTotal, legacyTotal)
+	}
+}
+
+// legacyEnsureService — прежнее разрешение сервиса: поиск, при отсутствии вставка и повторный поиск, для сравнения
+func legacyEnsureService(ctx context.Context, q querier, name string) (int, error) {
+	normalized := model.NormalizeServiceName(name)
+	if id, ok, err := findService(ctx, q, normalized); err != nil || ok {
+		return id, err
+	}
+	const ins = `INSERT INTO services(name, normalized_name) VALUES ($1, $2) ON CONFLICT DO NOTHING RETURNING id`
+	var id int
+	err := q.QueryRow(ctx, ins, model.CleanServiceName(name), normalized).Scan(&id)
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return id, err
+	}
+	id, _, err = findService(ctx, q, normalized)
+	return id, err
+}
+
+// BenchmarkCreate сравнивает запись подписки с прежним разрешением сервиса, с одним запросом upsert
+// и с кэшем id сервисов. Имена берутся по кругу из небольшого набора, как в обычной нагрузке.
+func BenchmarkCreate(b *testing.B) {
+	pool := testPool(b)
+	ctx := context.Background()
+	prefix := fmt.Sprintf("bench-create-%d-", time.Now().UnixNano())
+	names := make([]string, 20)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s%d", prefix, i)
+	}
+	b.Cleanup(func() {
+		const del = `DELETE FROM user_subscriptions WHERE service_id IN (SELECT id FROM services WHERE name LIKE $1)`
+		_, _ = pool.Exec(ctx, del, prefix+"%")
+		_, _ = pool.Exec(ctx, `DELETE FROM services WHERE name LIKE $1`, prefix+"%")
+	})
+
+	sub := func(i int) *model.Subscription {
+		return &model.Subscription{ServiceName: names[i%len(names)], Price: 100, UserID: uuid.NewString(),
+			StartDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), AllowOverlap: true}
+	}
+
+	b.Run("select_insert", func(b *testing.B) {
+		const ins = `INSERT INTO user_subscriptions (service_id, price, user_id, start_date, allow_overlap)
+		           VALUES ($1, $2, $3::uuid, $4, $5) RETURNING id`
+		for i := 0; i < b.N; i++ {
+			s := sub(i)
+			serviceID, err := legacyEnsureService(ctx, pool, s.ServiceName)
+			if err != nil {
+				b.Fatal(err)
+			}
+			var id int
+			if err := pool.QueryRow(ctx, ins, serviceID, s.Price, s.UserID, s.StartDate, s.AllowOverlap).Scan(&id); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	for _, c := range []struct {
+		name  string
+		cache *ServiceCache
+	}{
+		{"upsert", nil},
+		{"cached", NewServiceCache(len(names), time.Minute)},
+	} {
+		r := NewSubscriptionRepository(pool, WithServiceCache(c.cache))
+		b.Run(c.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := r.Create(ctx, sub(i)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
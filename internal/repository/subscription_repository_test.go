@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"subs-collector/internal/model"
+)
+
+// seriesMonthsCTE и seriesMonthsFrom — прежняя реализация сводки: развёртка периода по месяцам
+// и соединение каждого месяца с активными подписками. Эталон для сравнения с арифметическим подсчётом.
+const seriesMonthsCTE = `WITH months AS (
+	            SELECT
+	                generate_series(date_trunc('month', $1::timestamptz AT TIME ZONE 'UTC'),
+	                date_trunc('month', $2::timestamptz AT TIME ZONE 'UTC'), interval '1 month')::date AS m
+	     )
+	     `
+
+const seriesMonthsFrom = `
+	     FROM months mo
+	     JOIN user_subscriptions us ON us.active_months @> mo.m
+	     JOIN services sv ON sv.id = us.service_id
+	     LEFT JOIN service_plans sp ON sp.id = us.plan_id
+	     LEFT JOIN LATERAL (
+	         SELECT pc.price FROM subscription_price_changes pc
+	         WHERE pc.subscription_id = us.id AND pc.effective_month <= mo.m
+	         ORDER BY pc.effective_month DESC LIMIT 1
+	     ) pc ON TRUE`
+
+const seriesMonthPrice = `COALESCE(pc.price, us.price)`
+
+func seriesSumTotal(ctx context.Context, r *subscriptionRepository, from, to time.Time, f model.SubscriptionFilter) (int, error) {
+	cond, args := filterCond(f, []interface{}{from, to})
+	sql := seriesMonthsCTE + `SELECT COALESCE(SUM(` + seriesMonthPrice + `), 0)` + seriesMonthsFrom + ` WHERE TRUE` + cond
+
+	var total int
+	err := r.db.QueryRow(ctx, sql, args...).Scan(&total)
+	return total, err
+}
+
+func seriesSumGrouped(ctx context.Context, r *subscriptionRepository, from, to time.Time, f model.SubscriptionFilter, by string) (map[string]int, error) {
+	cond, args := filterCond(f, []interface{}{from, to})
+	sql := seriesMonthsCTE + `SELECT COALESCE(` + groupExprs[by] + `, ''), SUM(` + seriesMonthPrice + `)::int` + seriesMonthsFrom +
+		` JOIN services es ON es.id = sv.id WHERE TRUE` + cond + ` GROUP BY 1`
+
+	rows, err := r.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := map[string]int{}
+	for rows.Next() {
+		var key string
+		var total int
+		if err := rows.Scan(&key, &total); err != nil {
+			return nil, err
+		}
+		res[key] = total
+	}
+	return res, rows.Err()
+}
+
+// randomMonth — первое число случайного месяца 2020–2024, иногда со сдвигом внутрь месяца
+func randomMonth(rnd *rand.Rand) time.Time {
+	t := time.Date(2020+rnd.Intn(5), time.Month(1+rnd.Intn(12)), 1, 0, 0, 0, 0, time.UTC)
+	if rnd.Intn(4) == 0 {
+		t = t.AddDate(0, 0, rnd.Intn(27))
+	}
+	return t
+}
+
+// TestSumTotal_MatchesMonthSeries сравнивает арифметический подсчёт SumTotal и SumGrouped, а также чтение
+// из monthly_spend с помесячной развёрткой на случайных подписках с историей цен
+func TestSumTotal_MatchesMonthSeries(t *testing.T) {
+	pool := testPool(t)
+	r := NewSubscriptionRepository(pool).(*subscriptionRepository)
+	spend := NewSubscriptionRepository(pool, WithMonthlySpend(true))
+	ctx := context.Background()
+
+	seed := time.Now().UnixNano()
+	t.Logf("seed %d", seed)
+	rnd := rand.New(rand.NewSource(seed))
+
+	users := []string{uuid.NewString(), uuid.NewString(), uuid.NewString()}
+	services := make([]string, 3)
+	for i := range services {
+		services[i] = fmt.Sprintf("prop-%d-%d", seed, i)
+		id, err := r.ensureService(ctx, r.db, services[i])
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_, _ = r.db.Exec(ctx, `DELETE FROM user_subscriptions WHERE service_id=$1`, id)
+			_, _ = r.db.Exec(ctx, `DELETE FROM services WHERE id=$1`, id)
+		})
+	}
+
+	for i := 0; i < 40; i++ {
+		start := randomMonth(rnd)
+		var end *time.Time
+		if rnd.Intn(3) > 0 {
+			e := start.AddDate(0, rnd.Intn(30), rnd.Intn(20))
+			end = &e
+		}
+		// AllowOverlap — случайные периоды одного пользователя и сервиса могут пересекаться
+		s := &model.Subscription{
+			ServiceName:  services[rnd.Intn(len(services))],
+			Price:        1 + rnd.Intn(1000),
+			UserID:       users[rnd.Intn(len(users))],
+			StartDate:    start,
+			EndDate:      end,
+			AllowOverlap: true,
+		}
+		id, err := r.Create(ctx, s)
+		require.NoError(t, err)
+
+		for j := rnd.Intn(4); j > 0; j-- {
+			_, err := r.db.Exec(ctx, `INSERT INTO subscription_price_changes (subscription_id, effective_month, price)
+			                         VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`, id, randomMonth(rnd), 1+rnd.Intn(1000))
+			require.NoError(t, err)
+		}
+	}
+
+	for i := 0; i < 50; i++ {
+		from := randomMonth(rnd)
+		to := from.AddDate(0, rnd.Intn(36), 0)
+		f := model.SubscriptionFilter{ServiceName: services[rnd.Intn(len(services))]}
+		if rnd.Intn(2) == 0 {
+			f.UserID = users[rnd.Intn(len(users))]
+		}
+
+		want, err := seriesSumTotal(ctx, r, from, to, f)
+		require.NoError(t, err)
+		got, err := r.SumTotal(ctx, from, to, f)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, "SumTotal %s..%s %+v", from, to, f)
+		got, err = spend.SumTotal(ctx, from, to, f)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, "SumTotal monthly_spend %s..%s %+v", from, to, f)
+
+		wantGroups, err := seriesSumGrouped(ctx, r, from, to, f, model.GroupByService)
+		require.NoError(t, err)
+		groups, err := r.SumGrouped(ctx, from, to, f, model.Grouping{By: model.GroupByService})
+		require.NoError(t, err)
+		gotGroups := map[string]int{}
+		for _, g := range groups {
+			gotGroups[*g.Key] = g.Total
+		}
+		assert.Equal(t, wantGroups, gotGroups, "SumGrouped %s..%s %+v", from, to, f)
+	}
+}
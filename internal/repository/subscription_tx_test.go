@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"subs-collector/internal/model"
+)
+
+// TestWithTx_RollsBack — ошибка fn откатывает и подписку, и созданный для неё сервис;
+// ошибка вложенного WithTx откатывает только его точку сохранения
+func TestWithTx_RollsBack(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	r := NewSubscriptionRepository(pool)
+
+	user := uuid.NewString()
+	service := "tx-" + uuid.NewString()[:8]
+	normalized := model.NormalizeServiceName(service)
+	t.Cleanup(func() {
+		_, _ = pool.Exec(ctx, `DELETE FROM user_subscriptions WHERE user_id=$1`, user)
+		_, _ = pool.Exec(ctx, `DELETE FROM services WHERE normalized_name=$1`, normalized)
+	})
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	count := func(sql string, arg string) int {
+		var n int
+		require.NoError(t, pool.QueryRow(ctx, sql, arg).Scan(&n))
+		return n
+	}
+
+	boom := errors.New("boom")
+	err := r.WithTx(ctx, func(tx SubscriptionRepository) error {
+		if _, err := tx.Create(ctx, &model.Subscription{ServiceName: service, Price: 100, UserID: user, StartDate: start}); err != nil {
+			return err
+		}
+		return boom
+	})
+	assert.ErrorIs(t, err, boom)
+	assert.Zero(t, count(`SELECT count(*) FROM user_subscriptions WHERE user_id=$1`, user))
+	assert.Zero(t, count(`SELECT count(*) FROM services WHERE normalized_name=$1`, normalized))
+
+	err = r.WithTx(ctx, func(tx SubscriptionRepository) error {
+		if _, err := tx.Create(ctx, &model.Subscription{ServiceName: service, Price: 100, UserID: user, StartDate: start}); err != nil {
+			return err
+		}
+		inner := tx.WithTx(ctx, func(sp SubscriptionRepository) error {
+			if _, err := sp.Create(ctx, &model.Subscription{ServiceName: service, Price: 200, UserID: user, StartDate: start.AddDate(1, 0, 0)}); err != nil {
+				return err
+			}
+			return boom
+		})
+		assert.ErrorIs(t, inner, boom)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count(`SELECT count(*) FROM user_subscriptions WHERE user_id=$1`, user))
+}
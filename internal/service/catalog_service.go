@@ -0,0 +1,260 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"subs-collector/internal/model"
+	"subs-collector/internal/repository"
+)
+
+type CatalogService interface {
+	ListServices(ctx context.Context) ([]model.Service, error)
+	GetService(ctx context.Context, id int) (*model.Service, error)
+	SetLabels(ctx context.Context, id int, category *string, tags []string) (*model.Service, error)
+	AddAlias(ctx context.Context, serviceID int, alias string) error
+	SetComponents(ctx context.Context, bundleID int, components []model.BundleComponent) (*model.Service, error)
+	ListPlans(ctx context.Context, serviceID int) ([]model.Plan, error)
+	CreatePlan(ctx context.Context, p *model.Plan) (int, error)
+	Deduplicate(ctx context.Context, apply bool) ([]model.DuplicateGroup, error)
+	ChangePrice(ctx context.Context, c model.ServicePriceChange, dryRun bool) (*model.PriceChangeResult, error)
+	ImportCatalog(ctx context.Context, version int, entries []model.CatalogEntry, dryRun bool) ([]model.ImportResult, error)
+	MergeServices(ctx context.Context, sourceID, targetID int, dryRun bool) (*model.MergeResult, error)
+}
+
+type catalogService struct {
+	repo repository.CatalogRepository
+	// changed вызывается после изменений справочника, меняющих суммы подписок
+	changed func()
+}
+
+// CatalogOption — необязательная настройка сервиса справочника
+type CatalogOption func(*catalogService)
+
+// WithCatalogChangeHook задаёт fn, вызываемую после изменений справочника, от которых зависят сводки
+// (цены, слияния, алиасы, категории, состав пакетов): например, сброс кэша сводок
+func WithCatalogChangeHook(fn func()) CatalogOption {
+	return func(s *catalogService) { s.changed = fn }
+}
+
+func NewCatalogService(repo repository.CatalogRepository, opts ...CatalogOption) CatalogService {
+	s := &catalogService{repo: repo, changed: func() {}}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *catalogService) ListServices(ctx context.Context) ([]model.Service, error) {
+	return s.repo.ListServices(ctx)
+}
+
+func (s *catalogService) GetService(ctx context.Context, id int) (*model.Service, error) {
+	return s.repo.GetService(ctx, id)
+}
+
+// SetLabels нормализует категорию и теги (пустые отбрасываются, дубликаты схлопываются) и сохраняет их
+func (s *catalogService) SetLabels(ctx context.Context, id int, category *string, tags []string) (*model.Service, error) {
+	if category != nil {
+		c := model.NormalizeLabel(*category)
+		category = &c
+		if c == "" {
+			category = nil
+		}
+	}
+
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, t := range tags {
+		t = model.NormalizeLabel(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		normalized = append(normalized, t)
+	}
+	sort.Strings(normalized)
+
+	if err := s.repo.SetLabels(ctx, id, category, normalized); err != nil {
+		return nil, err
+	}
+	s.changed()
+	return s.repo.GetService(ctx, id)
+}
+
+func (s *catalogService) AddAlias(ctx context.Context, serviceID int, alias string) error {
+	if err := s.repo.AddAlias(ctx, serviceID, alias); err != nil {
+		return err
+	}
+	s.changed()
+	return nil
+}
+
+func (s *catalogService) MergeServices(ctx context.Context, sourceID, targetID int, dryRun bool) (*model.MergeResult, error) {
+	res, err := s.repo.MergeServices(ctx, sourceID, targetID, dryRun)
+	if err == nil && !dryRun {
+		s.changed()
+	}
+	return res, err
+}
+
+// SetComponents проверяет состав пакета (доля по умолчанию 1, без повторов и ссылок на себя) и сохраняет его
+func (s *catalogService) SetComponents(ctx context.Context, bundleID int, components []model.BundleComponent) (*model.Service, error) {
+	seen := make(map[int]bool, len(components))
+	for i := range components {
+		c := &components[i]
+		if c.ServiceID == bundleID {
+			return nil, &model.ErrInvalid{Msg: "bundle cannot include itself"}
+		}
+		if seen[c.ServiceID] {
+			return nil, &model.ErrInvalid{Msg: "duplicate component"}
+		}
+		seen[c.ServiceID] = true
+		if c.Share == 0 {
+			c.Share = 1
+		}
+		if c.Share < 0 {
+			return nil, &model.ErrInvalid{Msg: "share must be positive"}
+		}
+	}
+
+	if err := s.repo.SetComponents(ctx, bundleID, components); err != nil {
+		return nil, err
+	}
+	s.changed()
+	return s.repo.GetService(ctx, bundleID)
+}
+
+func (s *catalogService) ListPlans(ctx context.Context, serviceID int) ([]model.Plan, error) {
+	if _, err := s.repo.GetService(ctx, serviceID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListPlans(ctx, serviceID)
+}
+
+// CreatePlan проверяет тариф и подставляет значения по умолчанию: помесячная оплата и DefaultCurrency
+func (s *catalogService) CreatePlan(ctx context.Context, p *model.Plan) (int, error) {
+	p.Name = model.CleanServiceName(p.Name)
+	if p.Name == "" {
+		return 0, &model.ErrInvalid{Msg: "plan name is required"}
+	}
+	if p.Price < 0 {
+		return 0, &model.ErrInvalid{Msg: "price must not be negative"}
+	}
+	switch p.BillingPeriod {
+	case "":
+		p.BillingPeriod = model.BillingMonthly
+	case model.BillingMonthly, model.BillingYearly:
+	default:
+		return 0, &model.ErrInvalid{Msg: "billing_period must be month or year"}
+	}
+	p.Currency = strings.ToUpper(strings.TrimSpace(p.Currency))
+	if p.Currency == "" {
+		p.Currency = model.DefaultCurrency
+	}
+	if len(p.Currency) != 3 {
+		return 0, &model.ErrInvalid{Msg: "currency must be a 3-letter code"}
+	}
+
+	return s.repo.CreatePlan(ctx, p)
+}
+
+// Deduplicate пересчитывает нормализованные имена и группирует сервисы-дубликаты.
+// Каноническим считается самый старый сервис группы; при apply остальные сливаются в него.
+func (s *catalogService) Deduplicate(ctx context.Context, apply bool) ([]model.DuplicateGroup, error) {
+	if apply {
+		// в том числе после ошибки: часть слияний уже зафиксирована
+		defer s.changed()
+	}
+	services, err := s.repo.ListServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string][]model.Service)
+	stale := make(map[int]bool) // сохранённое нормализованное имя отличается от вычисленного
+	for _, sv := range services {
+		normalized := model.NormalizeServiceName(sv.Name)
+		stale[sv.ID] = normalized != sv.NormalizedName
+		sv.NormalizedName = normalized
+		byName[normalized] = append(byName[normalized], sv)
+	}
+
+	groups := make([]model.DuplicateGroup, 0)
+	for name, list := range byName {
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+		if len(list) < 2 {
+			continue
+		}
+		groups = append(groups, model.DuplicateGroup{NormalizedName: name, Canonical: list[0], Duplicates: list[1:]})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Canonical.ID < groups[j].Canonical.ID })
+
+	if !apply {
+		return groups, nil
+	}
+
+	for _, g := range groups {
+		for _, d := range g.Duplicates {
+			if _, err := s.repo.MergeServices(ctx, d.ID, g.Canonical.ID, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// имя пишется только каноническим сервисам и после слияний: дубликаты, у которых сохранённые имена
+	// различались (lower() миграции 002 против case-fold: «Straße» и «STRASSE»), нарушили бы уникальный индекс
+	for _, sv := range services {
+		normalized := model.NormalizeServiceName(sv.Name)
+		if !stale[sv.ID] || byName[normalized][0].ID != sv.ID {
+			continue
+		}
+		if err := s.repo.SetNormalizedName(ctx, sv.ID, normalized); err != nil {
+			return nil, err
+		}
+	}
+
+	return groups, nil
+}
+
+// ChangePrice нормализует месяц и валюту изменения цены и применяет его к активным подпискам сервиса
+func (s *catalogService) ChangePrice(ctx context.Context, c model.ServicePriceChange, dryRun bool) (*model.PriceChangeResult, error) {
+	if c.Price < 0 {
+		return nil, &model.ErrInvalid{Msg: "price must not be negative"}
+	}
+	if c.EffectiveMonth.IsZero() {
+		return nil, &model.ErrInvalid{Msg: "effective_month is required"}
+	}
+	c.EffectiveMonth = time.Date(c.EffectiveMonth.Year(), c.EffectiveMonth.Month(), 1, 0, 0, 0, 0, time.UTC)
+	c.Currency = strings.ToUpper(strings.TrimSpace(c.Currency))
+
+	res, err := s.repo.ApplyPriceChange(ctx, c, dryRun)
+	if err == nil && !dryRun {
+		s.changed()
+	}
+	return res, err
+}
+
+// ImportCatalog загружает записи встроенного каталога в справочник, категории нормализуются как при ручном вводе
+func (s *catalogService) ImportCatalog(ctx context.Context, version int, entries []model.CatalogEntry, dryRun bool) ([]model.ImportResult, error) {
+	if !dryRun {
+		defer s.changed()
+	}
+	res := make([]model.ImportResult, 0, len(entries))
+	for _, e := range entries {
+		if e.Category != nil {
+			c := model.NormalizeLabel(*e.Category)
+			e.Category = &c
+		}
+		r, err := s.repo.ImportCatalogEntry(ctx, e, version, dryRun)
+		if err != nil {
+			return res, fmt.Errorf("import %q: %w", e.Name, err)
+		}
+		res = append(res, *r)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"subs-collector/internal/model"
+	rmocks "subs-collector/internal/repository/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func duplicateServices() []model.Service {
+	return []model.Service{
+		{ID: 1, Name: "YouTube Premium", NormalizedName: "youtube premium"},
+		{ID: 2, Name: "MusicBox", NormalizedName: "musicbox"},
+		{ID: 3, Name: "Youtube  premium", NormalizedName: "youtube  premium"},
+	}
+}
+
+// TestDeduplicate_ReportOnly — без apply только отчёт, без изменений в репозитории
+func TestDeduplicate_ReportOnly(t *testing.T) {
+	m := new(rmocks.CatalogRepository)
+	m.On("ListServices", mock.Anything).Return(duplicateServices(), nil)
+
+	s := NewCatalogService(m)
+	groups, err := s.Deduplicate(context.Background(), false)
+	assert.NoError(t, err)
+	assert.Len(t, groups, 1)
+	assert.Equal(t, 1, groups[0].Canonical.ID)
+	assert.Equal(t, 3, groups[0].Duplicates[0].ID)
+	m.AssertNotCalled(t, "MergeServices", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	m.AssertNotCalled(t, "SetNormalizedName", mock.Anything, mock.Anything, mock.Anything)
+}
+
+// TestDeduplicate_Apply — с apply дубликаты сливаются в старейший сервис, затем исправляется его
+// нормализованное имя; имена дубликатов не трогаются, даже если отличаются от вычисленных
+func TestDeduplicate_Apply(t *testing.T) {
+	m := new(rmocks.CatalogRepository)
+	var calls []string
+	record := func(args mock.Arguments) { calls = append(calls, fmt.Sprint(args[1:])) }
+	m.On("ListServices", mock.Anything).Return(append(duplicateServices(),
+		model.Service{ID: 4, Name: "Straße", NormalizedName: "straße"},
+		model.Service{ID: 5, Name: "STRASSE", NormalizedName: "strasse"},
+	), nil)
+	m.On("MergeServices", mock.Anything, mock.Anything, mock.Anything, false).Run(record).Return(&model.MergeResult{}, nil)
+	m.On("SetNormalizedName", mock.Anything, 4, "strasse").Run(record).Return(nil)
+
+	s := NewCatalogService(m)
+	groups, err := s.Deduplicate(context.Background(), true)
+	assert.NoError(t, err)
+	assert.Len(t, groups, 2)
+	assert.Equal(t, []string{"[3 1 false]", "[5 4 false]", "[4 strasse]"}, calls)
+	m.AssertExpectations(t)
+}
+
+// TestSetLabels_Normalizes — категория и теги нормализуются, пустые и повторные теги отбрасываются
+func TestSetLabels_Normalizes(t *testing.T) {
+	category := "  Video "
+	m := new(rmocks.CatalogRepository)
+	m.On("SetLabels", mock.Anything, 7, mock.MatchedBy(func(c *string) bool { return c != nil && *c == "video" }),
+		[]string{"family", "hd"}).Return(nil)
+	m.On("GetService", mock.Anything, 7).Return(&model.Service{ID: 7}, nil)
+
+	s := NewCatalogService(m)
+	_, err := s.SetLabels(context.Background(), 7, &category, []string{"HD", "family", " ", "hd"})
+	assert.NoError(t, err)
+	m.AssertExpectations(t)
+}
+
+// TestCreatePlan_Defaults — период и валюта по умолчанию, неверный период отклоняется
+func TestCreatePlan_Defaults(t *testing.T) {
+	m := new(rmocks.CatalogRepository)
+	m.On("CreatePlan", mock.Anything, mock.MatchedBy(func(p *model.Plan) bool {
+		return p.Name == "Premium" && p.BillingPeriod == model.BillingMonthly && p.Currency == model.DefaultCurrency
+	})).Return(4, nil)
+
+	s := NewCatalogService(m)
+	id, err := s.CreatePlan(context.Background(), &model.Plan{ServiceID: 1, Name: " Premium ", Price: 799})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, id)
+
+	_, err = s.CreatePlan(context.Background(), &model.Plan{ServiceID: 1, Name: "Basic", BillingPeriod: "week"})
+	var invalid *model.ErrInvalid
+	assert.ErrorAs(t, err, &invalid)
+	m.AssertExpectations(t)
+}
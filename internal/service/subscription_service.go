@@ -2,6 +2,8 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"subs-collector/internal/model"
@@ -13,23 +15,77 @@ type SubscriptionService interface {
 	GetByID(ctx context.Context, id int) (*model.Subscription, error)
 	Update(ctx context.Context, id int, s *model.Subscription) error
 	Delete(ctx context.Context, id int) error
-	List(ctx context.Context, userID string, serviceName string) ([]model.Subscription, error)
-	SumTotal(ctx context.Context, from time.Time, to time.Time, userID string, serviceName string) (int, error)
+	List(ctx context.Context, f model.SubscriptionFilter) ([]model.Subscription, error)
+	ListEach(ctx context.Context, f model.SubscriptionFilter, fn func(model.Subscription) error) error
+	SumTotal(ctx context.Context, from time.Time, to time.Time, f model.SubscriptionFilter) (int, error)
+	SumGrouped(ctx context.Context, from time.Time, to time.Time, f model.SubscriptionFilter, g model.Grouping) ([]model.SummaryGroup, error)
+	BundleOverlaps(ctx context.Context, userID string) ([]model.BundleOverlap, error)
+	Overlaps(ctx context.Context, userID string) ([]model.SubscriptionOverlap, error)
+	Import(ctx context.Context, rows []model.ImportRow, mode string, dryRun bool) (*model.ImportReport, error)
+	Batch(ctx context.Context, ops []model.BatchOp, continueOnError bool) (*model.BatchReport, error)
 }
 
 type subscriptionService struct {
-	repo repository.SubscriptionRepository
+	repo          repository.SubscriptionRepository
+	overlapPolicy string
 }
 
-func NewSubscriptionService(repo repository.SubscriptionRepository) SubscriptionService {
-	return &subscriptionService{repo: repo}
+// Option — необязательная настройка сервиса подписок
+type Option func(*subscriptionService)
+
+// WithOverlapPolicy задаёт реакцию на пересечение подписок: model.OverlapReject (ошибка model.ErrOverlap)
+// или model.OverlapWarn (подписка сохраняется с пометкой allow_overlap)
+func WithOverlapPolicy(policy string) Option {
+	return func(s *subscriptionService) { s.overlapPolicy = policy }
+}
+
+func NewSubscriptionService(repo repository.SubscriptionRepository, opts ...Option) SubscriptionService {
+	s := &subscriptionService{repo: repo, overlapPolicy: model.OverlapWarn}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *subscriptionService) Create(ctx context.Context, sub *model.Subscription) (int, error) {
 	if sub.StartDate.IsZero() {
 		sub.StartDate = time.Now().UTC()
 	}
-	return s.repo.Create(ctx, sub)
+	return s.create(ctx, s.repo, sub)
+}
+
+// create пишет подписку через repo с учётом политики пересечений. Каждая попытка идёт в своей транзакции
+// (внутри WithTx — в точке сохранения), поэтому неудачная запись не оставляет созданный для неё сервис.
+func (s *subscriptionService) create(ctx context.Context, repo repository.SubscriptionRepository, sub *model.Subscription) (int, error) {
+	var id int
+	err := s.withOverlapPolicy(sub, func() error {
+		return repo.WithTx(ctx, func(tx repository.SubscriptionRepository) (err error) {
+			id, err = tx.Create(ctx, sub)
+			return err
+		})
+	})
+	return id, err
+}
+
+func (s *subscriptionService) update(ctx context.Context, repo repository.SubscriptionRepository, id int, sub *model.Subscription) error {
+	return s.withOverlapPolicy(sub, func() error {
+		return repo.WithTx(ctx, func(tx repository.SubscriptionRepository) error {
+			return tx.Update(ctx, id, sub)
+		})
+	})
+}
+
+// withOverlapPolicy сначала пишет подписку с проверкой пересечений; при пересечении в режиме warn
+// повторяет запись с пометкой allow_overlap, в режиме reject возвращает model.ErrOverlap
+func (s *subscriptionService) withOverlapPolicy(sub *model.Subscription, write func() error) error {
+	sub.AllowOverlap = false
+	err := write()
+	if !errors.Is(err, model.ErrOverlap) || s.overlapPolicy != model.OverlapWarn {
+		return err
+	}
+
+	sub.AllowOverlap = true
+	return write()
 }
 
 func (s *subscriptionService) GetByID(ctx context.Context, id int) (*model.Subscription, error) {
@@ -37,23 +93,173 @@ func (s *subscriptionService) GetByID(ctx context.Context, id int) (*model.Subsc
 }
 
 func (s *subscriptionService) Update(ctx context.Context, id int, sub *model.Subscription) error {
-	return s.repo.Update(ctx, id, sub)
+	return s.update(ctx, s.repo, id, sub)
 }
 
 func (s *subscriptionService) Delete(ctx context.Context, id int) error {
 	return s.repo.Delete(ctx, id)
 }
 
-func (s *subscriptionService) List(ctx context.Context, userID string, serviceName string) ([]model.Subscription, error) {
-	return s.repo.List(ctx, userID, serviceName)
+func (s *subscriptionService) List(ctx context.Context, f model.SubscriptionFilter) ([]model.Subscription, error) {
+	return s.repo.List(ctx, f)
+}
+
+func (s *subscriptionService) ListEach(ctx context.Context, f model.SubscriptionFilter, fn func(model.Subscription) error) error {
+	return s.repo.ListEach(ctx, f, fn)
 }
 
 // SumTotal нормализует границы периода к первому числу месяца и считает сумму
-func (s *subscriptionService) SumTotal(ctx context.Context, from time.Time, to time.Time, userID string, serviceName string) (int, error) {
+func (s *subscriptionService) SumTotal(ctx context.Context, from time.Time, to time.Time, f model.SubscriptionFilter) (int, error) {
 	if to.Before(from) {
 		return 0, nil
 	}
-	from = time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
-	to = time.Date(to.Year(), to.Month(), 1, 0, 0, 0, 0, time.UTC)
-	return s.repo.SumTotal(ctx, from, to, userID, serviceName)
+	from, to = monthStart(from), monthStart(to)
+	return s.repo.SumTotal(ctx, from, to, f)
+}
+
+// SumGrouped — SumTotal с разбивкой по группам, пустой период даёт пустой список
+func (s *subscriptionService) SumGrouped(ctx context.Context, from time.Time, to time.Time, f model.SubscriptionFilter, g model.Grouping) ([]model.SummaryGroup, error) {
+	if to.Before(from) {
+		return []model.SummaryGroup{}, nil
+	}
+	from, to = monthStart(from), monthStart(to)
+	return s.repo.SumGrouped(ctx, from, to, f, g)
+}
+
+// BundleOverlaps возвращает пересечения пакетов с входящими в них сервисами, пустой userID — по всем
+func (s *subscriptionService) BundleOverlaps(ctx context.Context, userID string) ([]model.BundleOverlap, error) {
+	return s.repo.FindBundleOverlaps(ctx, userID)
+}
+
+// Overlaps возвращает пары пересекающихся подписок одного пользователя на один сервис, пустой userID — по всем
+func (s *subscriptionService) Overlaps(ctx context.Context, userID string) ([]model.SubscriptionOverlap, error) {
+	return s.repo.FindOverlaps(ctx, userID)
+}
+
+// Import сохраняет разобранные строки: строки с ошибкой разбора сразу попадают в отчёт как failed,
+// остальные репозиторий пишет одной транзакцией. mode — model.ImportPerRow (по умолчанию)
+// или model.ImportAllOrNothing, dryRun только проверяет строки.
+func (s *subscriptionService) Import(ctx context.Context, rows []model.ImportRow, mode string, dryRun bool) (*model.ImportReport, error) {
+	if mode == "" {
+		mode = model.ImportPerRow
+	}
+	if mode != model.ImportPerRow && mode != model.ImportAllOrNothing {
+		return nil, &model.ErrInvalid{Msg: "unsupported import mode"}
+	}
+
+	report := &model.ImportReport{Mode: mode, DryRun: dryRun, Total: len(rows), Rows: make([]model.ImportRowResult, len(rows))}
+	subs := make([]*model.Subscription, 0, len(rows))
+	idx := make([]int, 0, len(rows))
+	for i, row := range rows {
+		if row.Err != nil {
+			report.Rows[i] = model.ImportRowResult{Status: model.ImportRowFailed, Err: row.Err}
+			continue
+		}
+		sub := row.Subscription
+		if sub.StartDate.IsZero() {
+			sub.StartDate = time.Now().UTC()
+		}
+		subs = append(subs, &sub)
+		idx = append(idx, i)
+	}
+
+	if len(subs) > 0 {
+		// при all_or_nothing строки с ошибкой разбора отменяют запись, остальные только проверяются
+		rejected := mode == model.ImportAllOrNothing && len(subs) < len(rows)
+		results, committed, err := s.repo.Import(ctx, subs, model.ImportOptions{
+			AllOrNothing: mode == model.ImportAllOrNothing,
+			DryRun:       dryRun || rejected,
+			RetryOverlap: s.overlapPolicy == model.OverlapWarn,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for j, res := range results {
+			if rejected && !dryRun && res.Status == model.ImportRowValid {
+				res.Status = model.ImportRowRolledBack
+			}
+			report.Rows[idx[j]] = res
+		}
+		report.Committed = committed
+	}
+
+	for i := range report.Rows {
+		res := &report.Rows[i]
+		res.Line = rows[i].Line
+		if res.Status == model.ImportRowFailed {
+			report.Failed++
+			res.Error = res.Err.Error()
+			var unknown *model.UnknownServiceError
+			if errors.As(res.Err, &unknown) {
+				res.Suggestions = unknown.Suggestions
+			}
+		} else if res.Status != model.ImportRowRolledBack {
+			report.Succeeded++
+		}
+	}
+
+	return report, nil
+}
+
+// Batch выполняет операции пакета в одной транзакции. Операции с ошибкой разбора без continueOnError
+// отменяют пакет целиком, ни одна операция не выполняется.
+func (s *subscriptionService) Batch(ctx context.Context, ops []model.BatchOp, continueOnError bool) (*model.BatchReport, error) {
+	if len(ops) == 0 {
+		return nil, &model.ErrInvalid{Msg: "empty batch"}
+	}
+	if len(ops) > model.BatchMaxOps {
+		return nil, &model.ErrInvalid{Msg: fmt.Sprintf("batch too large: at most %d operations", model.BatchMaxOps)}
+	}
+
+	report := &model.BatchReport{ContinueOnError: continueOnError, Results: make([]model.BatchOpResult, len(ops))}
+	valid := make([]model.BatchOp, 0, len(ops))
+	idx := make([]int, 0, len(ops))
+	for i, op := range ops {
+		if op.Err != nil {
+			report.Results[i] = model.BatchOpResult{Op: op.Op, Status: model.BatchOpFailed, ID: op.ID, Err: op.Err}
+			continue
+		}
+		if op.Op == model.BatchCreate && op.Subscription.StartDate.IsZero() {
+			op.Subscription.StartDate = time.Now().UTC()
+		}
+		report.Results[i] = model.BatchOpResult{Op: op.Op, Status: model.BatchOpSkipped, ID: op.ID}
+		valid = append(valid, op)
+		idx = append(idx, i)
+	}
+
+	if len(valid) > 0 && (continueOnError || len(valid) == len(ops)) {
+		results, committed, err := s.repo.Batch(ctx, valid, model.BatchOptions{
+			ContinueOnError: continueOnError,
+			RetryOverlap:    s.overlapPolicy == model.OverlapWarn,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for j, res := range results {
+			report.Results[idx[j]] = res
+		}
+		report.Committed = committed
+	}
+
+	for i := range report.Results {
+		res := &report.Results[i]
+		res.Index = i
+		switch res.Status {
+		case model.BatchOpFailed:
+			report.Failed++
+			res.Error = res.Err.Error()
+			var unknown *model.UnknownServiceError
+			if errors.As(res.Err, &unknown) {
+				res.Suggestions = unknown.Suggestions
+			}
+		case model.BatchOpOK:
+			report.Succeeded++
+		}
+	}
+
+	return report, nil
+}
+
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
 }
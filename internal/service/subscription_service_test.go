@@ -19,10 +19,10 @@ func TestSumTotal_NormalizesDates(t *testing.T) {
 	to := time.Date(2025, 9, 20, 10, 0, 0, 0, time.UTC)
 
 	m := new(rmocks.SubscriptionRepository)
-	m.On("SumTotal", mock.Anything, mock.MatchedBy(func(ti time.Time) bool { return ti.Day() == 1 }), mock.MatchedBy(func(ti time.Time) bool { return ti.Day() == 1 }), "", "").Return(1200, nil)
+	m.On("SumTotal", mock.Anything, mock.MatchedBy(func(ti time.Time) bool { return ti.Day() == 1 }), mock.MatchedBy(func(ti time.Time) bool { return ti.Day() == 1 }), model.SubscriptionFilter{}).Return(1200, nil)
 
 	s := NewSubscriptionService(m)
-	total, err := s.SumTotal(context.Background(), from, to, "", "")
+	total, err := s.SumTotal(context.Background(), from, to, model.SubscriptionFilter{})
 	assert.NoError(t, err)
 	assert.Equal(t, 1200, total)
 	m.AssertExpectations(t)
@@ -31,6 +31,7 @@ func TestSumTotal_NormalizesDates(t *testing.T) {
 // TestCreate_SetsStartDateIfZero — если дата не задана, сервис подставляет текущую
 func TestCreate_SetsStartDateIfZero(t *testing.T) {
 	m := new(rmocks.SubscriptionRepository)
+	m.On("WithTx", mock.Anything).Return(nil)
 	m.On("Create", mock.Anything, mock.AnythingOfType("*model.Subscription")).Return(1, nil)
 	s := NewSubscriptionService(m)
 	sub := &model.Subscription{}
@@ -41,8 +42,137 @@ func TestCreate_SetsStartDateIfZero(t *testing.T) {
 // TestList_ErrorPropagates — ошибка из репозитория пробрасывается наверх
 func TestList_ErrorPropagates(t *testing.T) {
 	m := new(rmocks.SubscriptionRepository)
-	m.On("List", mock.Anything, "", "").Return(nil, errors.New("boom"))
+	m.On("List", mock.Anything, model.SubscriptionFilter{}).Return(nil, errors.New("boom"))
 	s := NewSubscriptionService(m)
-	_, err := s.List(context.Background(), "", "")
+	_, err := s.List(context.Background(), model.SubscriptionFilter{})
 	assert.Error(t, err)
 }
+
+// TestCreate_OverlapWarn — в режиме warn пересекающаяся подписка сохраняется повторно с allow_overlap
+func TestCreate_OverlapWarn(t *testing.T) {
+	m := new(rmocks.SubscriptionRepository)
+	m.On("WithTx", mock.Anything).Return(nil)
+	m.On("Create", mock.Anything, mock.MatchedBy(func(s *model.Subscription) bool { return !s.AllowOverlap })).
+		Return(0, model.ErrOverlap).Once()
+	m.On("Create", mock.Anything, mock.MatchedBy(func(s *model.Subscription) bool { return s.AllowOverlap })).
+		Return(5, nil).Once()
+
+	s := NewSubscriptionService(m, WithOverlapPolicy(model.OverlapWarn))
+	id, err := s.Create(context.Background(), &model.Subscription{StartDate: time.Now()})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, id)
+	m.AssertExpectations(t)
+}
+
+// TestCreate_OverlapReject — в режиме reject ошибка пересечения возвращается без повтора
+func TestCreate_OverlapReject(t *testing.T) {
+	m := new(rmocks.SubscriptionRepository)
+	m.On("WithTx", mock.Anything).Return(nil)
+	m.On("Create", mock.Anything, mock.AnythingOfType("*model.Subscription")).Return(0, model.ErrOverlap).Once()
+
+	s := NewSubscriptionService(m, WithOverlapPolicy(model.OverlapReject))
+	_, err := s.Create(context.Background(), &model.Subscription{StartDate: time.Now()})
+	assert.ErrorIs(t, err, model.ErrOverlap)
+	m.AssertExpectations(t)
+}
+
+// TestCreate_WritesInTransaction — запись идёт через WithTx, ошибка фиксации возвращается вызывающему
+func TestCreate_WritesInTransaction(t *testing.T) {
+	m := new(rmocks.SubscriptionRepository)
+	m.On("WithTx", mock.Anything).Return(errors.New("commit failed")).Once()
+	m.On("Create", mock.Anything, mock.AnythingOfType("*model.Subscription")).Return(3, nil).Once()
+
+	s := NewSubscriptionService(m)
+	_, err := s.Create(context.Background(), &model.Subscription{StartDate: time.Now()})
+	assert.EqualError(t, err, "commit failed")
+	m.AssertExpectations(t)
+}
+
+// TestImport_AllOrNothingRejectsOnParseError — ошибка разбора строки в режиме all_or_nothing
+// отменяет запись: остальные строки только проверяются и помечаются rolled_back
+func TestImport_AllOrNothingRejectsOnParseError(t *testing.T) {
+	m := new(rmocks.SubscriptionRepository)
+	m.On("Import", mock.Anything, mock.MatchedBy(func(subs []*model.Subscription) bool { return len(subs) == 1 }),
+		model.ImportOptions{AllOrNothing: true, DryRun: true, RetryOverlap: true}).
+		Return([]model.ImportRowResult{{Status: model.ImportRowValid}}, false, nil)
+
+	s := NewSubscriptionService(m)
+	report, err := s.Import(context.Background(), []model.ImportRow{
+		{Line: 2, Subscription: model.Subscription{ServiceName: "VideoHub", StartDate: time.Now()}},
+		{Line: 3, Err: &model.ErrInvalid{Msg: "invalid price"}},
+	}, model.ImportAllOrNothing, false)
+
+	assert.NoError(t, err)
+	assert.False(t, report.Committed)
+	assert.Equal(t, 0, report.Succeeded)
+	assert.Equal(t, 1, report.Failed)
+	assert.Equal(t, []model.ImportRowResult{
+		{Line: 2, Status: model.ImportRowRolledBack},
+		{Line: 3, Status: model.ImportRowFailed, Error: "invalid price", Err: &model.ErrInvalid{Msg: "invalid price"}},
+	}, report.Rows)
+	m.AssertExpectations(t)
+}
+
+// TestImport_UnknownMode — неизвестный режим импорта — ошибка валидации
+func TestImport_UnknownMode(t *testing.T) {
+	s := NewSubscriptionService(new(rmocks.SubscriptionRepository))
+	_, err := s.Import(context.Background(), nil, "sometimes", false)
+	var invalid *model.ErrInvalid
+	assert.ErrorAs(t, err, &invalid)
+}
+
+// TestBatch_ParseErrorCancelsBatch — без continue_on_error ошибка разбора отменяет пакет до обращения к БД
+func TestBatch_ParseErrorCancelsBatch(t *testing.T) {
+	m := new(rmocks.SubscriptionRepository)
+	s := NewSubscriptionService(m)
+
+	report, err := s.Batch(context.Background(), []model.BatchOp{
+		{Op: model.BatchDelete, ID: 5},
+		{Op: model.BatchUpdate, ID: 6, Err: &model.ErrInvalid{Msg: "invalid start_date"}},
+	}, false)
+
+	assert.NoError(t, err)
+	assert.False(t, report.Committed)
+	assert.Equal(t, []model.BatchOpResult{
+		{Index: 0, Op: model.BatchDelete, Status: model.BatchOpSkipped, ID: 5},
+		{Index: 1, Op: model.BatchUpdate, Status: model.BatchOpFailed, ID: 6, Error: "invalid start_date",
+			Err: &model.ErrInvalid{Msg: "invalid start_date"}},
+	}, report.Results)
+	m.AssertNotCalled(t, "Batch", mock.Anything, mock.Anything, mock.Anything)
+}
+
+// TestBatch_ContinueOnError — корректные операции уходят в репозиторий, результаты встают на свои места
+func TestBatch_ContinueOnError(t *testing.T) {
+	m := new(rmocks.SubscriptionRepository)
+	m.On("Batch", mock.Anything, mock.MatchedBy(func(ops []model.BatchOp) bool {
+		return len(ops) == 2 && ops[0].Op == model.BatchCreate && !ops[0].Subscription.StartDate.IsZero() && ops[1].ID == 9
+	}), model.BatchOptions{ContinueOnError: true}).
+		Return([]model.BatchOpResult{
+			{Op: model.BatchCreate, Status: model.BatchOpOK, ID: 11},
+			{Op: model.BatchDelete, Status: model.BatchOpFailed, ID: 9, Err: model.ErrNotFound},
+		}, true, nil)
+
+	s := NewSubscriptionService(m, WithOverlapPolicy(model.OverlapReject))
+	report, err := s.Batch(context.Background(), []model.BatchOp{
+		{Op: model.BatchCreate, Subscription: model.Subscription{ServiceName: "VideoHub"}},
+		{Op: "upsert", Err: &model.ErrInvalid{Msg: "unknown op"}},
+		{Op: model.BatchDelete, ID: 9},
+	}, true)
+
+	assert.NoError(t, err)
+	assert.True(t, report.Committed)
+	assert.Equal(t, 1, report.Succeeded)
+	assert.Equal(t, 2, report.Failed)
+	assert.Equal(t, 11, report.Results[0].ID)
+	assert.Equal(t, 1, report.Results[1].Index)
+	assert.Equal(t, model.ErrNotFound.Error(), report.Results[2].Error)
+	m.AssertExpectations(t)
+}
+
+// TestBatch_TooLarge — пакет больше BatchMaxOps — ошибка валидации
+func TestBatch_TooLarge(t *testing.T) {
+	s := NewSubscriptionService(new(rmocks.SubscriptionRepository))
+	_, err := s.Batch(context.Background(), make([]model.BatchOp, model.BatchMaxOps+1), false)
+	var invalid *model.ErrInvalid
+	assert.ErrorAs(t, err, &invalid)
+}
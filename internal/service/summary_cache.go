@@ -0,0 +1,205 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"subs-collector/internal/metrics"
+	"subs-collector/internal/model"
+)
+
+// sumKey — нормализованные параметры SumTotal: разные написания одного фильтра дают один ключ
+type sumKey struct {
+	from, to    string
+	userID      string
+	serviceName string
+	category    string
+	tag         string
+	plan        string
+	activeFrom  string
+	activeTo    string
+}
+
+func newSumKey(from, to time.Time, f model.SubscriptionFilter) sumKey {
+	month := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return monthStart(t).Format("2006-01")
+	}
+	return sumKey{
+		from:        month(from),
+		to:          month(to),
+		userID:      strings.ToLower(f.UserID),
+		serviceName: model.NormalizeServiceName(f.ServiceName),
+		category:    model.NormalizeLabel(f.Category),
+		tag:         model.NormalizeLabel(f.Tag),
+		plan:        model.NormalizeServiceName(f.Plan),
+		activeFrom:  month(f.ActiveFrom),
+		activeTo:    month(f.ActiveTo),
+	}
+}
+
+type sumEntry struct {
+	key     sumKey
+	total   int
+	expires time.Time
+}
+
+// cachedSubscriptionService кэширует SumTotal вложенного сервиса. Запись подписки сбрасывает
+// результаты её пользователя и результаты без фильтра по пользователю. Запись справочника (цены, слияния
+// сервисов) сбрасывает весь кэш через InvalidateSummaryCache из хука WithCatalogChangeHook.
+type cachedSubscriptionService struct {
+	SubscriptionService
+
+	ttl  time.Duration
+	size int
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[sumKey]*list.Element
+	lru     *list.List // от недавно использованных к давним
+	writes  uint64     // счётчик записей: результат, посчитанный во время записи, не кэшируется
+
+	hits, misses *metrics.Counter
+}
+
+// NewCachedSubscriptionService оборачивает next кэшем SumTotal на ttl и не более size записей,
+// попадания и промахи считаются в reg как summary_cache_hits_total и summary_cache_misses_total
+func NewCachedSubscriptionService(next SubscriptionService, ttl time.Duration, size int, reg *metrics.Registry) SubscriptionService {
+	return &cachedSubscriptionService{
+		SubscriptionService: next,
+		ttl:                 ttl,
+		size:                size,
+		now:                 time.Now,
+		entries:             make(map[sumKey]*list.Element),
+		lru:                 list.New(),
+		hits:                reg.Counter("summary_cache_hits_total"),
+		misses:              reg.Counter("summary_cache_misses_total"),
+	}
+}
+
+func (c *cachedSubscriptionService) SumTotal(ctx context.Context, from time.Time, to time.Time, f model.SubscriptionFilter) (int, error) {
+	key := newSumKey(from, to, f)
+
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*sumEntry)
+		if c.now().Before(e.expires) {
+			c.lru.MoveToFront(el)
+			c.mu.Unlock()
+			c.hits.Inc()
+			return e.total, nil
+		}
+		c.remove(el)
+	}
+	writes := c.writes
+	c.mu.Unlock()
+	c.misses.Inc()
+
+	total, err := c.SubscriptionService.SumTotal(ctx, from, to, f)
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.writes != writes {
+		return total, nil
+	}
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	c.entries[key] = c.lru.PushFront(&sumEntry{key: key, total: total, expires: c.now().Add(c.ttl)})
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+	return total, nil
+}
+
+func (c *cachedSubscriptionService) Create(ctx context.Context, s *model.Subscription) (int, error) {
+	id, err := c.SubscriptionService.Create(ctx, s)
+	c.invalidate(s.UserID)
+	return id, err
+}
+
+func (c *cachedSubscriptionService) Update(ctx context.Context, id int, s *model.Subscription) error {
+	// подписка могла принадлежать другому пользователю — сбрасываем и его
+	if old, err := c.SubscriptionService.GetByID(ctx, id); err == nil {
+		defer c.invalidate(old.UserID)
+	}
+	err := c.SubscriptionService.Update(ctx, id, s)
+	c.invalidate(s.UserID)
+	return err
+}
+
+func (c *cachedSubscriptionService) Delete(ctx context.Context, id int) error {
+	if old, err := c.SubscriptionService.GetByID(ctx, id); err == nil {
+		defer c.invalidate(old.UserID)
+	}
+	return c.SubscriptionService.Delete(ctx, id)
+}
+
+func (c *cachedSubscriptionService) Import(ctx context.Context, rows []model.ImportRow, mode string, dryRun bool) (*model.ImportReport, error) {
+	report, err := c.SubscriptionService.Import(ctx, rows, mode, dryRun)
+	if err != nil || !report.Committed {
+		return report, err
+	}
+
+	users := make(map[string]bool)
+	for _, row := range rows {
+		if row.Err == nil && !users[row.Subscription.UserID] {
+			users[row.Subscription.UserID] = true
+			c.invalidate(row.Subscription.UserID)
+		}
+	}
+	return report, nil
+}
+
+// Batch сбрасывает весь кэш: операции пакета могут менять подписки любых пользователей
+func (c *cachedSubscriptionService) Batch(ctx context.Context, ops []model.BatchOp, continueOnError bool) (*model.BatchReport, error) {
+	report, err := c.SubscriptionService.Batch(ctx, ops, continueOnError)
+	if err == nil && report.Committed {
+		c.invalidateAll()
+	}
+	return report, err
+}
+
+// InvalidateSummaryCache сбрасывает кэш сводок, если svc создан NewCachedSubscriptionService: для изменений
+// вне сервиса подписок (справочник), после которых меняются суммы любых пользователей
+func InvalidateSummaryCache(svc SubscriptionService) {
+	if c, ok := svc.(*cachedSubscriptionService); ok {
+		c.invalidateAll()
+	}
+}
+
+// invalidateAll удаляет все результаты
+func (c *cachedSubscriptionService) invalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writes++
+	c.entries = make(map[sumKey]*list.Element)
+	c.lru.Init()
+}
+
+// invalidate удаляет результаты пользователя userID и результаты по всем пользователям
+func (c *cachedSubscriptionService) invalidate(userID string) {
+	userID = strings.ToLower(userID)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writes++
+	for key, el := range c.entries {
+		if key.userID == "" || key.userID == userID {
+			c.remove(el)
+		}
+	}
+}
+
+func (c *cachedSubscriptionService) remove(el *list.Element) {
+	delete(c.entries, el.Value.(*sumEntry).key)
+	c.lru.Remove(el)
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"subs-collector/internal/metrics"
+	"subs-collector/internal/model"
+	rmocks "subs-collector/internal/repository/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const (
+	cacheUserA = "11111111-1111-1111-1111-111111111111"
+	cacheUserB = "22222222-2222-2222-2222-222222222222"
+)
+
+var (
+	cacheFrom = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cacheTo   = time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// TestSumCache_HitsOnNormalizedKey — разное написание фильтра и дни внутри месяца дают попадание
+func TestSumCache_HitsOnNormalizedKey(t *testing.T) {
+	m := new(rmocks.SubscriptionRepository)
+	m.On("SumTotal", mock.Anything, cacheFrom, cacheTo, mock.Anything).Return(500, nil).Once()
+	reg := metrics.NewRegistry()
+	s := NewCachedSubscriptionService(NewSubscriptionService(m), time.Minute, 10, reg)
+
+	ctx := context.Background()
+	total, err := s.SumTotal(ctx, cacheFrom, cacheTo, model.SubscriptionFilter{ServiceName: "Video  Hub"})
+	assert.NoError(t, err)
+	assert.Equal(t, 500, total)
+
+	total, err = s.SumTotal(ctx, cacheFrom.AddDate(0, 0, 9), cacheTo, model.SubscriptionFilter{ServiceName: "VIDEO HUB"})
+	assert.NoError(t, err)
+	assert.Equal(t, 500, total)
+
+	m.AssertExpectations(t)
+	assert.Equal(t, map[string]int64{"summary_cache_hits_total": 1, "summary_cache_misses_total": 1}, reg.Snapshot())
+}
+
+// TestSumCache_InvalidatesUserOnCreate — создание подписки сбрасывает результаты её пользователя
+// и общие результаты, но не результаты других пользователей
+func TestSumCache_InvalidatesUserOnCreate(t *testing.T) {
+	m := new(rmocks.SubscriptionRepository)
+	fA := model.SubscriptionFilter{UserID: cacheUserA}
+	fB := model.SubscriptionFilter{UserID: cacheUserB}
+	all := model.SubscriptionFilter{}
+	m.On("SumTotal", mock.Anything, cacheFrom, cacheTo, fA).Return(100, nil).Twice()
+	m.On("SumTotal", mock.Anything, cacheFrom, cacheTo, fB).Return(200, nil).Once()
+	m.On("SumTotal", mock.Anything, cacheFrom, cacheTo, all).Return(300, nil).Twice()
+	m.On("WithTx", mock.Anything).Return(nil)
+	m.On("Create", mock.Anything, mock.AnythingOfType("*model.Subscription")).Return(7, nil)
+	s := NewCachedSubscriptionService(NewSubscriptionService(m), time.Minute, 10, metrics.NewRegistry())
+
+	ctx := context.Background()
+	for _, f := range []model.SubscriptionFilter{fA, fB, all} {
+		_, _ = s.SumTotal(ctx, cacheFrom, cacheTo, f)
+	}
+	_, err := s.Create(ctx, &model.Subscription{UserID: cacheUserA, StartDate: cacheFrom})
+	assert.NoError(t, err)
+	for _, f := range []model.SubscriptionFilter{fA, fB, all} {
+		_, _ = s.SumTotal(ctx, cacheFrom, cacheTo, f)
+	}
+
+	m.AssertExpectations(t)
+}
+
+// TestSumCache_ExpiresAndEvicts — запись живёт ttl, при переполнении вытесняется давно использованная
+func TestSumCache_ExpiresAndEvicts(t *testing.T) {
+	m := new(rmocks.SubscriptionRepository)
+	fA := model.SubscriptionFilter{UserID: cacheUserA}
+	fB := model.SubscriptionFilter{UserID: cacheUserB}
+	m.On("SumTotal", mock.Anything, cacheFrom, cacheTo, fA).Return(100, nil).Times(3)
+	m.On("SumTotal", mock.Anything, cacheFrom, cacheTo, fB).Return(200, nil).Once()
+	s := NewCachedSubscriptionService(NewSubscriptionService(m), time.Minute, 1, metrics.NewRegistry())
+	now := time.Now()
+	s.(*cachedSubscriptionService).now = func() time.Time { return now }
+
+	ctx := context.Background()
+	_, _ = s.SumTotal(ctx, cacheFrom, cacheTo, fA)
+	_, _ = s.SumTotal(ctx, cacheFrom, cacheTo, fA) // попадание
+
+	now = now.Add(2 * time.Minute)
+	_, _ = s.SumTotal(ctx, cacheFrom, cacheTo, fA) // истёк TTL
+	_, _ = s.SumTotal(ctx, cacheFrom, cacheTo, fB) // вытесняет fA
+	_, _ = s.SumTotal(ctx, cacheFrom, cacheTo, fA)
+
+	m.AssertExpectations(t)
+}
+
+// TestSumCache_InvalidatedByCatalogChange — изменение цены сервиса через справочник сбрасывает все суммы,
+// прогноз (dry run) — нет
+func TestSumCache_InvalidatedByCatalogChange(t *testing.T) {
+	m := new(rmocks.SubscriptionRepository)
+	fA := model.SubscriptionFilter{UserID: cacheUserA}
+	m.On("SumTotal", mock.Anything, cacheFrom, cacheTo, fA).Return(100, nil).Twice()
+	s := NewCachedSubscriptionService(NewSubscriptionService(m), time.Minute, 10, metrics.NewRegistry())
+
+	cm := new(rmocks.CatalogRepository)
+	cm.On("ApplyPriceChange", mock.Anything, mock.Anything, mock.Anything).Return(&model.PriceChangeResult{}, nil)
+	catalog := NewCatalogService(cm, WithCatalogChangeHook(func() { InvalidateSummaryCache(s) }))
+
+	ctx := context.Background()
+	change := model.ServicePriceChange{ServiceID: 1, Price: 150, EffectiveMonth: cacheFrom}
+	_, _ = s.SumTotal(ctx, cacheFrom, cacheTo, fA)
+	_, err := catalog.ChangePrice(ctx, change, true)
+	assert.NoError(t, err)
+	_, _ = s.SumTotal(ctx, cacheFrom, cacheTo, fA)
+	_, err = catalog.ChangePrice(ctx, change, false)
+	assert.NoError(t, err)
+	_, _ = s.SumTotal(ctx, cacheFrom, cacheTo, fA)
+
+	m.AssertExpectations(t)
+}
@@ -0,0 +1,181 @@
+package subsfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"subs-collector/internal/model"
+)
+
+// Reader потоково читает строки файла подписок. Ошибка отдельной строки попадает в ImportRow.Err,
+// ошибка Next — в формате файла (*model.ErrInvalid) или чтения; io.EOF — строки закончились.
+type Reader interface {
+	Next() (model.ImportRow, error)
+}
+
+// ReadAll читает все строки
+func ReadAll(r Reader) ([]model.ImportRow, error) {
+	rows := make([]model.ImportRow, 0)
+	for {
+		row, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+}
+
+// Columns — поля записи, они же имена колонок CSV по умолчанию; required — колонка обязательна
+var Columns = []struct {
+	Field    string
+	Required bool
+}{
+	{"service_name", true},
+	{"plan", false},
+	{"price", false},
+	{"user_id", true},
+	{"start_date", true},
+	{"end_date", false},
+}
+
+type csvReader struct {
+	cr     *csv.Reader
+	width  int
+	fields map[string]int // поле → номер колонки, -1 — колонки нет
+}
+
+// NewCSVReader читает заголовок CSV. mapping — пары "поле:Заголовок" для колонок с другими именами,
+// заголовки сравниваются без учёта регистра.
+func NewCSVReader(r io.Reader, mapping []string) (Reader, error) {
+	headers := make(map[string]string, len(Columns))
+	for _, c := range Columns {
+		headers[c.Field] = c.Field
+	}
+	for _, m := range mapping {
+		field, header, ok := strings.Cut(m, ":")
+		if _, known := headers[field]; !ok || !known || header == "" {
+			return nil, &model.ErrInvalid{Msg: fmt.Sprintf("invalid map %q, expected field:Header", m)}
+		}
+		headers[field] = header
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, &model.ErrInvalid{Msg: "missing CSV header"}
+	}
+	if err != nil {
+		return nil, csvError(err)
+	}
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+
+	fields := make(map[string]int, len(Columns))
+	for _, c := range Columns {
+		fields[c.Field] = -1
+		for i, h := range header {
+			if strings.EqualFold(strings.TrimSpace(h), headers[c.Field]) {
+				fields[c.Field] = i
+				break
+			}
+		}
+		if c.Required && fields[c.Field] < 0 {
+			return nil, &model.ErrInvalid{Msg: fmt.Sprintf("missing CSV column %q", headers[c.Field])}
+		}
+	}
+
+	return &csvReader{cr: cr, width: len(header), fields: fields}, nil
+}
+
+func (r *csvReader) Next() (model.ImportRow, error) {
+	rec, err := r.cr.Read()
+	if err != nil {
+		return model.ImportRow{}, csvError(err)
+	}
+	line, _ := r.cr.FieldPos(0)
+	row := model.ImportRow{Line: line}
+	if len(rec) != r.width {
+		row.Err = &model.ErrInvalid{Msg: "wrong number of fields"}
+		return row, nil
+	}
+
+	get := func(field string) string {
+		if i := r.fields[field]; i >= 0 {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+	rc := Record{ServiceName: get("service_name"), UserID: get("user_id"), StartDate: get("start_date")}
+	if v := get("plan"); v != "" {
+		rc.Plan = &v
+	}
+	if v := get("end_date"); v != "" {
+		rc.EndDate = &v
+	}
+	if v := get("price"); v != "" {
+		if rc.Price, err = strconv.Atoi(v); err != nil {
+			row.Err = &model.ErrInvalid{Msg: "invalid price"}
+			return row, nil
+		}
+	}
+	row.Subscription, row.Err = rc.Subscription()
+	return row, nil
+}
+
+// csvError — ошибка формата CSV как *model.ErrInvalid, остальные ошибки (в том числе io.EOF) как есть
+func csvError(err error) error {
+	var perr *csv.ParseError
+	if errors.As(err, &perr) {
+		return &model.ErrInvalid{Msg: fmt.Sprintf("invalid CSV at line %d: %v", perr.Line, perr.Err)}
+	}
+	return err
+}
+
+type ndjsonReader struct {
+	sc   *bufio.Scanner
+	line int
+}
+
+// NewNDJSONReader читает по объекту Record на строку, пустые строки пропускаются
+func NewNDJSONReader(r io.Reader) Reader {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	return &ndjsonReader{sc: sc}
+}
+
+func (r *ndjsonReader) Next() (model.ImportRow, error) {
+	for r.sc.Scan() {
+		r.line++
+		b := bytes.TrimSpace(r.sc.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+
+		row := model.ImportRow{Line: r.line}
+		var rc Record
+		if err := json.Unmarshal(b, &rc); err != nil {
+			row.Err = &model.ErrInvalid{Msg: "invalid JSON"}
+		} else {
+			row.Subscription, row.Err = rc.Subscription()
+		}
+		return row, nil
+	}
+
+	if errors.Is(r.sc.Err(), bufio.ErrTooLong) {
+		return model.ImportRow{}, &model.ErrInvalid{Msg: fmt.Sprintf("NDJSON line %d too long", r.line+1)}
+	}
+	if r.sc.Err() != nil {
+		return model.ImportRow{}, r.sc.Err()
+	}
+	return model.ImportRow{}, io.EOF
+}
@@ -0,0 +1,65 @@
+package subsfile
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"subs-collector/internal/model"
+)
+
+// Record — подписка в формате API: тело POST /subscriptions, строка NDJSON или CSV
+type Record struct {
+	ServiceName string  `json:"service_name"`
+	Plan        *string `json:"plan"`
+	Price       int     `json:"price"` // 0 при указанном plan — цена тарифа
+	UserID      string  `json:"user_id"`
+	StartDate   string  `json:"start_date"` // MM-YYYY
+	EndDate     *string `json:"end_date"`   // MM-YYYY
+}
+
+// Subscription проверяет поля и переводит запись в модель, ошибка — *model.ErrInvalid
+func (r Record) Subscription() (model.Subscription, error) {
+	if _, err := uuid.Parse(r.UserID); err != nil {
+		return model.Subscription{}, &model.ErrInvalid{Msg: "invalid user_id"}
+	}
+	start, err := ParseMonth(r.StartDate)
+	if err != nil {
+		return model.Subscription{}, &model.ErrInvalid{Msg: "invalid start_date"}
+	}
+	var endPtr *time.Time
+	if r.EndDate != nil && *r.EndDate != "" {
+		end, err := ParseMonth(*r.EndDate)
+		if err != nil {
+			return model.Subscription{}, &model.ErrInvalid{Msg: "invalid end_date"}
+		}
+		endPtr = &end
+	}
+
+	return model.Subscription{
+		ServiceName: r.ServiceName,
+		Plan:        r.Plan,
+		Price:       r.Price,
+		UserID:      r.UserID,
+		StartDate:   start,
+		EndDate:     endPtr,
+	}, nil
+}
+
+// ParseMonth разбирает месяц в формате MM-YYYY, результат — первое число месяца в UTC
+func ParseMonth(s string) (time.Time, error) {
+	if len(s) != 7 || s[2] != '-' {
+		return time.Time{}, fmt.Errorf("bad format, expected MM-YYYY")
+	}
+	month, err := strconv.Atoi(s[0:2])
+	if err != nil || month < 1 || month > 12 {
+		return time.Time{}, fmt.Errorf("bad month")
+	}
+	year, err := strconv.Atoi(s[3:7])
+	if err != nil || year < 1900 || year > 3000 {
+		return time.Time{}, fmt.Errorf("bad year")
+	}
+	return time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC), nil
+}
@@ -0,0 +1,98 @@
+package subsfile
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"subs-collector/internal/model"
+)
+
+// ExportRecord — подписка в выгрузке: Record с id, файл выгрузки читается импортом без правок
+type ExportRecord struct {
+	ID int `json:"id"`
+	Record
+}
+
+// RecordOf переводит подписку в формат выгрузки, месяцы — MM-YYYY
+func RecordOf(s model.Subscription) ExportRecord {
+	rc := ExportRecord{ID: s.ID, Record: Record{
+		ServiceName: s.ServiceName,
+		Plan:        s.Plan,
+		Price:       s.Price,
+		UserID:      s.UserID,
+		StartDate:   s.StartDate.UTC().Format("01-2006"),
+	}}
+	if s.EndDate != nil {
+		end := s.EndDate.UTC().Format("01-2006")
+		rc.EndDate = &end
+	}
+	return rc
+}
+
+// ExportColumns — колонки выгрузки CSV и XLSX
+var ExportColumns = []string{"id", "service_name", "plan", "price", "user_id", "start_date", "end_date"}
+
+// Writer потоково пишет подписки; Close дописывает окончание файла, но не закрывает нижний io.Writer
+type Writer interface {
+	Write(s model.Subscription) error
+	Close() error
+}
+
+type csvWriter struct {
+	cw     *csv.Writer
+	header bool
+}
+
+// NewCSVWriter пишет CSV с заголовком ExportColumns
+func NewCSVWriter(w io.Writer) Writer {
+	return &csvWriter{cw: csv.NewWriter(w)}
+}
+
+func (w *csvWriter) Write(s model.Subscription) error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	rc := RecordOf(s)
+	return w.cw.Write([]string{strconv.Itoa(rc.ID), rc.ServiceName, deref(rc.Plan), strconv.Itoa(rc.Price),
+		rc.UserID, rc.StartDate, deref(rc.EndDate)})
+}
+
+func (w *csvWriter) writeHeader() error {
+	if w.header {
+		return nil
+	}
+	w.header = true
+	return w.cw.Write(ExportColumns)
+}
+
+func (w *csvWriter) Close() error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	w.cw.Flush()
+	return w.cw.Error()
+}
+
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+// NewNDJSONWriter пишет по объекту ExportRecord на строку
+func NewNDJSONWriter(w io.Writer) Writer {
+	return &ndjsonWriter{enc: json.NewEncoder(w)}
+}
+
+func (w *ndjsonWriter) Write(s model.Subscription) error {
+	return w.enc.Encode(RecordOf(s))
+}
+
+func (w *ndjsonWriter) Close() error { return nil }
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,97 @@
+package subsfile
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"subs-collector/internal/model"
+)
+
+var exportSubs = func() []model.Subscription {
+	plan := "Семейный"
+	end := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	return []model.Subscription{
+		{ID: 7, ServiceName: "Video <Hub> & Co", Price: 990, UserID: "11111111-1111-1111-1111-111111111111",
+			StartDate: time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: 9, ServiceName: "MusicBox", Plan: &plan, Price: 300, UserID: "11111111-1111-1111-1111-111111111111",
+			StartDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), EndDate: &end},
+	}
+}()
+
+func writeAll(t *testing.T, w Writer) {
+	t.Helper()
+	for _, s := range exportSubs {
+		require.NoError(t, w.Write(s))
+	}
+	require.NoError(t, w.Close())
+}
+
+// TestExport_RoundTrip — выгрузка CSV и NDJSON читается импортом без правок
+func TestExport_RoundTrip(t *testing.T) {
+	for name, c := range map[string]struct {
+		newWriter func(io.Writer) Writer
+		newReader func(io.Reader) (Reader, error)
+	}{
+		"csv":    {NewCSVWriter, func(r io.Reader) (Reader, error) { return NewCSVReader(r, nil) }},
+		"ndjson": {NewNDJSONWriter, func(r io.Reader) (Reader, error) { return NewNDJSONReader(r), nil }},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writeAll(t, c.newWriter(&buf))
+
+			rd, err := c.newReader(&buf)
+			require.NoError(t, err)
+			rows, err := ReadAll(rd)
+			require.NoError(t, err)
+			require.Len(t, rows, len(exportSubs))
+			for i, row := range rows {
+				require.NoError(t, row.Err)
+				want := exportSubs[i]
+				want.ID = 0
+				assert.Equal(t, want, row.Subscription)
+			}
+		})
+	}
+}
+
+func TestXLSXWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writeAll(t, NewXLSXWriter(&buf))
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	parts := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		b, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		parts[f.Name] = string(b)
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels"} {
+		assert.Contains(t, parts, name)
+	}
+
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	assert.Equal(t, 3, strings.Count(sheet, "<row "))
+	assert.Contains(t, sheet, `<c r="A2"><v>7</v></c>`)
+	assert.Contains(t, sheet, `Video &lt;Hub&gt; &amp; Co`)
+	assert.NotContains(t, sheet, `r="C2"`, "пустой тариф — пропущенная ячейка")
+	assert.Contains(t, sheet, `<c r="G3" t="inlineStr"><is><t xml:space="preserve">02-2026</t></is></c>`)
+	assert.True(t, strings.HasSuffix(sheet, "</sheetData></worksheet>"))
+}
+
+func TestXLSXColumn(t *testing.T) {
+	assert.Equal(t, "A", xlsxColumn(0))
+	assert.Equal(t, "Z", xlsxColumn(25))
+	assert.Equal(t, "AA", xlsxColumn(26))
+	assert.Equal(t, "AZ", xlsxColumn(51))
+	assert.Equal(t, "BA", xlsxColumn(52))
+}
@@ -0,0 +1,135 @@
+package subsfile
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+
+	"subs-collector/internal/model"
+)
+
+// Минимальная книга SpreadsheetML: один лист, строки с inline-строками, без стилей и общей таблицы строк,
+// поэтому лист пишется в архив потоком по мере поступления подписок
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="subscriptions" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetEnd = `</sheetData></worksheet>`
+)
+
+type xlsxWriter struct {
+	zw    *zip.Writer
+	sheet io.Writer
+	row   int
+	err   error
+}
+
+// NewXLSXWriter пишет книгу Excel с одним листом: заголовок ExportColumns, затем по строке на подписку
+func NewXLSXWriter(w io.Writer) Writer {
+	x := &xlsxWriter{zw: zip.NewWriter(w)}
+	for _, part := range []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	} {
+		x.writePart(part.name, part.body)
+	}
+	if x.err == nil {
+		x.sheet, x.err = x.zw.Create("xl/worksheets/sheet1.xml")
+	}
+	x.writeString(xlsxSheetStart)
+
+	header := make([]any, len(ExportColumns))
+	for i, c := range ExportColumns {
+		header[i] = c
+	}
+	x.writeRow(header)
+	return x
+}
+
+func (x *xlsxWriter) Write(s model.Subscription) error {
+	rc := RecordOf(s)
+	var plan, end any
+	if rc.Plan != nil {
+		plan = *rc.Plan
+	}
+	if rc.EndDate != nil {
+		end = *rc.EndDate
+	}
+	x.writeRow([]any{rc.ID, rc.ServiceName, plan, rc.Price, rc.UserID, rc.StartDate, end})
+	return x.err
+}
+
+func (x *xlsxWriter) Close() error {
+	x.writeString(xlsxSheetEnd)
+	if x.err != nil {
+		return x.err
+	}
+	return x.zw.Close()
+}
+
+func (x *xlsxWriter) writePart(name, body string) {
+	if x.err != nil {
+		return
+	}
+	var w io.Writer
+	if w, x.err = x.zw.Create(name); x.err == nil {
+		_, x.err = io.WriteString(w, body)
+	}
+}
+
+func (x *xlsxWriter) writeString(s string) {
+	if x.err == nil {
+		_, x.err = io.WriteString(x.sheet, s)
+	}
+}
+
+// writeRow пишет строку листа: int — числовая ячейка, string — inline-строка, nil — пустая ячейка
+func (x *xlsxWriter) writeRow(cells []any) {
+	x.row++
+	x.writeString(`<row r="` + strconv.Itoa(x.row) + `">`)
+	for i, v := range cells {
+		ref := xlsxColumn(i) + strconv.Itoa(x.row)
+		switch v := v.(type) {
+		case int:
+			x.writeString(fmt.Sprintf(`<c r="%s"><v>%d</v></c>`, ref, v))
+		case string:
+			x.writeString(`<c r="` + ref + `" t="inlineStr"><is><t xml:space="preserve">`)
+			if x.err == nil {
+				x.err = xml.EscapeText(x.sheet, []byte(v))
+			}
+			x.writeString(`</t></is></c>`)
+		}
+	}
+	x.writeString(`</row>`)
+}
+
+// xlsxColumn — буквенное имя колонки по номеру с нуля: A, B, …, Z, AA, …
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
@@ -0,0 +1,21 @@
+-- Нормализованное имя сервиса: ключ сравнения (trim, схлопнутые пробелы, case-fold)
+ALTER TABLE services
+    ADD COLUMN IF NOT EXISTS normalized_name TEXT NULL;
+
+-- Приближённое заполнение для существующих строк, точные значения проставляет `admin dedupe-services`
+UPDATE services
+SET normalized_name = lower(regexp_replace(btrim(name), '\s+', ' ', 'g'))
+WHERE normalized_name IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_services_normalized_name ON services (normalized_name);
+
+-- Альтернативные имена сервисов, ссылаются на канонический сервис
+CREATE TABLE IF NOT EXISTS service_aliases
+(
+    alias_normalized TEXT PRIMARY KEY,
+    alias            TEXT        NOT NULL,
+    service_id       INT         NOT NULL REFERENCES services (id) ON DELETE CASCADE,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_service_aliases_service_id ON service_aliases (service_id);
@@ -0,0 +1,6 @@
+-- Применять после `admin dedupe-services -apply`, иначе уникальный индекс не создастся на дубликатах
+ALTER TABLE services
+    ALTER COLUMN normalized_name SET NOT NULL;
+
+DROP INDEX IF EXISTS idx_services_normalized_name;
+CREATE UNIQUE INDEX IF NOT EXISTS ux_services_normalized_name ON services (normalized_name);
@@ -0,0 +1,12 @@
+-- Журнал административных действий над справочником
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id         BIGSERIAL PRIMARY KEY,
+    action     TEXT        NOT NULL,
+    entity     TEXT        NOT NULL,
+    entity_id  INT         NOT NULL,
+    details    JSONB       NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log (entity, entity_id);
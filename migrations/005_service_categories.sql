@@ -0,0 +1,14 @@
+-- Категория сервиса (video, music, ...) и произвольные теги
+ALTER TABLE services
+    ADD COLUMN IF NOT EXISTS category TEXT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_services_category ON services (category);
+
+CREATE TABLE IF NOT EXISTS service_tags
+(
+    service_id INT  NOT NULL REFERENCES services (id) ON DELETE CASCADE,
+    tag        TEXT NOT NULL,
+    PRIMARY KEY (service_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS idx_service_tags_tag ON service_tags (tag);
@@ -0,0 +1,19 @@
+-- Тарифы сервисов: прайсовая цена за период оплаты
+CREATE TABLE IF NOT EXISTS service_plans
+(
+    id              SERIAL PRIMARY KEY,
+    service_id      INT         NOT NULL REFERENCES services (id) ON DELETE CASCADE,
+    name            TEXT        NOT NULL,
+    normalized_name TEXT        NOT NULL,
+    price           INTEGER     NOT NULL,
+    billing_period  TEXT        NOT NULL DEFAULT 'month' CHECK (billing_period IN ('month', 'year')),
+    currency        TEXT        NOT NULL DEFAULT 'RUB',
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (service_id, normalized_name)
+);
+
+-- Тариф подписки необязателен, цена подписки по-прежнему фиксируется в user_subscriptions.price
+ALTER TABLE user_subscriptions
+    ADD COLUMN IF NOT EXISTS plan_id INT NULL REFERENCES service_plans (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_user_subscriptions_plan_id ON user_subscriptions (plan_id);
@@ -0,0 +1,11 @@
+-- Пакеты сервисов: bundle_id включает component_id, share — доля компонента при распределении цены пакета
+CREATE TABLE IF NOT EXISTS service_bundle_components
+(
+    bundle_id    INT NOT NULL REFERENCES services (id) ON DELETE CASCADE,
+    component_id INT NOT NULL REFERENCES services (id) ON DELETE CASCADE,
+    share        INT NOT NULL DEFAULT 1 CHECK (share > 0),
+    PRIMARY KEY (bundle_id, component_id),
+    CHECK (bundle_id <> component_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_service_bundle_components_component_id ON service_bundle_components (component_id);
@@ -0,0 +1,19 @@
+-- Метаданные сервиса из встроенного каталога известных сервисов
+ALTER TABLE services
+    ADD COLUMN IF NOT EXISTS website          TEXT  NULL,
+    ADD COLUMN IF NOT EXISTS cancellation_url TEXT  NULL,
+    ADD COLUMN IF NOT EXISTS logo_url         TEXT  NULL,
+    -- версия каталога, из которой сервис импортирован последний раз
+    ADD COLUMN IF NOT EXISTS catalog_version  INT   NULL,
+    -- значения полей на момент последнего импорта: отличие текущего значения от снимка — локальная правка
+    ADD COLUMN IF NOT EXISTS catalog_snapshot JSONB NULL;
+
+-- Типичные цены сервиса по регионам, в минимальных единицах валюты (копейки, центы)
+CREATE TABLE IF NOT EXISTS service_regional_prices
+(
+    service_id  INT     NOT NULL REFERENCES services (id) ON DELETE CASCADE,
+    region      TEXT    NOT NULL,
+    currency    TEXT    NOT NULL,
+    price_minor INTEGER NOT NULL,
+    PRIMARY KEY (service_id, region)
+);
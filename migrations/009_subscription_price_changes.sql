@@ -0,0 +1,10 @@
+-- История цен подписки: с effective_month действует price вместо user_subscriptions.price
+CREATE TABLE IF NOT EXISTS subscription_price_changes
+(
+    id              BIGSERIAL PRIMARY KEY,
+    subscription_id INT         NOT NULL REFERENCES user_subscriptions (id) ON DELETE CASCADE,
+    effective_month DATE        NOT NULL,
+    price           INTEGER     NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (subscription_id, effective_month)
+);
@@ -0,0 +1,28 @@
+-- Запрет пересекающихся по месяцам подписок одного пользователя на один сервис.
+-- allow_overlap = TRUE помечает подписки, принятые с предупреждением (OVERLAP_POLICY=warn), они в проверке не участвуют.
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+ALTER TABLE user_subscriptions
+    ADD COLUMN IF NOT EXISTS allow_overlap BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- уже существующие пересечения помечаем, иначе ограничение не создастся; список — GET /subscriptions/overlaps
+UPDATE user_subscriptions a
+SET allow_overlap = TRUE
+WHERE EXISTS (SELECT 1
+              FROM user_subscriptions b
+              WHERE b.id <> a.id
+                AND b.user_id = a.user_id
+                AND b.service_id = a.service_id
+                AND date_trunc('month', b.start_date AT TIME ZONE 'UTC') <=
+                    COALESCE(date_trunc('month', a.end_date AT TIME ZONE 'UTC'), 'infinity')
+                AND date_trunc('month', a.start_date AT TIME ZONE 'UTC') <=
+                    COALESCE(date_trunc('month', b.end_date AT TIME ZONE 'UTC'), 'infinity'));
+
+ALTER TABLE user_subscriptions
+    ADD CONSTRAINT user_subscriptions_no_overlap EXCLUDE USING gist (
+        user_id WITH =,
+        service_id WITH =,
+        daterange(date_trunc('month', start_date AT TIME ZONE 'UTC')::date,
+                  (date_trunc('month', end_date AT TIME ZONE 'UTC') + interval '1 month')::date,
+                  '[)') WITH &&
+        ) WHERE (NOT allow_overlap);
@@ -0,0 +1,23 @@
+-- Период активности подписки по месяцам (UTC) как daterange [первый месяц, месяц после последнего).
+-- Сводки и фильтры по периоду используют операторы @> и && с GiST-индексом вместо date_trunc по start_date/end_date.
+ALTER TABLE user_subscriptions
+    ADD COLUMN IF NOT EXISTS active_months daterange GENERATED ALWAYS AS (
+        daterange(date_trunc('month', start_date AT TIME ZONE 'UTC')::date,
+                  (date_trunc('month', end_date AT TIME ZONE 'UTC') + interval '1 month')::date,
+                  '[)')
+        ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_user_subscriptions_active_months
+    ON user_subscriptions USING gist (active_months);
+CREATE INDEX IF NOT EXISTS idx_user_subscriptions_user_active_months
+    ON user_subscriptions USING gist (user_id, active_months);
+
+-- ограничение на пересечения переводим на то же выражение, хранящееся в колонке
+ALTER TABLE user_subscriptions
+    DROP CONSTRAINT IF EXISTS user_subscriptions_no_overlap;
+ALTER TABLE user_subscriptions
+    ADD CONSTRAINT user_subscriptions_no_overlap EXCLUDE USING gist (
+        user_id WITH =,
+        service_id WITH =,
+        active_months WITH &&
+        ) WHERE (NOT allow_overlap);
@@ -0,0 +1,117 @@
+-- Предрасчитанные траты по месяцам: сумма цен и число активных подписок пользователя на сервис в месяце.
+-- Бессрочные подписки развёрнуты до horizon (не включая его), сводки за более поздние месяцы считаются по подпискам.
+CREATE TABLE IF NOT EXISTS monthly_spend
+(
+    user_id    UUID    NOT NULL,
+    service_id INT     NOT NULL REFERENCES services (id) ON DELETE CASCADE,
+    month      DATE    NOT NULL,
+    amount     BIGINT  NOT NULL,
+    count      INTEGER NOT NULL,
+    PRIMARY KEY (user_id, service_id, month)
+);
+
+CREATE INDEX IF NOT EXISTS idx_monthly_spend_month ON monthly_spend (month);
+
+CREATE TABLE IF NOT EXISTS monthly_spend_state
+(
+    id      BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    horizon DATE NOT NULL
+);
+
+INSERT INTO monthly_spend_state (horizon)
+VALUES ((date_trunc('month', now() AT TIME ZONE 'UTC') + interval '24 months')::date)
+ON CONFLICT DO NOTHING;
+
+-- Траты, посчитанные по подпискам: цена месяца — последнее изменение с effective_month не позже месяца
+CREATE OR REPLACE VIEW monthly_spend_source AS
+SELECT us.user_id, us.service_id, mo.m::date AS month, SUM(COALESCE(pc.price, us.price)) AS amount, COUNT(*) AS count
+FROM monthly_spend_state st
+         JOIN user_subscriptions us ON lower(us.active_months) < st.horizon
+         CROSS JOIN LATERAL generate_series(lower(us.active_months)::timestamp,
+                                            LEAST(upper(us.active_months), st.horizon) - interval '1 month',
+                                            interval '1 month') mo(m)
+         LEFT JOIN LATERAL (SELECT pc.price
+                            FROM subscription_price_changes pc
+                            WHERE pc.subscription_id = us.id
+                              AND pc.effective_month <= mo.m
+                            ORDER BY pc.effective_month DESC
+                            LIMIT 1) pc ON TRUE
+GROUP BY 1, 2, 3;
+
+-- Пересчёт строк одной пары пользователь–сервис. Пересчёт целиком, а не дельтой, поэтому порядок
+-- и повторы срабатываний триггеров не важны.
+CREATE OR REPLACE FUNCTION monthly_spend_refresh(p_user UUID, p_service INT) RETURNS void AS
+$$
+BEGIN
+    PERFORM pg_advisory_xact_lock(hashtext(p_user::text), p_service);
+    DELETE FROM monthly_spend WHERE user_id = p_user AND service_id = p_service;
+    INSERT INTO monthly_spend (user_id, service_id, month, amount, count)
+    SELECT user_id, service_id, month, amount, count
+    FROM monthly_spend_source
+    WHERE user_id = p_user
+      AND service_id = p_service;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Полный пересчёт с новым горизонтом, возвращает число строк
+CREATE OR REPLACE FUNCTION monthly_spend_rebuild(p_horizon DATE) RETURNS BIGINT AS
+$$
+DECLARE
+    n BIGINT;
+BEGIN
+    LOCK TABLE monthly_spend IN EXCLUSIVE MODE;
+    UPDATE monthly_spend_state SET horizon = p_horizon;
+    DELETE FROM monthly_spend;
+    INSERT INTO monthly_spend (user_id, service_id, month, amount, count)
+    SELECT user_id, service_id, month, amount, count
+    FROM monthly_spend_source;
+    GET DIAGNOSTICS n = ROW_COUNT;
+    RETURN n;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION monthly_spend_subscriptions_trg() RETURNS trigger AS
+$$
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        PERFORM monthly_spend_refresh(OLD.user_id, OLD.service_id);
+    END IF;
+    IF TG_OP <> 'DELETE' AND (TG_OP = 'INSERT' OR NEW.user_id <> OLD.user_id OR NEW.service_id <> OLD.service_id) THEN
+        PERFORM monthly_spend_refresh(NEW.user_id, NEW.service_id);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION monthly_spend_price_changes_trg() RETURNS trigger AS
+$$
+DECLARE
+    sub_id INT;
+BEGIN
+    FOR sub_id IN SELECT DISTINCT unnest(ARRAY [
+        CASE WHEN TG_OP <> 'INSERT' THEN OLD.subscription_id END,
+        CASE WHEN TG_OP <> 'DELETE' THEN NEW.subscription_id END])
+        LOOP
+            PERFORM monthly_spend_refresh(us.user_id, us.service_id)
+            FROM user_subscriptions us
+            WHERE us.id = sub_id;
+        END LOOP;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS monthly_spend_subscriptions ON user_subscriptions;
+CREATE TRIGGER monthly_spend_subscriptions
+    AFTER INSERT OR DELETE OR UPDATE OF user_id, service_id, price, start_date, end_date
+    ON user_subscriptions
+    FOR EACH ROW
+EXECUTE FUNCTION monthly_spend_subscriptions_trg();
+
+DROP TRIGGER IF EXISTS monthly_spend_price_changes ON subscription_price_changes;
+CREATE TRIGGER monthly_spend_price_changes
+    AFTER INSERT OR UPDATE OR DELETE
+    ON subscription_price_changes
+    FOR EACH ROW
+EXECUTE FUNCTION monthly_spend_price_changes_trg();
+
+SELECT monthly_spend_rebuild((SELECT horizon FROM monthly_spend_state));
@@ -0,0 +1,18 @@
+-- Массовая загрузка подписок (`admin bulk-load`) откладывает пересчёт monthly_spend до конца транзакции:
+-- при subs_collector.defer_monthly_spend = 'on' триггер на user_subscriptions ничего не делает, загрузчик
+-- сам пересчитывает затронутые пары пользователь–сервис по одному разу.
+CREATE OR REPLACE FUNCTION monthly_spend_subscriptions_trg() RETURNS trigger AS
+$$
+BEGIN
+    IF current_setting('subs_collector.defer_monthly_spend', true) = 'on' THEN
+        RETURN NULL;
+    END IF;
+    IF TG_OP <> 'INSERT' THEN
+        PERFORM monthly_spend_refresh(OLD.user_id, OLD.service_id);
+    END IF;
+    IF TG_OP <> 'DELETE' AND (TG_OP = 'INSERT' OR NEW.user_id <> OLD.user_id OR NEW.service_id <> OLD.service_id) THEN
+        PERFORM monthly_spend_refresh(NEW.user_id, NEW.service_id);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,14 @@
+-- Ответы на POST-запросы с заголовком Idempotency-Key: повтор с тем же ключом до expires_at получает
+-- сохранённый ответ. status = NULL — первый запрос ещё выполняется.
+CREATE TABLE IF NOT EXISTS idempotency_keys
+(
+    key          TEXT PRIMARY KEY,
+    fingerprint  TEXT        NOT NULL, -- sha256 метода, пути, query и тела запроса
+    status       INT         NULL,
+    content_type TEXT        NULL,
+    body         BYTEA       NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at   TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
@@ -0,0 +1,43 @@
+-- Уведомление services_changed при изменениях справочника, после которых имя или алиас может указывать
+-- на другой сервис (переименование, переназначение алиаса, удаление, слияние). Приложение слушает канал
+-- и сбрасывает кэш id сервисов по имени, в том числе после изменений командами admin.
+-- Вставки не уведомляют: новое имя не делает закэшированные id устаревшими.
+CREATE OR REPLACE FUNCTION notify_services_changed() RETURNS trigger AS
+$$
+BEGIN
+    PERFORM pg_notify('services_changed', '');
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS services_changed_update ON services;
+CREATE TRIGGER services_changed_update
+    AFTER UPDATE OF normalized_name ON services
+    FOR EACH ROW
+    WHEN (OLD.normalized_name IS DISTINCT FROM NEW.normalized_name)
+EXECUTE FUNCTION notify_services_changed();
+
+DROP TRIGGER IF EXISTS services_changed_delete ON services;
+CREATE TRIGGER services_changed_delete
+    AFTER DELETE ON services
+    FOR EACH ROW
+EXECUTE FUNCTION notify_services_changed();
+
+DROP TRIGGER IF EXISTS services_changed_truncate ON services;
+CREATE TRIGGER services_changed_truncate
+    AFTER TRUNCATE ON services
+    FOR EACH STATEMENT
+EXECUTE FUNCTION notify_services_changed();
+
+DROP TRIGGER IF EXISTS service_aliases_changed_update ON service_aliases;
+CREATE TRIGGER service_aliases_changed_update
+    AFTER UPDATE OF service_id ON service_aliases
+    FOR EACH ROW
+    WHEN (OLD.service_id IS DISTINCT FROM NEW.service_id)
+EXECUTE FUNCTION notify_services_changed();
+
+DROP TRIGGER IF EXISTS service_aliases_changed_delete ON service_aliases;
+CREATE TRIGGER service_aliases_changed_delete
+    AFTER DELETE ON service_aliases
+    FOR EACH ROW
+EXECUTE FUNCTION notify_services_changed();